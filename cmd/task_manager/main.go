@@ -5,12 +5,27 @@ import (
 	"html/template"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/RusGadzhiev/TaskManager/internal/config"
+	"github.com/RusGadzhiev/TaskManager/internal/events"
+	"github.com/RusGadzhiev/TaskManager/internal/metrics"
+	"github.com/RusGadzhiev/TaskManager/internal/notifier"
+	"github.com/RusGadzhiev/TaskManager/internal/oidc"
 	"github.com/RusGadzhiev/TaskManager/internal/service"
+	attemptsMemory "github.com/RusGadzhiev/TaskManager/internal/storage/attemptsStorage/memory"
+	attemptsRedis "github.com/RusGadzhiev/TaskManager/internal/storage/attemptsStorage/redis"
+	mailMySQL "github.com/RusGadzhiev/TaskManager/internal/storage/mailStorage/mysql"
+	rateLimitMemory "github.com/RusGadzhiev/TaskManager/internal/storage/rateLimitStorage/memory"
+	rateLimitRedis "github.com/RusGadzhiev/TaskManager/internal/storage/rateLimitStorage/redis"
 	"github.com/RusGadzhiev/TaskManager/internal/storage/sessionsStorage/redis"
 	"github.com/RusGadzhiev/TaskManager/internal/storage/tasksStorage/mysql"
+	tokensMongo "github.com/RusGadzhiev/TaskManager/internal/storage/tokensStorage/mongo"
 	"github.com/RusGadzhiev/TaskManager/internal/storage/usersStorage/mongo"
+	webhooksMySQL "github.com/RusGadzhiev/TaskManager/internal/storage/webhooksStorage/mysql"
+	"github.com/RusGadzhiev/TaskManager/internal/tracing"
+	"github.com/RusGadzhiev/TaskManager/internal/transport/grpc/grpcHandler"
+	"github.com/RusGadzhiev/TaskManager/internal/transport/grpc/grpcServer"
 	"github.com/RusGadzhiev/TaskManager/internal/transport/http/httpHandler"
 	"github.com/RusGadzhiev/TaskManager/internal/transport/http/httpServer"
 	"go.uber.org/zap"
@@ -36,6 +51,19 @@ func main() {
 	logger := logger.NewZapLogger()
 	defer logger.Sync()
 
+	shutdownTracing, err := tracing.Init(ctx, &cfg.Tracing)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer func() {
+		// ctx уже отменен сигналом остановки, оставшимся спанам дается свое время
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			logger.Error(err)
+		}
+	}()
+
 	tasksRepo := mysql.NewTasksRepoMySQL(ctx, &cfg.MySQLDb)
 	logger.Info("Tasks repo started successfully")
 
@@ -47,18 +75,106 @@ func main() {
 	}()
 	logger.Info("Users repo started successfully")
 
+	tokensRepo := tokensMongo.NewTokensRepoMongoDB(ctx, client)
+	logger.Info("Tokens repo started successfully")
+
+	teamsRepo := mongo.NewTeamsRepoMongoDB(ctx, client)
+	logger.Info("Teams repo started successfully")
+
 	sessionsRepo := redis.NewSessionsRepoRedis(ctx, &cfg.RedisDb)
 	logger.Info("Sessions repo started successfully")
 
-	usersService := service.NewUsersService(usersRepo)
-	tasksService := service.NewTasksService(tasksRepo)
-	sessionsService := service.NewSessionsService(sessionsRepo)
+	webhooksRepo := webhooksMySQL.NewWebhooksRepoMySQL(ctx, tasksRepo.DB)
+	logger.Info("Webhooks repo started successfully")
 
-	mainService := service.NewService(*usersService, *sessionsService, *tasksService)
+	mailRepo := mailMySQL.NewMailRepoMySQL(ctx, tasksRepo.DB)
+	logger.Info("Mail repo started successfully")
 
-	httpHandler := httpHandler.NewHttpHandler(mainService, logger, tmpl)
+	// вызовы хранилищ проходят через трассировку и метрики
+	tasksStorage := metrics.NewTasksStorage(tracing.NewTasksStorage(tasksRepo))
+	outboxStorage := metrics.NewOutboxStorage(tracing.NewOutboxStorage(tasksRepo))
+	dueTasksStorage := metrics.NewDueTasksStorage(tracing.NewDueTasksStorage(tasksRepo))
+	webhooksStorage := metrics.NewWebhooksStorage(tracing.NewWebhooksStorage(webhooksRepo))
+	mailStorage := metrics.NewMailStorage(tracing.NewMailStorage(mailRepo))
+	usersStorage := metrics.NewUsersStorage(tracing.NewUsersStorage(usersRepo))
+	tokensStorage := metrics.NewTokensStorage(tracing.NewTokensStorage(tokensRepo))
+	teamsStorage := metrics.NewTeamsStorage(tracing.NewTeamsStorage(teamsRepo))
+	sessionsStorage := metrics.NewSessionsStorage(tracing.NewSessionsStorage(sessionsRepo))
+	attemptsStorage := metrics.NewLoginAttemptsStorage(tracing.NewLoginAttemptsStorage(attemptsRedis.NewAttemptsRepoRedis(sessionsRepo.DB)))
+	metrics.MustRegister(metrics.NewStatsCollector(sessionsRepo, tasksRepo, logger))
+
+	eventBus := events.NewBus(&cfg.EventBus)
+	webhooksService := service.NewWebhooksService(webhooksStorage, &cfg.Webhooks, logger)
+	go webhooksService.Run(ctx)
+
+	var mailer service.Notifier = notifier.NewLogNotifier(logger)
+	if cfg.SMTP.Host != "" {
+		mailer = notifier.NewSMTPNotifier(&cfg.SMTP)
+	}
+	mailQueue := service.NewMailQueue(mailStorage, mailer, &cfg.MailQueue, logger)
+	go mailQueue.Run(ctx)
+	notificationsService := service.NewNotificationsService(usersStorage, dueTasksStorage, teamsStorage, mailQueue, &cfg.Notifications, logger)
+	go notificationsService.Run(ctx)
+
+	outboxRelay := service.NewOutboxRelay(outboxStorage, teamsStorage, service.Publishers{eventBus, webhooksService, notificationsService}, &cfg.Outbox, logger)
+	go outboxRelay.Run(ctx)
+
+	usersService := service.NewUsersService(usersStorage, mailer, &cfg.PasswordPolicy, &cfg.PasswordReset, logger)
+	if err := usersService.BootstrapAdmins(ctx, cfg.Admin.Users); err != nil {
+		logger.Fatal(err)
+	}
+	tasksService := service.NewTasksService(tasksStorage, teamsStorage, outboxRelay)
+	sessionsService, err := service.NewSessionsService(sessionsStorage, &cfg.Sessions)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	tokensService := service.NewTokensService(tokensStorage)
+	teamsService := service.NewTeamsService(teamsStorage)
+	loginGuard := service.NewLoginGuard(attemptsStorage, attemptsMemory.NewAttemptsRepoMemory(), &cfg.LoginGuard, logger)
+
+	var rateLimitRepo service.RateLimitStorage = metrics.NewRateLimitStorage(tracing.NewRateLimitStorage(rateLimitRedis.NewRateLimitRepoRedis(sessionsRepo.DB)))
+	rateLimitFallback := rateLimitMemory.NewRateLimitRepoMemory()
+	if cfg.RateLimit.Store == config.RateLimitStoreMemory {
+		rateLimitRepo = rateLimitFallback
+	}
+	rateLimiter := service.NewRateLimiter(rateLimitRepo, rateLimitFallback, &cfg.RateLimit, logger)
+
+	mainService := service.NewService(*usersService, *sessionsService, *tasksService, *webhooksService, *tokensService, *loginGuard, *teamsService, *rateLimiter)
+
+	var sso httpHandler.SSOProvider
+	if cfg.OIDC.Issuer != "" {
+		oidcProvider, err := oidc.NewProvider(ctx, &cfg.OIDC)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		sso = oidcProvider
+		logger.Info("OIDC provider discovered successfully")
+	}
+
+	trustedProxies, err := httpHandler.ParseTrustedProxies(cfg.HTTPServer.TrustedProxies)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	httpHandler := httpHandler.NewHttpHandler(mainService, eventBus, sso, trustedProxies, logger, tmpl)
 	server := httpServer.NewHttpServer(ctx, httpHandler, &cfg.HTTPServer)
 
+	if cfg.Metrics.Port != "" {
+		metricsServer := httpServer.NewMetricsServer(&cfg.Metrics)
+		go func() {
+			if err := metricsServer.Run(ctx, logger); err != nil {
+				logger.Fatal(ctx, err)
+			}
+		}()
+	}
+
+	grpcHandler := grpcHandler.NewGrpcHandler(mainService, logger)
+	grpcServer := grpcServer.NewGrpcServer(ctx, grpcHandler, &cfg.GRPCServer)
+	go func() {
+		if err := grpcServer.Run(ctx, logger); err != nil {
+			logger.Fatal(ctx, err)
+		}
+	}()
+
 	if err := server.Run(ctx, logger); err != nil {
 		logger.Fatal(ctx, err)
 	}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+)
+
+var ErrNotLoggedIn = errors.New("not logged in, run: taskctl login")
+
+// клиент HTTP API сервера задач
+type client struct {
+	server  string
+	session string
+	// персональный токен API, если задан, используется вместо сессии
+	token string
+	// токен CSRF сессии, запрашивается перед первым изменяющим запросом
+	csrf string
+	http *http.Client
+}
+
+func newClient(server, session, token string) *client {
+	return &client{
+		server:  strings.TrimRight(server, "/"),
+		session: session,
+		token:   token,
+		http: &http.Client{
+			Timeout: 15 * time.Second,
+			// сервер отвечает редиректами на /login и /, куку нужно забрать из первого ответа
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// возвращает значение куки сессии. Если у пользователя включена 2FA, код запрашивается через otp
+func (c *client) login(username, password string, otp func() (string, error)) (string, error) {
+	resp, err := c.http.PostForm(c.server+"/login", url.Values{
+		service.UserName: {username},
+		service.Password: {password},
+		service.Remember: {"on"},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusSeeOther {
+		if challenge := findCookie(resp, service.TwoFactorCookie); challenge != "" {
+			code, err := otp()
+			if err != nil {
+				return "", err
+			}
+			return c.loginTwoFactor(challenge, code)
+		}
+	}
+	if resp.StatusCode != http.StatusFound {
+		return "", responseError(resp)
+	}
+	if session := findCookie(resp, service.CookieName); session != "" {
+		return session, nil
+	}
+	return "", errors.New("server did not set a session cookie")
+}
+
+func (c *client) loginTwoFactor(challenge, code string) (string, error) {
+	req, err := http.NewRequest(http.MethodPost, c.server+"/login/2fa", strings.NewReader(url.Values{
+		service.OTPCode: {code},
+	}.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: service.TwoFactorCookie, Value: challenge})
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		return "", responseError(resp)
+	}
+	if session := findCookie(resp, service.CookieName); session != "" {
+		return session, nil
+	}
+	return "", errors.New("server did not set a session cookie")
+}
+
+func findCookie(resp *http.Response, name string) string {
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == name {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+func (c *client) logout() error {
+	_, err := c.do(http.MethodPost, "/logout", nil)
+	return err
+}
+
+// public - путь доступен и без входа
+func (c *client) tasks(path string, public bool) ([]*service.Task, error) {
+	do := c.do
+	if public {
+		do = c.send
+	}
+	body, err := do(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	tasks := []*service.Task{}
+	if err := json.Unmarshal(body, &tasks); err != nil {
+		return nil, fmt.Errorf("bad server response: %w", err)
+	}
+	return tasks, nil
+}
+
+// возвращает id созданной задачи
+func (c *client) newTask(description, executor, team, due string) (uint64, error) {
+	body, err := c.do(http.MethodPost, "/tasks/new", url.Values{
+		service.Description: {description},
+		service.Executor:    {executor},
+		service.TeamName:    {team},
+		service.DueAt:       {due},
+	})
+	if err != nil {
+		return 0, err
+	}
+	var id uint64
+	if err := json.Unmarshal(body, &id); err != nil {
+		return 0, fmt.Errorf("bad server response: %w", err)
+	}
+	return id, nil
+}
+
+func (c *client) update(path string, taskId uint64, executor string) error {
+	form := url.Values{service.TaskId: {strconv.FormatUint(taskId, 10)}}
+	if executor != "" {
+		form.Set(service.Executor, executor)
+	}
+	_, err := c.do(http.MethodPost, path, form)
+	return err
+}
+
+func (c *client) do(method, path string, form url.Values) ([]byte, error) {
+	if c.session == "" && c.token == "" {
+		return nil, ErrNotLoggedIn
+	}
+	return c.send(method, path, form)
+}
+
+// отправляет запрос с токеном или сессией, если они есть
+func (c *client) send(method, path string, form url.Values) ([]byte, error) {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequest(method, c.server+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	} else if c.session != "" {
+		req.AddCookie(&http.Cookie{Name: service.CookieName, Value: c.session})
+		if method != http.MethodGet {
+			csrf, err := c.csrfToken()
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set(service.CSRFHeader, csrf)
+		}
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, ErrNotLoggedIn
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, responseError(resp)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (c *client) csrfToken() (string, error) {
+	if c.csrf != "" {
+		return c.csrf, nil
+	}
+	body, err := c.do(http.MethodGet, "/csrf", nil)
+	if err != nil {
+		return "", err
+	}
+	var resp map[string]string
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", fmt.Errorf("bad server response: %w", err)
+	}
+	c.csrf = resp[service.CSRFToken]
+	return c.csrf, nil
+}
+
+func responseError(resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	text := strings.TrimSpace(string(msg))
+	if text == "" {
+		text = http.StatusText(resp.StatusCode)
+	}
+	return fmt.Errorf("server: %d %s", resp.StatusCode, text)
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+	"golang.org/x/term"
+)
+
+const (
+	defaultServer = "http://localhost:8080"
+	sessionFile   = "session"
+)
+
+const usage = `Usage: taskctl [-server URL] [-o table|json] <command> [args]
+
+Commands:
+  login <username>                      log in (password and 2FA code from stdin)
+  logout                                end the session
+  list                                  all tasks, works without login
+  mine                                  tasks assigned to me
+  created                               tasks I created
+  new [-executor USER] [-team TEAM] [-due TIME] DESCRIPTION
+                                        create a task, TIME is 2006-01-02T15:04
+  assign <taskId> [executor]            assign me or, as owner, another user
+  unassign <taskId> [executor]          remove me or, as owner, another user
+  claim <taskId>                        take a task assigned to my team
+  complete <taskId>                     mark the task completed
+
+The server can also be set with TASKCTL_SERVER. If TASKCTL_TOKEN is set,
+the personal API token is used instead of the saved session.
+`
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "taskctl:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("taskctl", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(fs.Output(), usage) }
+	server := fs.String("server", envOr("TASKCTL_SERVER", defaultServer), "server URL")
+	output := fs.String("o", "table", "output format: table or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *output != "table" && *output != "json" {
+		return fmt.Errorf("unknown output format %q", *output)
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no command")
+	}
+
+	session, err := loadSession()
+	if err != nil {
+		return err
+	}
+	c := newClient(*server, session, os.Getenv("TASKCTL_TOKEN"))
+	cmd, cmdArgs := fs.Arg(0), fs.Args()[1:]
+
+	switch cmd {
+	case "login":
+		if len(cmdArgs) != 1 {
+			return errors.New("usage: taskctl login <username>")
+		}
+		in := bufio.NewReader(stdin)
+		password, err := readPassword(stdin, in)
+		if err != nil {
+			return err
+		}
+		otp := func() (string, error) {
+			fmt.Fprint(os.Stderr, "Two-factor code: ")
+			code, err := in.ReadString('\n')
+			if err != nil && err != io.EOF {
+				return "", err
+			}
+			return strings.TrimSpace(code), nil
+		}
+		session, err := c.login(cmdArgs[0], password, otp)
+		if err != nil {
+			return err
+		}
+		return saveSession(session)
+	case "logout":
+		if err := c.logout(); err != nil && err != ErrNotLoggedIn {
+			return err
+		}
+		return saveSession("")
+	case "list", "mine", "created":
+		path := map[string]string{"list": "/", "mine": "/tasks", "created": "/tasks/created"}[cmd]
+		tasks, err := c.tasks(path, cmd == "list")
+		if err != nil {
+			return err
+		}
+		return printTasks(stdout, *output, tasks)
+	case "new":
+		nfs := flag.NewFlagSet("new", flag.ContinueOnError)
+		executor := nfs.String("executor", "", "assign the task to this user")
+		team := nfs.String("team", "", "assign the task to this team")
+		due := nfs.String("due", "", "due date, 2006-01-02T15:04")
+		if err := nfs.Parse(cmdArgs); err != nil {
+			return err
+		}
+		if nfs.NArg() == 0 {
+			return errors.New("usage: taskctl new [-executor USER] [-team TEAM] [-due TIME] DESCRIPTION")
+		}
+		id, err := c.newTask(strings.Join(nfs.Args(), " "), *executor, *team, *due)
+		if err != nil {
+			return err
+		}
+		return printResult(stdout, *output, map[string]uint64{"id": id}, fmt.Sprintf("created task %d", id))
+	case "assign", "unassign", "complete", "claim":
+		if len(cmdArgs) < 1 || (cmd != "assign" && cmd != "unassign" && len(cmdArgs) > 1) || len(cmdArgs) > 2 {
+			return fmt.Errorf("usage: taskctl %s <taskId>", cmd)
+		}
+		taskId, err := strconv.ParseUint(cmdArgs[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("bad task id %q", cmdArgs[0])
+		}
+		executor := ""
+		if len(cmdArgs) == 2 {
+			executor = cmdArgs[1]
+		}
+		if err := c.update("/tasks/"+cmd, taskId, executor); err != nil {
+			return err
+		}
+		return printResult(stdout, *output, map[string]interface{}{"id": taskId, "ok": true}, "ok")
+	}
+
+	fs.Usage()
+	return fmt.Errorf("unknown command %q", cmd)
+}
+
+// с терминала пароль читается без эха, из конвейера - первой строкой
+func readPassword(stdin io.Reader, in *bufio.Reader) (string, error) {
+	fmt.Fprint(os.Stderr, "Password: ")
+	if f, ok := stdin.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		password, err := term.ReadPassword(int(f.Fd()))
+		fmt.Fprintln(os.Stderr)
+		return string(password), err
+	}
+	password, err := in.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimRight(password, "\r\n"), nil
+}
+
+func printTasks(w io.Writer, format string, tasks []*service.Task) error {
+	if format == "json" {
+		return writeJSON(w, tasks)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTATUS\tOWNER\tEXECUTORS\tTEAMS\tDUE\tDESCRIPTION")
+	for _, task := range tasks {
+		due := "-"
+		if task.DueAt != nil {
+			due = task.DueAt.Format("2006-01-02 15:04")
+		}
+		executors := strings.Join(task.Executors, ",")
+		if executors == "" {
+			executors = "-"
+		}
+		teams := strings.Join(task.Teams, ",")
+		if teams == "" {
+			teams = "-"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", task.ID, task.Status, task.Owner, executors, teams, due, firstLine(task.Description))
+	}
+	return tw.Flush()
+}
+
+func printResult(w io.Writer, format string, v interface{}, text string) error {
+	if format == "json" {
+		return writeJSON(w, v)
+	}
+	_, err := fmt.Fprintln(w, text)
+	return err
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// кука сессии хранится в $XDG_CONFIG_HOME/taskctl/session с правами только для владельца
+func sessionPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "taskctl", sessionFile), nil
+}
+
+func loadSession() (string, error) {
+	path, err := sessionPath()
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func saveSession(session string) error {
+	path, err := sessionPath()
+	if err != nil {
+		return err
+	}
+	if session == "" {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(session), 0o600)
+}
@@ -12,10 +12,26 @@ const (
 )
 
 type Config struct {
-	HTTPServer HTTPServer `yaml:"http_server"`
-	MySQLDb    MySQLDb    `yaml:"mysql_db"`
-	MongoDb    MongoDb    `yaml:"mongo_db"`
-	RedisDb    RedisDb    `yaml:"redis_db"`
+	HTTPServer     HTTPServer     `yaml:"http_server"`
+	GRPCServer     GRPCServer     `yaml:"grpc_server"`
+	MySQLDb        MySQLDb        `yaml:"mysql_db"`
+	MongoDb        MongoDb        `yaml:"mongo_db"`
+	RedisDb        RedisDb        `yaml:"redis_db"`
+	Sessions       Sessions       `yaml:"sessions"`
+	OIDC           OIDC           `yaml:"oidc"`
+	Admin          Admin          `yaml:"admin"`
+	LoginGuard     LoginGuard     `yaml:"login_guard"`
+	RateLimit      RateLimit      `yaml:"rate_limit"`
+	PasswordReset  PasswordReset  `yaml:"password_reset"`
+	PasswordPolicy PasswordPolicy `yaml:"password_policy"`
+	EventBus       EventBus       `yaml:"event_bus"`
+	Webhooks       Webhooks       `yaml:"webhooks"`
+	Outbox         Outbox         `yaml:"outbox"`
+	SMTP           SMTP           `yaml:"smtp"`
+	Notifications  Notifications  `yaml:"notifications"`
+	MailQueue      MailQueue      `yaml:"mail_queue"`
+	Tracing        Tracing        `yaml:"tracing"`
+	Metrics        Metrics        `yaml:"metrics"`
 }
 
 type HTTPServer struct {
@@ -24,6 +40,14 @@ type HTTPServer struct {
 	Timeout     time.Duration `yaml:"timeout" env-default:"4s"`
 	IdleTimeout time.Duration `yaml:"idle_timeout" env-default:"60s"`
 	User        string        `yaml:"username" env-required:"true"`
+	// адреса и подсети прокси, которым доверяется X-Forwarded-For, например "10.0.0.0/8".
+	// Без них адресом клиента считается адрес соединения
+	TrustedProxies []string `yaml:"trusted_proxies" env:"trusted_proxies"`
+}
+
+type GRPCServer struct {
+	Port    string        `yaml:"port" env-default:"9090"`
+	Timeout time.Duration `yaml:"timeout" env-default:"4s"`
 }
 
 type MySQLDb struct {
@@ -45,6 +69,170 @@ type RedisDb struct {
 	Port string `yaml:"port" env-default:"6379"`
 }
 
+const (
+	SessionsModeRedis = "redis"
+	SessionsModeJWT   = "jwt"
+)
+
+type Sessions struct {
+	// redis - сессии в redis, jwt - подписанные access токены и refresh токены в redis
+	Mode string `yaml:"mode" env-default:"redis"`
+	// сессия без активности дольше TTL истекает, с "запомнить меня" - дольше RememberTTL.
+	// В режиме jwt это время жизни refresh токена
+	TTL         time.Duration `yaml:"ttl" env-default:"24h"`
+	RememberTTL time.Duration `yaml:"remember_ttl" env-default:"720h"`
+	// сессия истекает через MaxLifetime после входа независимо от активности
+	MaxLifetime time.Duration `yaml:"max_lifetime" env-default:"2160h"`
+	JWT         JWT           `yaml:"jwt"`
+}
+
+type JWT struct {
+	AccessTTL time.Duration `yaml:"access_ttl" env-default:"15m"`
+	// kid, которым подписываются новые токены
+	ActiveKid string `yaml:"active_kid"`
+	// ключи HMAC по kid в формате kid1:secret1,kid2:secret2
+	Keys map[string]string `yaml:"keys" env:"jwt_keys"`
+}
+
+// без issuer вход через OIDC выключен
+type OIDC struct {
+	Issuer       string   `yaml:"issuer"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `env:"oidc_client_secret"`
+	RedirectURL  string   `yaml:"redirect_url"`
+	Scopes       []string `yaml:"scopes" env-default:"openid,profile,email"`
+	// claim с логином и claim со списком групп пользователя
+	UsernameClaim string `yaml:"username_claim" env-default:"preferred_username"`
+	GroupsClaim   string `yaml:"groups_claim" env-default:"groups"`
+	// роль по группе провайдера, роль user выдается всем
+	GroupRoles map[string]string `yaml:"group_roles"`
+}
+
+type Admin struct {
+	// при запуске этим существующим пользователям выдается роль admin.
+	// Пользователям внешнего провайдера роли выдаются через group_roles
+	Users []string `yaml:"users" env:"admin_users"`
+}
+
+type LoginGuard struct {
+	// после стольких неудачных попыток подряд вход блокируется
+	MaxUserFailures int `yaml:"max_user_failures" env-default:"5"`
+	MaxIPFailures   int `yaml:"max_ip_failures" env-default:"20"`
+	// блокировка снимается через столько после последней неудачной попытки
+	Lockout time.Duration `yaml:"lockout" env-default:"15m"`
+	// задержка ответа после неудачной попытки удваивается с каждой следующей
+	BaseDelay time.Duration `yaml:"base_delay" env-default:"250ms"`
+	MaxDelay  time.Duration `yaml:"max_delay" env-default:"4s"`
+}
+
+const (
+	RateLimitStoreRedis  = "redis"
+	RateLimitStoreMemory = "memory"
+)
+
+// ограничения частоты запросов по алгоритму token bucket: rate - запросов в секунду в среднем,
+// burst - сколько запросов можно сделать подряд. rate 0 отключает ограничение
+type RateLimit struct {
+	// redis - общие счетчики для всех экземпляров сервиса, memory - в памяти процесса
+	Store string `yaml:"store" env-default:"redis"`
+	// вход, регистрация и сброс пароля, по IP
+	AuthRate  float64 `yaml:"auth_rate" env-default:"0.2"`
+	AuthBurst int     `yaml:"auth_burst" env-default:"10"`
+	// запросы к задачам и остальному API, по логину
+	TasksRate  float64 `yaml:"tasks_rate" env-default:"10"`
+	TasksBurst int     `yaml:"tasks_burst" env-default:"50"`
+}
+
+type PasswordReset struct {
+	TTL time.Duration `yaml:"ttl" env-default:"1h"`
+	// адрес страницы сброса, к нему добавляется ?token=
+	URL string `yaml:"url" env-default:"http://localhost:8080/password/reset"`
+}
+
+type PasswordPolicy struct {
+	MinLength     int  `yaml:"min_length" env-default:"8"`
+	MaxLength     int  `yaml:"max_length" env-default:"128"`
+	RequireUpper  bool `yaml:"require_upper" env-default:"true"`
+	RequireLower  bool `yaml:"require_lower" env-default:"true"`
+	RequireDigit  bool `yaml:"require_digit" env-default:"true"`
+	RequireSymbol bool `yaml:"require_symbol" env-default:"false"`
+}
+
+type EventBus struct {
+	// сколько последних событий хранится для возобновления по Last-Event-ID
+	ReplaySize int `yaml:"replay_size" env-default:"256"`
+}
+
+type Webhooks struct {
+	MaxAttempts  int           `yaml:"max_attempts" env-default:"8"`
+	BaseBackoff  time.Duration `yaml:"base_backoff" env-default:"5s"`
+	MaxBackoff   time.Duration `yaml:"max_backoff" env-default:"1h"`
+	PollInterval time.Duration `yaml:"poll_interval" env-default:"2s"`
+	Timeout      time.Duration `yaml:"timeout" env-default:"10s"`
+	// сколько отправок идет одновременно
+	Workers int `yaml:"workers" env-default:"4"`
+	// на сколько выбранные отправки скрываются от других экземпляров сервиса
+	Lease time.Duration `yaml:"lease" env-default:"5m"`
+	// разрешает адреса loopback, частных сетей и link-local, только для разработки
+	AllowPrivateNetworks bool `yaml:"allow_private_networks" env-default:"false"`
+}
+
+type Outbox struct {
+	PollInterval time.Duration `yaml:"poll_interval" env-default:"1s"`
+	BatchSize    int           `yaml:"batch_size" env-default:"100"`
+	// наибольшая задержка повтора, если получатель не принял событие
+	MaxBackoff time.Duration `yaml:"max_backoff" env-default:"1m"`
+	// сколько хранить уже отправленные события
+	Retention time.Duration `yaml:"retention" env-default:"24h"`
+}
+
+// без host письма только пишутся в лог
+type SMTP struct {
+	Host     string        `yaml:"host"`
+	Port     string        `yaml:"port" env-default:"587"`
+	Username string        `yaml:"username"`
+	Password string        `env:"smtp_pass"`
+	From     string        `yaml:"from" env-default:"taskmanager@localhost"`
+	Timeout  time.Duration `yaml:"timeout" env-default:"10s"`
+}
+
+// очередь писем, отправляемых отдельно от обработки событий
+type MailQueue struct {
+	MaxAttempts  int           `yaml:"max_attempts" env-default:"5"`
+	BaseBackoff  time.Duration `yaml:"base_backoff" env-default:"30s"`
+	MaxBackoff   time.Duration `yaml:"max_backoff" env-default:"30m"`
+	PollInterval time.Duration `yaml:"poll_interval" env-default:"5s"`
+	Workers      int           `yaml:"workers" env-default:"2"`
+	// на сколько выбранные письма скрываются от других экземпляров сервиса
+	Lease time.Duration `yaml:"lease" env-default:"5m"`
+	// сколько хранить отправленные письма
+	Retention time.Duration `yaml:"retention" env-default:"72h"`
+}
+
+type Notifications struct {
+	// за сколько до срока напоминать о задаче
+	DueSoonWindow time.Duration `yaml:"due_soon_window" env-default:"24h"`
+	CheckInterval time.Duration `yaml:"check_interval" env-default:"5m"`
+}
+
+const (
+	TracingExporterNone   = "none"
+	TracingExporterOTLP   = "otlp"
+	TracingExporterStdout = "stdout"
+)
+
+// трассировка OpenTelemetry
+type Tracing struct {
+	// none - выключена, otlp - отправка коллектору по gRPC, stdout - спаны в стандартный вывод
+	Exporter string `yaml:"exporter" env-default:"none"`
+	// адрес коллектора OTLP
+	Endpoint string `yaml:"endpoint" env-default:"localhost:4317"`
+	Insecure bool   `yaml:"insecure" env-default:"true"`
+	// доля трасс, которые начинаются в сервисе и записываются; входящая трасса записывается, если ее записывает вызывающий
+	SampleRatio float64 `yaml:"sample_ratio" env-default:"1"`
+	ServiceName string  `yaml:"service_name" env-default:"task-manager"`
+}
+
 func MustLoad() *Config {
 	var cfg Config
 
@@ -54,3 +242,9 @@ func MustLoad() *Config {
 
 	return &cfg
 }
+
+// метрики Prometheus отдаются на отдельном порту, который не публикуется наружу.
+// Пустой порт их отключает
+type Metrics struct {
+	Port string `yaml:"port" env-default:"9100"`
+}
@@ -0,0 +1,104 @@
+package events
+
+import (
+	"context"
+	"sync"
+
+	"github.com/RusGadzhiev/TaskManager/internal/config"
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+)
+
+// размер буфера канала одного подписчика
+const subscriberBuffer = 64
+
+// Bus - внутрипроцессная шина событий задач.
+// Хранит последние события в кольцевом буфере для возобновления по Last-Event-ID.
+// id события - id строки outbox, поэтому он не меняется при перезапуске процесса
+type Bus struct {
+	mu     sync.RWMutex
+	lastID uint64
+	// события с id не больше horizon из буфера уже не восстановить
+	horizon     uint64
+	replay      []*service.TaskEvent
+	replaySize  int
+	subscribers map[chan *service.TaskEvent]struct{}
+}
+
+func NewBus(cfg *config.EventBus) *Bus {
+	return &Bus{
+		replay:      make([]*service.TaskEvent, 0, cfg.ReplaySize),
+		replaySize:  cfg.ReplaySize,
+		subscribers: make(map[chan *service.TaskEvent]struct{}),
+	}
+}
+
+// рассылает событие подписчикам. Повторно доставленные outbox события пропускаются.
+// Подписчик, не успевающий читать события, отключается.
+func (b *Bus) Publish(ctx context.Context, event *service.TaskEvent) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if event.ID <= b.lastID {
+		return nil
+	}
+	// что было до первого события процесса, неизвестно
+	if b.lastID == 0 {
+		b.horizon = event.ID - 1
+	}
+	b.lastID = event.ID
+	if len(b.replay) == b.replaySize && b.replaySize > 0 {
+		b.horizon = b.replay[0].ID
+		b.replay = append(b.replay[:0], b.replay[1:]...)
+	}
+	if b.replaySize > 0 {
+		b.replay = append(b.replay, event)
+	} else {
+		b.horizon = event.ID
+	}
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+	return nil
+}
+
+// возвращает события из буфера с id больше lastEventID и канал новых событий.
+// reset означает, что часть событий после lastEventID уже не восстановить
+// и клиенту нужно перечитать состояние целиком, lastID - id последнего события.
+// Канал закрывается после вызова cancel или если подписчик отстал.
+func (b *Bus) Subscribe(lastEventID uint64) (missed []*service.TaskEvent, reset bool, lastID uint64, events <-chan *service.TaskEvent, cancel func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if lastEventID != 0 {
+		reset = b.lastID == 0 || lastEventID < b.horizon || lastEventID > b.lastID
+	}
+
+	missed = []*service.TaskEvent{}
+	for _, event := range b.replay {
+		if event.ID > lastEventID {
+			missed = append(missed, event)
+		}
+	}
+	if reset {
+		missed = missed[:0]
+	}
+
+	ch := make(chan *service.TaskEvent, subscriberBuffer)
+	b.subscribers[ch] = struct{}{}
+
+	cancel = func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+	return missed, reset, b.lastID, ch, cancel
+}
@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "taskmanager"
+
+// хранилища, по которым размечены вызовы
+const (
+	BackendMySQL = "mysql"
+	BackendMongo = "mongo"
+	BackendRedis = "redis"
+)
+
+var registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route, method and status.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	storageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storage_call_duration_seconds",
+		Help:      "Storage call latency by backend, storage and method.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"backend", "storage", "method"})
+
+	storageErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "storage_call_errors_total",
+		Help:      "Failed storage calls by backend, storage and method.",
+	}, []string{"backend", "storage", "method"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		storageDuration,
+		storageErrors,
+	)
+}
+
+// отдает метрики в формате Prometheus
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// регистрирует дополнительный сборщик, например StatsCollector
+func MustRegister(c prometheus.Collector) {
+	registry.MustRegister(c)
+}
+
+// учитывает обработанный HTTP запрос, route - шаблон маршрута, а не путь, чтобы не плодить метки
+func ObserveRequest(route, method string, status int, start time.Time) {
+	code := strconv.Itoa(status)
+	httpRequests.WithLabelValues(route, method, code).Inc()
+	httpDuration.WithLabelValues(route, method, code).Observe(time.Since(start).Seconds())
+}
+
+// метки одного хранилища, общие для всех его методов
+type storageLabels struct {
+	backend string
+	storage string
+}
+
+// вызывается через defer в начале метода декоратора: start вычисляется сразу, ошибка - после вызова
+func (l storageLabels) observe(method string, start time.Time, err *error) {
+	storageDuration.WithLabelValues(l.backend, l.storage, method).Observe(time.Since(start).Seconds())
+	if *err != nil && !service.IsExpectedStorageError(*err) {
+		storageErrors.WithLabelValues(l.backend, l.storage, method).Inc()
+	}
+}
@@ -0,0 +1,180 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+)
+
+type UsersStorage struct {
+	next service.UsersStorage
+	storageLabels
+}
+
+func NewUsersStorage(next service.UsersStorage) *UsersStorage {
+	return &UsersStorage{next: next, storageLabels: storageLabels{backend: BackendMongo, storage: "users"}}
+}
+
+func (s *UsersStorage) GetUser(ctx context.Context, username string) (user *service.User, err error) {
+	defer s.observe("GetUser", time.Now(), &err)
+	return s.next.GetUser(ctx, username)
+}
+
+func (s *UsersStorage) AddUser(ctx context.Context, user *service.User) (err error) {
+	defer s.observe("AddUser", time.Now(), &err)
+	return s.next.AddUser(ctx, user)
+}
+
+func (s *UsersStorage) GetUserNames(ctx context.Context, prefix string, limit int) (names []string, err error) {
+	defer s.observe("GetUserNames", time.Now(), &err)
+	return s.next.GetUserNames(ctx, prefix, limit)
+}
+
+func (s *UsersStorage) GetUsers(ctx context.Context, usernames []string) (users []*service.User, err error) {
+	defer s.observe("GetUsers", time.Now(), &err)
+	return s.next.GetUsers(ctx, usernames)
+}
+
+func (s *UsersStorage) SetNotifications(ctx context.Context, username string, settings *service.NotificationSettings) (err error) {
+	defer s.observe("SetNotifications", time.Now(), &err)
+	return s.next.SetNotifications(ctx, username, settings)
+}
+
+func (s *UsersStorage) UpdateExternalUser(ctx context.Context, username, email string, roles []string) (err error) {
+	defer s.observe("UpdateExternalUser", time.Now(), &err)
+	return s.next.UpdateExternalUser(ctx, username, email, roles)
+}
+
+func (s *UsersStorage) SetTOTP(ctx context.Context, username string, settings *service.TOTPSettings) (err error) {
+	defer s.observe("SetTOTP", time.Now(), &err)
+	return s.next.SetTOTP(ctx, username, settings)
+}
+
+func (s *UsersStorage) UseTOTPStep(ctx context.Context, username string, step int64) (err error) {
+	defer s.observe("UseTOTPStep", time.Now(), &err)
+	return s.next.UseTOTPStep(ctx, username, step)
+}
+
+func (s *UsersStorage) UseRecoveryCode(ctx context.Context, username, hash string) (err error) {
+	defer s.observe("UseRecoveryCode", time.Now(), &err)
+	return s.next.UseRecoveryCode(ctx, username, hash)
+}
+
+func (s *UsersStorage) SetPassword(ctx context.Context, username, password string) (err error) {
+	defer s.observe("SetPassword", time.Now(), &err)
+	return s.next.SetPassword(ctx, username, password)
+}
+
+func (s *UsersStorage) UpdateProfile(ctx context.Context, username, displayName, email string) (err error) {
+	defer s.observe("UpdateProfile", time.Now(), &err)
+	return s.next.UpdateProfile(ctx, username, displayName, email)
+}
+
+func (s *UsersStorage) SetPasswordReset(ctx context.Context, username string, reset *service.PasswordReset) (err error) {
+	defer s.observe("SetPasswordReset", time.Now(), &err)
+	return s.next.SetPasswordReset(ctx, username, reset)
+}
+
+func (s *UsersStorage) ResetPassword(ctx context.Context, hash, password string, now time.Time) (username string, err error) {
+	defer s.observe("ResetPassword", time.Now(), &err)
+	return s.next.ResetPassword(ctx, hash, password, now)
+}
+
+func (s *UsersStorage) ListUsers(ctx context.Context, query string, offset, limit int) (users []*service.User, total int64, err error) {
+	defer s.observe("ListUsers", time.Now(), &err)
+	return s.next.ListUsers(ctx, query, offset, limit)
+}
+
+func (s *UsersStorage) SetDisabled(ctx context.Context, username string, disabled bool) (err error) {
+	defer s.observe("SetDisabled", time.Now(), &err)
+	return s.next.SetDisabled(ctx, username, disabled)
+}
+
+func (s *UsersStorage) AddRole(ctx context.Context, username, role string) (err error) {
+	defer s.observe("AddRole", time.Now(), &err)
+	return s.next.AddRole(ctx, username, role)
+}
+
+func (s *UsersStorage) DeleteUser(ctx context.Context, username string) (err error) {
+	defer s.observe("DeleteUser", time.Now(), &err)
+	return s.next.DeleteUser(ctx, username)
+}
+
+type TokensStorage struct {
+	next service.TokensStorage
+	storageLabels
+}
+
+func NewTokensStorage(next service.TokensStorage) *TokensStorage {
+	return &TokensStorage{next: next, storageLabels: storageLabels{backend: BackendMongo, storage: "tokens"}}
+}
+
+func (s *TokensStorage) AddToken(ctx context.Context, token *service.APIToken) (err error) {
+	defer s.observe("AddToken", time.Now(), &err)
+	return s.next.AddToken(ctx, token)
+}
+
+func (s *TokensStorage) GetTokenByHash(ctx context.Context, hash string) (token *service.APIToken, err error) {
+	defer s.observe("GetTokenByHash", time.Now(), &err)
+	return s.next.GetTokenByHash(ctx, hash)
+}
+
+func (s *TokensStorage) GetTokens(ctx context.Context, username string) (tokens []*service.APIToken, err error) {
+	defer s.observe("GetTokens", time.Now(), &err)
+	return s.next.GetTokens(ctx, username)
+}
+
+func (s *TokensStorage) DeleteToken(ctx context.Context, id string, username string) (err error) {
+	defer s.observe("DeleteToken", time.Now(), &err)
+	return s.next.DeleteToken(ctx, id, username)
+}
+
+func (s *TokensStorage) SetTokenLastUsed(ctx context.Context, id string, t time.Time) (err error) {
+	defer s.observe("SetTokenLastUsed", time.Now(), &err)
+	return s.next.SetTokenLastUsed(ctx, id, t)
+}
+
+func (s *TokensStorage) DeleteUserTokens(ctx context.Context, username string) (err error) {
+	defer s.observe("DeleteUserTokens", time.Now(), &err)
+	return s.next.DeleteUserTokens(ctx, username)
+}
+
+type TeamsStorage struct {
+	next service.TeamsStorage
+	storageLabels
+}
+
+func NewTeamsStorage(next service.TeamsStorage) *TeamsStorage {
+	return &TeamsStorage{next: next, storageLabels: storageLabels{backend: BackendMongo, storage: "teams"}}
+}
+
+func (s *TeamsStorage) AddTeam(ctx context.Context, team *service.Team) (err error) {
+	defer s.observe("AddTeam", time.Now(), &err)
+	return s.next.AddTeam(ctx, team)
+}
+
+func (s *TeamsStorage) GetTeam(ctx context.Context, name string) (team *service.Team, err error) {
+	defer s.observe("GetTeam", time.Now(), &err)
+	return s.next.GetTeam(ctx, name)
+}
+
+func (s *TeamsStorage) GetTeams(ctx context.Context) (teams []*service.Team, err error) {
+	defer s.observe("GetTeams", time.Now(), &err)
+	return s.next.GetTeams(ctx)
+}
+
+func (s *TeamsStorage) GetUserTeams(ctx context.Context, username string) (names []string, err error) {
+	defer s.observe("GetUserTeams", time.Now(), &err)
+	return s.next.GetUserTeams(ctx, username)
+}
+
+func (s *TeamsStorage) AddTeamMember(ctx context.Context, name, username string) (err error) {
+	defer s.observe("AddTeamMember", time.Now(), &err)
+	return s.next.AddTeamMember(ctx, name, username)
+}
+
+func (s *TeamsStorage) RemoveTeamMember(ctx context.Context, name, username string) (err error) {
+	defer s.observe("RemoveTeamMember", time.Now(), &err)
+	return s.next.RemoveTeamMember(ctx, name, username)
+}
@@ -0,0 +1,213 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+)
+
+type TasksStorage struct {
+	next service.TasksStorage
+	storageLabels
+}
+
+func NewTasksStorage(next service.TasksStorage) *TasksStorage {
+	return &TasksStorage{next: next, storageLabels: storageLabels{backend: BackendMySQL, storage: "tasks"}}
+}
+
+func (s *TasksStorage) GetAllTasks(ctx context.Context) (tasks []*service.Task, err error) {
+	defer s.observe("GetAllTasks", time.Now(), &err)
+	return s.next.GetAllTasks(ctx)
+}
+
+func (s *TasksStorage) GetCreatedTasks(ctx context.Context, username string) (tasks []*service.Task, err error) {
+	defer s.observe("GetCreatedTasks", time.Now(), &err)
+	return s.next.GetCreatedTasks(ctx, username)
+}
+
+func (s *TasksStorage) GetMyTasks(ctx context.Context, username string, teams []string) (tasks []*service.Task, err error) {
+	defer s.observe("GetMyTasks", time.Now(), &err)
+	return s.next.GetMyTasks(ctx, username, teams)
+}
+
+func (s *TasksStorage) GetTask(ctx context.Context, taskId uint64) (task *service.Task, err error) {
+	defer s.observe("GetTask", time.Now(), &err)
+	return s.next.GetTask(ctx, taskId)
+}
+
+func (s *TasksStorage) Add(ctx context.Context, task *service.Task) (id uint64, err error) {
+	defer s.observe("Add", time.Now(), &err)
+	return s.next.Add(ctx, task)
+}
+
+func (s *TasksStorage) Assign(ctx context.Context, taskId uint64, username string) (err error) {
+	defer s.observe("Assign", time.Now(), &err)
+	return s.next.Assign(ctx, taskId, username)
+}
+
+func (s *TasksStorage) Unassign(ctx context.Context, taskId uint64, username string) (err error) {
+	defer s.observe("Unassign", time.Now(), &err)
+	return s.next.Unassign(ctx, taskId, username)
+}
+
+func (s *TasksStorage) AssignTeam(ctx context.Context, taskId uint64, team string) (err error) {
+	defer s.observe("AssignTeam", time.Now(), &err)
+	return s.next.AssignTeam(ctx, taskId, team)
+}
+
+func (s *TasksStorage) UnassignTeam(ctx context.Context, taskId uint64, team string) (err error) {
+	defer s.observe("UnassignTeam", time.Now(), &err)
+	return s.next.UnassignTeam(ctx, taskId, team)
+}
+
+func (s *TasksStorage) Claim(ctx context.Context, taskId uint64, team, username string) (err error) {
+	defer s.observe("Claim", time.Now(), &err)
+	return s.next.Claim(ctx, taskId, team, username)
+}
+
+func (s *TasksStorage) Complete(ctx context.Context, taskId uint64) (err error) {
+	defer s.observe("Complete", time.Now(), &err)
+	return s.next.Complete(ctx, taskId)
+}
+
+func (s *TasksStorage) SetStatus(ctx context.Context, taskId uint64, status string) (err error) {
+	defer s.observe("SetStatus", time.Now(), &err)
+	return s.next.SetStatus(ctx, taskId, status)
+}
+
+func (s *TasksStorage) Watch(ctx context.Context, taskId uint64, username string) (err error) {
+	defer s.observe("Watch", time.Now(), &err)
+	return s.next.Watch(ctx, taskId, username)
+}
+
+func (s *TasksStorage) Unwatch(ctx context.Context, taskId uint64, username string) (err error) {
+	defer s.observe("Unwatch", time.Now(), &err)
+	return s.next.Unwatch(ctx, taskId, username)
+}
+
+type OutboxStorage struct {
+	next service.OutboxStorage
+	storageLabels
+}
+
+func NewOutboxStorage(next service.OutboxStorage) *OutboxStorage {
+	return &OutboxStorage{next: next, storageLabels: storageLabels{backend: BackendMySQL, storage: "outbox"}}
+}
+
+func (s *OutboxStorage) GetPendingEvents(ctx context.Context, limit int) (events []*service.OutboxEvent, err error) {
+	defer s.observe("GetPendingEvents", time.Now(), &err)
+	return s.next.GetPendingEvents(ctx, limit)
+}
+
+func (s *OutboxStorage) MarkDelivered(ctx context.Context, id uint64) (err error) {
+	defer s.observe("MarkDelivered", time.Now(), &err)
+	return s.next.MarkDelivered(ctx, id)
+}
+
+func (s *OutboxStorage) DeleteDeliveredEvents(ctx context.Context, before time.Time) (err error) {
+	defer s.observe("DeleteDeliveredEvents", time.Now(), &err)
+	return s.next.DeleteDeliveredEvents(ctx, before)
+}
+
+type DueTasksStorage struct {
+	next service.DueTasksStorage
+	storageLabels
+}
+
+func NewDueTasksStorage(next service.DueTasksStorage) *DueTasksStorage {
+	return &DueTasksStorage{next: next, storageLabels: storageLabels{backend: BackendMySQL, storage: "tasks"}}
+}
+
+func (s *DueTasksStorage) GetTasksDueBefore(ctx context.Context, before time.Time) (tasks []*service.Task, err error) {
+	defer s.observe("GetTasksDueBefore", time.Now(), &err)
+	return s.next.GetTasksDueBefore(ctx, before)
+}
+
+func (s *DueTasksStorage) MarkDueNotified(ctx context.Context, taskId uint64) (err error) {
+	defer s.observe("MarkDueNotified", time.Now(), &err)
+	return s.next.MarkDueNotified(ctx, taskId)
+}
+
+type WebhooksStorage struct {
+	next service.WebhooksStorage
+	storageLabels
+}
+
+func NewWebhooksStorage(next service.WebhooksStorage) *WebhooksStorage {
+	return &WebhooksStorage{next: next, storageLabels: storageLabels{backend: BackendMySQL, storage: "webhooks"}}
+}
+
+func (s *WebhooksStorage) AddSubscription(ctx context.Context, sub *service.WebhookSubscription) (id uint64, err error) {
+	defer s.observe("AddSubscription", time.Now(), &err)
+	return s.next.AddSubscription(ctx, sub)
+}
+
+func (s *WebhooksStorage) GetSubscription(ctx context.Context, id uint64) (sub *service.WebhookSubscription, err error) {
+	defer s.observe("GetSubscription", time.Now(), &err)
+	return s.next.GetSubscription(ctx, id)
+}
+
+func (s *WebhooksStorage) GetSubscriptions(ctx context.Context, owner string) (subs []*service.WebhookSubscription, err error) {
+	defer s.observe("GetSubscriptions", time.Now(), &err)
+	return s.next.GetSubscriptions(ctx, owner)
+}
+
+func (s *WebhooksStorage) GetAllSubscriptions(ctx context.Context) (subs []*service.WebhookSubscription, err error) {
+	defer s.observe("GetAllSubscriptions", time.Now(), &err)
+	return s.next.GetAllSubscriptions(ctx)
+}
+
+func (s *WebhooksStorage) DeleteSubscription(ctx context.Context, id uint64) (err error) {
+	defer s.observe("DeleteSubscription", time.Now(), &err)
+	return s.next.DeleteSubscription(ctx, id)
+}
+
+func (s *WebhooksStorage) AddDelivery(ctx context.Context, delivery *service.WebhookDelivery) (err error) {
+	defer s.observe("AddDelivery", time.Now(), &err)
+	return s.next.AddDelivery(ctx, delivery)
+}
+
+func (s *WebhooksStorage) ClaimDueDeliveries(ctx context.Context, now, until time.Time, limit int) (deliveries []*service.WebhookDelivery, err error) {
+	defer s.observe("ClaimDueDeliveries", time.Now(), &err)
+	return s.next.ClaimDueDeliveries(ctx, now, until, limit)
+}
+
+func (s *WebhooksStorage) UpdateDelivery(ctx context.Context, delivery *service.WebhookDelivery) (err error) {
+	defer s.observe("UpdateDelivery", time.Now(), &err)
+	return s.next.UpdateDelivery(ctx, delivery)
+}
+
+func (s *WebhooksStorage) GetDeliveries(ctx context.Context, subscriptionId uint64, limit int) (deliveries []*service.WebhookDelivery, err error) {
+	defer s.observe("GetDeliveries", time.Now(), &err)
+	return s.next.GetDeliveries(ctx, subscriptionId, limit)
+}
+
+type MailStorage struct {
+	next service.MailStorage
+	storageLabels
+}
+
+func NewMailStorage(next service.MailStorage) *MailStorage {
+	return &MailStorage{next: next, storageLabels: storageLabels{backend: BackendMySQL, storage: "mail"}}
+}
+
+func (s *MailStorage) AddMail(ctx context.Context, mail *service.Mail) (err error) {
+	defer s.observe("AddMail", time.Now(), &err)
+	return s.next.AddMail(ctx, mail)
+}
+
+func (s *MailStorage) ClaimDueMails(ctx context.Context, now, until time.Time, limit int) (mails []*service.Mail, err error) {
+	defer s.observe("ClaimDueMails", time.Now(), &err)
+	return s.next.ClaimDueMails(ctx, now, until, limit)
+}
+
+func (s *MailStorage) UpdateMail(ctx context.Context, mail *service.Mail) (err error) {
+	defer s.observe("UpdateMail", time.Now(), &err)
+	return s.next.UpdateMail(ctx, mail)
+}
+
+func (s *MailStorage) DeleteFinishedMails(ctx context.Context, before time.Time) (err error) {
+	defer s.observe("DeleteFinishedMails", time.Now(), &err)
+	return s.next.DeleteFinishedMails(ctx, before)
+}
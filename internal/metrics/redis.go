@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+)
+
+type SessionsStorage struct {
+	next service.SessionsStorage
+	storageLabels
+}
+
+func NewSessionsStorage(next service.SessionsStorage) *SessionsStorage {
+	return &SessionsStorage{next: next, storageLabels: storageLabels{backend: BackendRedis, storage: "sessions"}}
+}
+
+func (s *SessionsStorage) GetUser(ctx context.Context, cookieVal string) (username string, err error) {
+	defer s.observe("GetUser", time.Now(), &err)
+	return s.next.GetUser(ctx, cookieVal)
+}
+
+func (s *SessionsStorage) Add(ctx context.Context, cookieVal string, username string, dur time.Duration) (err error) {
+	defer s.observe("Add", time.Now(), &err)
+	return s.next.Add(ctx, cookieVal, username, dur)
+}
+
+func (s *SessionsStorage) Delete(ctx context.Context, cookieVal string) (err error) {
+	defer s.observe("Delete", time.Now(), &err)
+	return s.next.Delete(ctx, cookieVal)
+}
+
+func (s *SessionsStorage) Take(ctx context.Context, cookieVal string) (_ string, err error) {
+	defer s.observe("Take", time.Now(), &err)
+	return s.next.Take(ctx, cookieVal)
+}
+
+func (s *SessionsStorage) AddSessionInfo(ctx context.Context, info *service.SessionInfo, dur time.Duration) (err error) {
+	defer s.observe("AddSessionInfo", time.Now(), &err)
+	return s.next.AddSessionInfo(ctx, info, dur)
+}
+
+func (s *SessionsStorage) GetSessionInfo(ctx context.Context, id string) (info *service.SessionInfo, err error) {
+	defer s.observe("GetSessionInfo", time.Now(), &err)
+	return s.next.GetSessionInfo(ctx, id)
+}
+
+func (s *SessionsStorage) GetSessionInfos(ctx context.Context, username string) (infos []*service.SessionInfo, err error) {
+	defer s.observe("GetSessionInfos", time.Now(), &err)
+	return s.next.GetSessionInfos(ctx, username)
+}
+
+func (s *SessionsStorage) Expire(ctx context.Context, cookieVal string, dur time.Duration) (err error) {
+	defer s.observe("Expire", time.Now(), &err)
+	return s.next.Expire(ctx, cookieVal, dur)
+}
+
+func (s *SessionsStorage) TouchSessionInfo(ctx context.Context, username, id string, lastSeen time.Time, dur time.Duration) (err error) {
+	defer s.observe("TouchSessionInfo", time.Now(), &err)
+	return s.next.TouchSessionInfo(ctx, username, id, lastSeen, dur)
+}
+
+func (s *SessionsStorage) DeleteSessionInfo(ctx context.Context, username, id string) (err error) {
+	defer s.observe("DeleteSessionInfo", time.Now(), &err)
+	return s.next.DeleteSessionInfo(ctx, username, id)
+}
+
+func (s *SessionsStorage) CSRFToken(ctx context.Context, id, newToken string) (token string, err error) {
+	defer s.observe("CSRFToken", time.Now(), &err)
+	return s.next.CSRFToken(ctx, id, newToken)
+}
+
+type LoginAttemptsStorage struct {
+	next service.LoginAttemptsStorage
+	storageLabels
+}
+
+func NewLoginAttemptsStorage(next service.LoginAttemptsStorage) *LoginAttemptsStorage {
+	return &LoginAttemptsStorage{next: next, storageLabels: storageLabels{backend: BackendRedis, storage: "login_attempts"}}
+}
+
+func (s *LoginAttemptsStorage) RegisterFailure(ctx context.Context, key string, ttl time.Duration) (n int64, err error) {
+	defer s.observe("RegisterFailure", time.Now(), &err)
+	return s.next.RegisterFailure(ctx, key, ttl)
+}
+
+func (s *LoginAttemptsStorage) Failures(ctx context.Context, key string) (n int64, ttl time.Duration, err error) {
+	defer s.observe("Failures", time.Now(), &err)
+	return s.next.Failures(ctx, key)
+}
+
+func (s *LoginAttemptsStorage) Reset(ctx context.Context, key string) (err error) {
+	defer s.observe("Reset", time.Now(), &err)
+	return s.next.Reset(ctx, key)
+}
+
+type RateLimitStorage struct {
+	next service.RateLimitStorage
+	storageLabels
+}
+
+func NewRateLimitStorage(next service.RateLimitStorage) *RateLimitStorage {
+	return &RateLimitStorage{next: next, storageLabels: storageLabels{backend: BackendRedis, storage: "rate_limit"}}
+}
+
+func (s *RateLimitStorage) Take(ctx context.Context, key string, rate float64, burst int) (allowed bool, tokens float64, err error) {
+	defer s.observe("Take", time.Now(), &err)
+	return s.next.Take(ctx, key, rate, burst)
+}
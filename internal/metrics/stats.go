@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const (
+	statsTimeout = 5 * time.Second
+	// подсчет сессий перебирает ключи Redis, поэтому значения обновляются не при каждом сборе
+	statsCacheTTL = time.Minute
+)
+
+type SessionsCounter interface {
+	// возвращает число живых сессий всех пользователей
+	CountSessions(ctx context.Context) (int64, error)
+}
+
+type TasksCounter interface {
+	// возвращает число задач в каждом статусе
+	CountTasksByStatus(ctx context.Context) (map[string]int64, error)
+}
+
+var (
+	activeSessionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "active_sessions"),
+		"Live user sessions.", nil, nil)
+	tasksDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "tasks"),
+		"Tasks by status.", []string{"status"}, nil)
+)
+
+// StatsCollector читает число сессий и задач из хранилищ, поэтому значения верны и при нескольких
+// экземплярах сервиса. Прочитанные значения отдаются statsCacheTTL, сколько бы раз ни собирались метрики
+type StatsCollector struct {
+	sessions SessionsCounter
+	tasks    TasksCounter
+	logger   *zap.SugaredLogger
+
+	mu sync.Mutex
+	// nil, пока значение не прочитано или после ошибки хранилища
+	activeSessions *int64
+	tasksByStatus  map[string]int64
+	readAt         time.Time
+}
+
+func NewStatsCollector(sessions SessionsCounter, tasks TasksCounter, logger *zap.SugaredLogger) *StatsCollector {
+	return &StatsCollector{
+		sessions: sessions,
+		tasks:    tasks,
+		logger:   logger,
+	}
+}
+
+func (c *StatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- activeSessionsDesc
+	ch <- tasksDesc
+}
+
+// при ошибке хранилища метрика пропускается, а не отдается нулем
+func (c *StatsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.readAt) >= statsCacheTTL {
+		c.read()
+	}
+
+	if c.activeSessions != nil {
+		ch <- prometheus.MustNewConstMetric(activeSessionsDesc, prometheus.GaugeValue, float64(*c.activeSessions))
+	}
+	for status, n := range c.tasksByStatus {
+		ch <- prometheus.MustNewConstMetric(tasksDesc, prometheus.GaugeValue, float64(n), status)
+	}
+}
+
+func (c *StatsCollector) read() {
+	ctx, cancel := context.WithTimeout(context.Background(), statsTimeout)
+	defer cancel()
+	c.readAt = time.Now()
+
+	c.activeSessions = nil
+	if n, err := c.sessions.CountSessions(ctx); err != nil {
+		c.logger.Error("count sessions: ", err)
+	} else {
+		c.activeSessions = &n
+	}
+
+	counts, err := c.tasks.CountTasksByStatus(ctx)
+	if err != nil {
+		c.logger.Error("count tasks: ", err)
+	}
+	c.tasksByStatus = counts
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+type fakeCounters struct {
+	reads int
+	err   error
+}
+
+func (f *fakeCounters) CountSessions(ctx context.Context) (int64, error) {
+	f.reads++
+	return 3, f.err
+}
+
+func (f *fakeCounters) CountTasksByStatus(ctx context.Context) (map[string]int64, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return map[string]int64{"todo": 2, "done": 1}, nil
+}
+
+func collect(c prometheus.Collector) int {
+	ch := make(chan prometheus.Metric, 10)
+	c.Collect(ch)
+	close(ch)
+	n := 0
+	for range ch {
+		n++
+	}
+	return n
+}
+
+func TestStatsCollector(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantMetrics int
+	}{
+		{"storages available", nil, 3},
+		{"storages down", errors.New("connection refused"), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counters := &fakeCounters{err: tt.err}
+			c := NewStatsCollector(counters, counters, zap.NewNop().Sugar())
+			for range 3 {
+				if n := collect(c); n != tt.wantMetrics {
+					t.Errorf("collected %d metrics, want %d", n, tt.wantMetrics)
+				}
+			}
+			if counters.reads != 1 {
+				t.Errorf("sessions counted %d times, want once per %s", counters.reads, statsCacheTTL)
+			}
+
+			c.readAt = c.readAt.Add(-statsCacheTTL)
+			collect(c)
+			if counters.reads != 2 {
+				t.Error("stale values are not read again")
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package notifier
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// LogNotifier пишет письма в лог, используется когда SMTP сервер не настроен
+type LogNotifier struct {
+	logger *zap.SugaredLogger
+}
+
+func NewLogNotifier(logger *zap.SugaredLogger) *LogNotifier {
+	return &LogNotifier{logger: logger}
+}
+
+func (n *LogNotifier) Send(ctx context.Context, to, subject, body string) error {
+	n.logger.Info("Email to: ", to, " subject: ", subject, "\n", body)
+	return nil
+}
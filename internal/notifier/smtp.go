@@ -0,0 +1,87 @@
+package notifier
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/config"
+)
+
+// SMTPNotifier отправляет письма через SMTP сервер.
+// STARTTLS используется, если сервер его поддерживает, авторизация - если задан логин
+type SMTPNotifier struct {
+	cfg *config.SMTP
+}
+
+func NewSMTPNotifier(cfg *config.SMTP) *SMTPNotifier {
+	return &SMTPNotifier{cfg: cfg}
+}
+
+func (n *SMTPNotifier) Send(ctx context.Context, to, subject, body string) error {
+	addr := net.JoinHostPort(n.cfg.Host, n.cfg.Port)
+	dialer := net.Dialer{Timeout: n.cfg.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("smtp dial error: %w", err)
+	}
+	deadline := time.Now().Add(n.cfg.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, n.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp client error: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err = client.StartTLS(&tls.Config{ServerName: n.cfg.Host}); err != nil {
+			return fmt.Errorf("smtp starttls error: %w", err)
+		}
+	}
+	if n.cfg.Username != "" {
+		if err = client.Auth(smtp.PlainAuth("", n.cfg.Username, n.cfg.Password, n.cfg.Host)); err != nil {
+			return fmt.Errorf("smtp auth error: %w", err)
+		}
+	}
+
+	if err = client.Mail(n.cfg.From); err != nil {
+		return fmt.Errorf("smtp mail error: %w", err)
+	}
+	if err = client.Rcpt(to); err != nil {
+		return fmt.Errorf("smtp rcpt error: %w", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp data error: %w", err)
+	}
+	if _, err = w.Write(buildMessage(n.cfg.From, to, subject, body)); err != nil {
+		return fmt.Errorf("smtp write error: %w", err)
+	}
+	if err = w.Close(); err != nil {
+		return fmt.Errorf("smtp data error: %w", err)
+	}
+	return client.Quit()
+}
+
+func buildMessage(from, to, subject, body string) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + to + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return []byte(b.String())
+}
@@ -0,0 +1,145 @@
+package notifier
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/config"
+)
+
+// принятое фейковым сервером письмо
+type fakeMail struct {
+	from string
+	to   []string
+	data string
+}
+
+// поднимает SMTP сервер без TLS и авторизации, отвечающий на RCPT кодом rcptReply
+func newFakeSMTP(t *testing.T, rcptReply string) (*config.SMTP, <-chan fakeMail) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	mails := make(chan fakeMail, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveFakeSMTP(conn, rcptReply, mails)
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	return &config.SMTP{Host: host, Port: port, From: "taskmanager@example.com", Timeout: 5 * time.Second}, mails
+}
+
+func serveFakeSMTP(conn net.Conn, rcptReply string, mails chan<- fakeMail) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 fake ESMTP")
+
+	mail := fakeMail{}
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch cmd {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250 fake")
+		case "MAIL":
+			mail.from = line
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			mail.to = append(mail.to, line)
+			tp.PrintfLine("%s", rcptReply)
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			mail.data = string(data)
+			mails <- mail
+			tp.PrintfLine("250 queued")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("250 OK")
+		}
+	}
+}
+
+func TestSMTPNotifierSend(t *testing.T) {
+	cfg, mails := newFakeSMTP(t, "250 OK")
+	n := NewSMTPNotifier(cfg)
+
+	err := n.Send(context.Background(), "alice@example.com", "Task #1 assigned to you", "Hi alice,\n\nline two")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mail := <-mails
+	if !strings.Contains(mail.from, "<taskmanager@example.com>") {
+		t.Errorf("MAIL command %q", mail.from)
+	}
+	if len(mail.to) != 1 || !strings.Contains(mail.to[0], "<alice@example.com>") {
+		t.Errorf("RCPT commands %q", mail.to)
+	}
+	for _, want := range []string{
+		"From: taskmanager@example.com\n",
+		"To: alice@example.com\n",
+		"Subject: Task #1 assigned to you\n",
+		"Content-Type: text/plain; charset=utf-8\n",
+		"\nHi alice,\n\nline two",
+	} {
+		// ReadDotBytes переводит CRLF в LF
+		if !strings.Contains(mail.data, want) {
+			t.Errorf("message has no %q:\n%s", want, mail.data)
+		}
+	}
+}
+
+func TestSMTPNotifierErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  func(t *testing.T) *config.SMTP
+	}{
+		{"recipient rejected", func(t *testing.T) *config.SMTP {
+			cfg, _ := newFakeSMTP(t, "550 no such user")
+			return cfg
+		}},
+		{"temporary failure", func(t *testing.T) *config.SMTP {
+			cfg, _ := newFakeSMTP(t, "451 try again later")
+			return cfg
+		}},
+		{"server down", func(t *testing.T) *config.SMTP {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			host, port, _ := net.SplitHostPort(ln.Addr().String())
+			ln.Close()
+			return &config.SMTP{Host: host, Port: port, From: "taskmanager@example.com", Timeout: time.Second}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := NewSMTPNotifier(tt.cfg(t))
+			if err := n.Send(context.Background(), "alice@example.com", "subject", "body"); err == nil {
+				t.Error("got nil error")
+			}
+		})
+	}
+}
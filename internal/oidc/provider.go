@@ -0,0 +1,112 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/RusGadzhiev/TaskManager/internal/config"
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+const providerName = "oidc"
+
+var (
+	ErrNoIDToken  = errors.New("no id_token in token response")
+	ErrBadNonce   = errors.New("id_token nonce mismatch")
+	ErrNoUsername = errors.New("id_token has no username claim")
+)
+
+// Provider выполняет вход по authorization code + PKCE у OIDC провайдера
+type Provider struct {
+	cfg      *config.OIDC
+	oauth    oauth2.Config
+	verifier *gooidc.IDTokenVerifier
+}
+
+// получает настройки провайдера по issuer/.well-known/openid-configuration
+func NewProvider(ctx context.Context, cfg *config.OIDC) (*Provider, error) {
+	provider, err := gooidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("oidc discovery error: %w", err)
+	}
+
+	return &Provider{
+		cfg: cfg,
+		oauth: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       cfg.Scopes,
+		},
+		verifier: provider.Verifier(&gooidc.Config{ClientID: cfg.ClientID}),
+	}, nil
+}
+
+func (p *Provider) AuthCodeURL(state, nonce, codeVerifier string) string {
+	return p.oauth.AuthCodeURL(state, gooidc.Nonce(nonce), oauth2.S256ChallengeOption(codeVerifier))
+}
+
+// меняет код на токены, проверяет id_token и возвращает пользователя с ролями по его группам
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*service.ExternalIdentity, error) {
+	token, err := p.oauth.Exchange(ctx, code, oauth2.VerifierOption(codeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("oidc exchange error: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, ErrNoIDToken
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("oidc verify error: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, ErrBadNonce
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("oidc claims error: %w", err)
+	}
+	username, _ := claims[p.cfg.UsernameClaim].(string)
+	if username == "" {
+		return nil, ErrNoUsername
+	}
+	email, _ := claims["email"].(string)
+
+	return &service.ExternalIdentity{
+		Provider: providerName,
+		Subject:  idToken.Subject,
+		UserName: username,
+		Email:    email,
+		Roles:    p.roles(claims[p.cfg.GroupsClaim]),
+	}, nil
+}
+
+// роль user есть у всех, остальные выдаются по группам из GroupRoles
+func (p *Provider) roles(groupsClaim interface{}) []string {
+	roles := []string{service.RoleUser}
+	groups, _ := groupsClaim.([]interface{})
+	for _, g := range groups {
+		group, _ := g.(string)
+		role, ok := p.cfg.GroupRoles[group]
+		if !ok || contains(roles, role) {
+			continue
+		}
+		roles = append(roles, role)
+	}
+	return roles
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
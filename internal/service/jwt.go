@@ -0,0 +1,94 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrNoSigningKey = errors.New("jwt active signing key is not configured")
+
+// префикс ключей refresh токенов в хранилище сессий
+const refreshKeyPrefix = "refresh:"
+
+type accessClaims struct {
+	jwt.RegisteredClaims
+	// хэш refresh токена, выданного вместе с access токеном; по нему выход удаляет refresh токен
+	SessionID string `json:"sid"`
+}
+
+// jwtIssuer подписывает access токены активным ключом и проверяет их любым из настроенных ключей.
+// Для ротации новый ключ добавляется в keys и делается активным, старый удаляется
+// не раньше, чем истекут выданные им access токены
+type jwtIssuer struct {
+	keys      map[string][]byte
+	activeKid string
+	accessTTL time.Duration
+	parser    *jwt.Parser
+}
+
+func newJWTIssuer(cfg *config.JWT) (*jwtIssuer, error) {
+	if _, ok := cfg.Keys[cfg.ActiveKid]; !ok || cfg.Keys[cfg.ActiveKid] == "" {
+		return nil, ErrNoSigningKey
+	}
+	keys := make(map[string][]byte, len(cfg.Keys))
+	for kid, secret := range cfg.Keys {
+		keys[kid] = []byte(secret)
+	}
+	return &jwtIssuer{
+		keys:      keys,
+		activeKid: cfg.ActiveKid,
+		accessTTL: cfg.AccessTTL,
+		parser:    jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()})),
+	}, nil
+}
+
+func (j *jwtIssuer) issue(username, sessionID string) (string, error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   username,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(j.accessTTL)),
+		},
+		SessionID: sessionID,
+	})
+	token.Header["kid"] = j.activeKid
+	return token.SignedString(j.keys[j.activeKid])
+}
+
+// проверяет подпись и срок действия токена
+func (j *jwtIssuer) verify(raw string) (*accessClaims, error) {
+	return j.parse(raw, j.parser)
+}
+
+// проверяет только подпись, нужен для выхода с уже истекшим токеном
+func (j *jwtIssuer) verifySignature(raw string) (*accessClaims, error) {
+	return j.parse(raw, jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithoutClaimsValidation()))
+}
+
+func (j *jwtIssuer) parse(raw string, parser *jwt.Parser) (*accessClaims, error) {
+	claims := &accessClaims{}
+	_, err := parser.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := j.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown kid %q", kid)
+		}
+		return key, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func refreshKey(refreshVal string) string {
+	sum := sha256.Sum256([]byte(refreshVal))
+	return hex.EncodeToString(sum[:])
+}
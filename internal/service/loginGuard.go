@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/config"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrTooManyAttempts    = errors.New("too many failed login attempts")
+)
+
+// LockedError возвращается, пока вход заблокирован, RetryAfter - сколько осталось ждать
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%s, retry in %s", ErrTooManyAttempts, e.RetryAfter.Round(time.Second))
+}
+
+func (e *LockedError) Unwrap() error {
+	return ErrTooManyAttempts
+}
+
+type LoginAttemptsStorage interface {
+	// увеличивает счетчик неудач по ключу и продлевает его жизнь до ttl, возвращает новое значение
+	RegisterFailure(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	// возвращает счетчик и время до его сброса, 0 если неудач не было
+	Failures(ctx context.Context, key string) (int64, time.Duration, error)
+	Reset(ctx context.Context, key string) error
+}
+
+const (
+	loginUserKeyPrefix = "login_fail:user:"
+	loginIPKeyPrefix   = "login_fail:ip:"
+)
+
+// LoginGuard считает неудачные входы по логину и по IP, замедляет ответы на них и временно
+// блокирует вход. Если основное хранилище счетчиков недоступно, используется запасное в памяти процесса
+type LoginGuard struct {
+	repo     LoginAttemptsStorage
+	fallback LoginAttemptsStorage
+	cfg      *config.LoginGuard
+	logger   *zap.SugaredLogger
+}
+
+func NewLoginGuard(repo, fallback LoginAttemptsStorage, cfg *config.LoginGuard, logger *zap.SugaredLogger) *LoginGuard {
+	return &LoginGuard{
+		repo:     repo,
+		fallback: fallback,
+		cfg:      cfg,
+		logger:   logger,
+	}
+}
+
+// возвращает *LockedError, если вход для логина или адреса заблокирован
+func (g *LoginGuard) CheckLogin(ctx context.Context, username, ip string) error {
+	checks := []struct {
+		key string
+		max int
+	}{
+		{loginUserKey(username), g.cfg.MaxUserFailures},
+		{loginIPKeyPrefix + ip, g.cfg.MaxIPFailures},
+	}
+	for _, c := range checks {
+		count, ttl, err := g.repo.Failures(ctx, c.key)
+		if err != nil {
+			g.logger.Warn("login attempts storage error, using fallback: ", err)
+			count, ttl, err = g.fallback.Failures(ctx, c.key)
+			if err != nil {
+				return err
+			}
+		}
+		if count >= int64(c.max) {
+			return &LockedError{RetryAfter: ttl}
+		}
+	}
+	return nil
+}
+
+// учитывает неудачную попытку и ждет прогрессивную задержку перед ответом
+func (g *LoginGuard) LoginFailed(ctx context.Context, username, ip string) {
+	count := g.registerFailure(ctx, loginUserKey(username))
+	count = max(count, g.registerFailure(ctx, loginIPKeyPrefix+ip))
+
+	delay := g.cfg.BaseDelay
+	for i := int64(1); i < count && delay < g.cfg.MaxDelay; i++ {
+		delay *= 2
+	}
+	timer := time.NewTimer(min(delay, g.cfg.MaxDelay))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// сбрасывает счетчик логина; счетчик адреса живет до истечения, чтобы перебор по
+// разным логинам с одного адреса не обнулялся удачным входом в свой аккаунт
+func (g *LoginGuard) LoginSucceeded(ctx context.Context, username string) {
+	key := loginUserKey(username)
+	if err := g.repo.Reset(ctx, key); err != nil {
+		g.logger.Warn("login attempts storage error, using fallback: ", err)
+	}
+	if err := g.fallback.Reset(ctx, key); err != nil {
+		g.logger.Error(err.Error())
+	}
+}
+
+func (g *LoginGuard) registerFailure(ctx context.Context, key string) int64 {
+	count, err := g.repo.RegisterFailure(ctx, key, g.cfg.Lockout)
+	if err == nil {
+		return count
+	}
+	g.logger.Warn("login attempts storage error, using fallback: ", err)
+	count, err = g.fallback.RegisterFailure(ctx, key, g.cfg.Lockout)
+	if err != nil {
+		g.logger.Error(err.Error())
+	}
+	return count
+}
+
+// логин при входе ищется без учета регистра, поэтому и попытки считаются без него
+func loginUserKey(username string) string {
+	return loginUserKeyPrefix + strings.ToLower(username)
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/config"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+const mailBatchSize = 50
+
+type MailStorage interface {
+	// не добавляет повторно письмо с тем же Key
+	AddMail(ctx context.Context, mail *Mail) error
+	// возвращает ожидающие отправки письма с NextAttemptAt не позже now и переносит их NextAttemptAt на until
+	ClaimDueMails(ctx context.Context, now, until time.Time, limit int) ([]*Mail, error)
+	UpdateMail(ctx context.Context, mail *Mail) error
+	// удаляет отправленные и брошенные до before письма
+	DeleteFinishedMails(ctx context.Context, before time.Time) error
+}
+
+// MailQueue хранит письма в базе и отправляет их через Notifier в своих потоках,
+// повторяя неудачные попытки с экспоненциальной задержкой
+type MailQueue struct {
+	repo     MailStorage
+	notifier Notifier
+	cfg      *config.MailQueue
+	logger   *zap.SugaredLogger
+}
+
+func NewMailQueue(repo MailStorage, notifier Notifier, cfg *config.MailQueue, logger *zap.SugaredLogger) *MailQueue {
+	return &MailQueue{
+		repo:     repo,
+		notifier: notifier,
+		cfg:      cfg,
+		logger:   logger,
+	}
+}
+
+// ставит письмо в очередь, повтор с тем же ключом пропускается
+func (q *MailQueue) Enqueue(ctx context.Context, key, to, subject, body string) error {
+	now := time.Now()
+	return q.repo.AddMail(ctx, &Mail{
+		Key:           key,
+		To:            to,
+		Subject:       subject,
+		Body:          body,
+		Status:        DeliveryPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	})
+}
+
+// отправляет письма, пока не отменен ctx
+func (q *MailQueue) Run(ctx context.Context) {
+	poll := time.NewTicker(q.cfg.PollInterval)
+	defer poll.Stop()
+	cleanup := time.NewTicker(q.cfg.Retention)
+	defer cleanup.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-cleanup.C:
+			if err := q.repo.DeleteFinishedMails(ctx, time.Now().Add(-q.cfg.Retention)); err != nil {
+				q.logger.Error("mail: ", err.Error())
+			}
+		case <-poll.C:
+			q.sendDue(ctx)
+		}
+	}
+}
+
+func (q *MailQueue) sendDue(ctx context.Context) {
+	now := time.Now()
+	mails, err := q.repo.ClaimDueMails(WithPolling(ctx), now, now.Add(q.cfg.Lease), mailBatchSize)
+	if err != nil {
+		q.logger.Error("mail: ", err.Error())
+		return
+	}
+	if len(mails) == 0 {
+		return
+	}
+	ctx, span := tracer.Start(ctx, "mail.send", trace.WithAttributes(attribute.Int("mails", len(mails))))
+	defer span.End()
+
+	queue := make(chan *Mail)
+	var wg sync.WaitGroup
+	for range max(q.cfg.Workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for mail := range queue {
+				q.attempt(ctx, mail)
+				if err := q.repo.UpdateMail(ctx, mail); err != nil {
+					q.logger.Error("mail: ", err.Error())
+				}
+			}
+		}()
+	}
+	for _, mail := range mails {
+		queue <- mail
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// делает одну попытку отправки и обновляет состояние письма
+func (q *MailQueue) attempt(ctx context.Context, mail *Mail) {
+	mail.Attempts++
+	err := q.notifier.Send(ctx, mail.To, mail.Subject, mail.Body)
+	if err == nil {
+		now := time.Now()
+		mail.Status = DeliveryDelivered
+		mail.LastError = ""
+		mail.SentAt = &now
+		return
+	}
+
+	mail.LastError = err.Error()
+	if mail.Attempts >= q.cfg.MaxAttempts {
+		mail.Status = DeliveryFailed
+		q.logger.Info("mail ", mail.ID, " to ", mail.To, " failed after ", mail.Attempts, " attempts: ", err.Error())
+		return
+	}
+	mail.NextAttemptAt = time.Now().Add(q.backoff(mail.Attempts))
+}
+
+// BaseBackoff * 2^(attempts-1), не больше MaxBackoff
+func (q *MailQueue) backoff(attempts int) time.Duration {
+	d := q.cfg.BaseBackoff
+	for i := 1; i < attempts && d < q.cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, q.cfg.MaxBackoff)
+}
@@ -0,0 +1,280 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/config"
+	"go.uber.org/zap"
+)
+
+type fakeMailStorage struct {
+	mu     sync.Mutex
+	mails  map[uint64]*Mail
+	lastID uint64
+}
+
+func newFakeMailStorage() *fakeMailStorage {
+	return &fakeMailStorage{mails: map[uint64]*Mail{}}
+}
+
+func (f *fakeMailStorage) AddMail(ctx context.Context, mail *Mail) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, m := range f.mails {
+		if m.Key == mail.Key {
+			return nil
+		}
+	}
+	f.lastID++
+	mail.ID = f.lastID
+	copied := *mail
+	f.mails[mail.ID] = &copied
+	return nil
+}
+
+func (f *fakeMailStorage) ClaimDueMails(ctx context.Context, now, until time.Time, limit int) ([]*Mail, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	res := []*Mail{}
+	for _, m := range f.mails {
+		if m.Status == DeliveryPending && !m.NextAttemptAt.After(now) && len(res) < limit {
+			m.NextAttemptAt = until
+			copied := *m
+			res = append(res, &copied)
+		}
+	}
+	return res, nil
+}
+
+func (f *fakeMailStorage) UpdateMail(ctx context.Context, mail *Mail) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	copied := *mail
+	f.mails[mail.ID] = &copied
+	return nil
+}
+
+func (f *fakeMailStorage) DeleteFinishedMails(ctx context.Context, before time.Time) error {
+	return nil
+}
+
+func (f *fakeMailStorage) all() []*Mail {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	res := []*Mail{}
+	for _, m := range f.mails {
+		copied := *m
+		res = append(res, &copied)
+	}
+	return res
+}
+
+func (f *fakeMailStorage) expireBackoff() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, m := range f.mails {
+		m.NextAttemptAt = time.Now().Add(-time.Second)
+	}
+}
+
+// отвечает ошибкой на первые failures попыток
+type flakyNotifier struct {
+	mu       sync.Mutex
+	failures int
+	sent     []string
+}
+
+func (n *flakyNotifier) Send(ctx context.Context, to, subject, body string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.failures > 0 {
+		n.failures--
+		return errors.New("451 try again later")
+	}
+	n.sent = append(n.sent, to)
+	return nil
+}
+
+func testMailQueueConfig() *config.MailQueue {
+	return &config.MailQueue{
+		MaxAttempts:  3,
+		BaseBackoff:  time.Second,
+		MaxBackoff:   time.Minute,
+		PollInterval: time.Second,
+		Workers:      2,
+		Lease:        time.Minute,
+		Retention:    time.Hour,
+	}
+}
+
+func TestMailQueueRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int
+		wantStatus   string
+		wantAttempts int
+		wantSent     int
+	}{
+		{"sent at once", 0, DeliveryDelivered, 1, 1},
+		{"sent after retries", 2, DeliveryDelivered, 3, 1},
+		{"failed after max attempts", 5, DeliveryFailed, 3, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeMailStorage()
+			notifier := &flakyNotifier{failures: tt.failures}
+			q := NewMailQueue(repo, notifier, testMailQueueConfig(), zap.NewNop().Sugar())
+			ctx := context.Background()
+
+			if err := q.Enqueue(ctx, "key", "alice@example.com", "subject", "body"); err != nil {
+				t.Fatal(err)
+			}
+			for range 5 {
+				q.sendDue(ctx)
+				repo.expireBackoff()
+			}
+
+			mails := repo.all()
+			if len(mails) != 1 {
+				t.Fatalf("got %d mails, want 1", len(mails))
+			}
+			if mails[0].Status != tt.wantStatus || mails[0].Attempts != tt.wantAttempts {
+				t.Errorf("got status %s, attempts %d, want %s, %d", mails[0].Status, mails[0].Attempts, tt.wantStatus, tt.wantAttempts)
+			}
+			if len(notifier.sent) != tt.wantSent {
+				t.Errorf("sent %d mails, want %d", len(notifier.sent), tt.wantSent)
+			}
+		})
+	}
+}
+
+// отдает только заданных пользователей, остальные методы хранилища не нужны
+type fakeUsersStorage struct {
+	UsersStorage
+	users map[string]*User
+}
+
+func (f *fakeUsersStorage) GetUser(ctx context.Context, username string) (*User, error) {
+	user, ok := f.users[username]
+	if !ok {
+		return nil, ErrNoUser
+	}
+	return user, nil
+}
+
+type fakeDueTasksStorage struct {
+	tasks    []*Task
+	notified []uint64
+}
+
+func (f *fakeDueTasksStorage) GetTasksDueBefore(ctx context.Context, before time.Time) ([]*Task, error) {
+	return f.tasks, nil
+}
+
+func (f *fakeDueTasksStorage) MarkDueNotified(ctx context.Context, taskId uint64) error {
+	f.notified = append(f.notified, taskId)
+	return nil
+}
+
+// отдает только заданные команды, остальные методы хранилища не нужны
+type fakeTeamsStorage struct {
+	TeamsStorage
+	teams map[string]*Team
+}
+
+func (f *fakeTeamsStorage) GetTeam(ctx context.Context, name string) (*Team, error) {
+	team, ok := f.teams[name]
+	if !ok {
+		return nil, ErrNoTeam
+	}
+	return team, nil
+}
+
+func newTestNotifications(mail MailEnqueuer, tasks DueTasksStorage) *NotificationsService {
+	users := &fakeUsersStorage{users: map[string]*User{
+		"alice": {UserName: "alice", Email: "alice@example.com"},
+		"bob":   {UserName: "bob", Email: "bob@example.com"},
+		"carol": {UserName: "carol", Email: "carol@example.com", Notifications: &NotificationSettings{}},
+		"erin":  {UserName: "erin", Email: "erin@example.com"},
+	}}
+	teams := &fakeTeamsStorage{teams: map[string]*Team{
+		"backend": {Name: "backend", Owner: "bob", Members: []string{"bob", "erin"}},
+	}}
+	return NewNotificationsService(users, tasks, teams, mail, &config.Notifications{DueSoonWindow: time.Hour}, zap.NewNop().Sugar())
+}
+
+func TestNotificationsPublish(t *testing.T) {
+	task := &Task{ID: 1, Owner: "alice", Executors: []string{"bob"}}
+	teamTask := &Task{ID: 2, Owner: "alice", Teams: []string{"backend"}}
+	members := map[string][]string{"backend": {"alice", "bob", "carol", "erin"}}
+	tests := []struct {
+		name  string
+		event *TaskEvent
+		want  []string
+	}{
+		{"assigned by owner", &TaskEvent{Key: "k1", Type: EventTaskAssigned, Task: task, UserName: "bob", Actor: "alice"}, []string{"bob@example.com"}},
+		{"self assigned", &TaskEvent{Key: "k2", Type: EventTaskAssigned, Task: task, UserName: "bob", Actor: "bob"}, nil},
+		{"completed by executor", &TaskEvent{Key: "k3", Type: EventTaskCompleted, Task: task, Actor: "bob"}, []string{"alice@example.com"}},
+		{"completed by owner", &TaskEvent{Key: "k4", Type: EventTaskCompleted, Task: task, Actor: "alice"}, nil},
+		{"notifications turned off", &TaskEvent{Key: "k5", Type: EventTaskAssigned, Task: task, UserName: "carol", Actor: "alice"}, nil},
+		{"unknown user", &TaskEvent{Key: "k6", Type: EventTaskAssigned, Task: task, UserName: "dave", Actor: "alice"}, nil},
+		{"status change is not mailed", &TaskEvent{Key: "k7", Type: EventTaskStatusChanged, Task: task, Actor: "alice"}, nil},
+		{"team assigned", &TaskEvent{Key: "k8", Type: EventTaskAssigned, Task: teamTask, Team: "backend", Actor: "alice", TeamMembers: members}, []string{"bob@example.com", "erin@example.com"}},
+		{"team task claimed", &TaskEvent{Key: "k9", Type: EventTaskAssigned, Task: task, Team: "backend", UserName: "bob", Actor: "bob", TeamMembers: members}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeMailStorage()
+			q := NewMailQueue(repo, &flakyNotifier{}, testMailQueueConfig(), zap.NewNop().Sugar())
+			s := newTestNotifications(q, &fakeDueTasksStorage{})
+
+			// повторная доставка события не ставит письмо второй раз
+			for range 2 {
+				if err := s.Publish(context.Background(), tt.event); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got := []string{}
+			for _, m := range repo.all() {
+				got = append(got, m.To)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("queued mails to %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotifyDueSoon(t *testing.T) {
+	due := time.Now().Add(30 * time.Minute)
+	tasks := &fakeDueTasksStorage{tasks: []*Task{
+		{ID: 1, Owner: "alice", Executors: []string{"bob", "carol"}, DueAt: &due},
+		// bob и в исполнителях, и в команде, письмо ему одно
+		{ID: 2, Owner: "alice", Executors: []string{"bob"}, Teams: []string{"backend", "deleted"}, DueAt: &due},
+	}}
+	repo := newFakeMailStorage()
+	q := NewMailQueue(repo, &flakyNotifier{}, testMailQueueConfig(), zap.NewNop().Sugar())
+	s := newTestNotifications(q, tasks)
+
+	s.notifyDueSoon(context.Background())
+
+	got := []string{}
+	for _, m := range repo.all() {
+		got = append(got, m.To)
+	}
+	slices.Sort(got)
+	want := []string{"bob@example.com", "bob@example.com", "erin@example.com"}
+	if !slices.Equal(got, want) {
+		t.Errorf("queued mails to %v, want %v", got, want)
+	}
+	if !slices.Equal(tasks.notified, []uint64{1, 2}) {
+		t.Errorf("marked notified %v, want [1 2]", tasks.notified)
+	}
+}
@@ -1,30 +1,95 @@
 package service
 
+import "errors"
+
 const (
 	Description        = "description"
 	Executor           = "executor"
+	TeamName           = "team"
 	UserName           = "username"
 	TaskId             = "taskId"
+	Status             = "status"
+	WebhookId          = "webhookId"
+	WebhookURL         = "url"
+	WebhookSecret      = "secret"
+	WebhookEvents      = "events"
 	Password           = "password"
+	Email              = "email"
+	DueAt              = "due"
 	CookieName         = "session_id"
+	RefreshCookieName  = "refresh_id"
+	TwoFactorCookie    = "mfa_pending"
+	OTPCode            = "code"
+	Remember           = "remember"
+	NewPassword        = "new_password"
+	DisplayName        = "display_name"
+	ResetToken         = "token"
+	CSRFToken          = "csrf_token"
+	CSRFHeader         = "X-CSRF-Token"
 	FilterAllTasks     = "AllTasks"
 	FilterMyTasks      = "MyTasks"
 	FilterCreatedTasks = "CreatedTasks"
+	FilterTask         = "Task"
 	FilterAssign       = "Assign"
 	FilterUnassign     = "Unassign"
+	FilterAssignTeam   = "AssignTeam"
+	FilterUnassignTeam = "UnassignTeam"
+	FilterClaim        = "Claim"
 	FilterComplete     = "Complete"
+	FilterWatch        = "Watch"
+	FilterUnwatch      = "Unwatch"
+	FilterStatus       = "Status"
+	FilterDisableUser  = "DisableUser"
+	FilterEnableUser   = "EnableUser"
+	FilterDeleteUser   = "DeleteUser"
 )
 
 type service struct {
 	UsersService
 	SessionsService
 	TasksService
+	WebhooksService
+	TokensService
+	LoginGuard
+	TeamsService
+	RateLimiter
 }
 
-func NewService(usersService UsersService, sessionsService SessionsService, tasksService TasksService) *service {
+func NewService(usersService UsersService, sessionsService SessionsService, tasksService TasksService, webhooksService WebhooksService, tokensService TokensService, loginGuard LoginGuard, teamsService TeamsService, rateLimiter RateLimiter) *service {
 	return &service{
 		usersService,
 		sessionsService,
 		tasksService,
+		webhooksService,
+		tokensService,
+		loginGuard,
+		teamsService,
+		rateLimiter,
+	}
+}
+
+// ответы хранилищ, которые описаны в их интерфейсах и не являются сбоем: не найдено, уже есть и т.п.
+var expectedStorageErrors = []error{
+	ErrNoTask,
+	ErrNoTeamTask,
+	ErrNoUser,
+	ErrUserExist,
+	ErrNoUserBySession,
+	ErrNoSession,
+	ErrNoToken,
+	ErrNoTeam,
+	ErrTeamExist,
+	ErrNoSubscription,
+	ErrBadOTP,
+	ErrBadResetToken,
+}
+
+// отличает ожидаемый ответ хранилища от сбоя, нужно метрикам и трассировке
+func IsExpectedStorageError(err error) bool {
+	for _, e := range expectedStorageErrors {
+		if errors.Is(err, e) {
+			return true
+		}
 	}
+	return false
 }
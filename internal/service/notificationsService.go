@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/config"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// Notifier доставляет пользователю письмо
+type Notifier interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// ставит письмо в очередь отправки, повтор с тем же ключом пропускается
+type MailEnqueuer interface {
+	Enqueue(ctx context.Context, key, to, subject, body string) error
+}
+
+type DueTasksStorage interface {
+	// возвращает незавершенные задачи со сроком до before, о которых еще не напоминали
+	GetTasksDueBefore(ctx context.Context, before time.Time) ([]*Task, error)
+	MarkDueNotified(ctx context.Context, taskId uint64) error
+}
+
+// первая строка шаблона - тема письма, остальное - текст
+var notificationTemplates = template.Must(template.New("").Parse(`
+{{define "assigned"}}Task #{{.Task.ID}} assigned to you
+Hi {{.To}},
+
+{{.Task.Owner}} assigned you a task #{{.Task.ID}}:
+
+{{.Task.Description}}
+{{if .Task.DueAt}}
+Due: {{.Task.DueAt.Format "2006-01-02 15:04"}}
+{{end}}{{end}}
+
+{{define "completed"}}Task #{{.Task.ID}} completed
+Hi {{.To}},
+
+Your task #{{.Task.ID}} has been completed:
+
+{{.Task.Description}}
+{{end}}
+
+{{define "due_soon"}}Task #{{.Task.ID}} is due soon
+Hi {{.To}},
+
+Task #{{.Task.ID}} is due {{.Task.DueAt.Format "2006-01-02 15:04"}}:
+
+{{.Task.Description}}
+{{end}}
+`))
+
+// NotificationsService отправляет письма исполнителю или участникам команды о назначении,
+// владельцу о завершении и исполнителям и командам о приближении срока, с учетом настроек пользователя.
+// Письма только ставятся в очередь, отправляет их MailQueue
+type NotificationsService struct {
+	users  UsersStorage
+	tasks  DueTasksStorage
+	teams  TeamsStorage
+	mail   MailEnqueuer
+	cfg    *config.Notifications
+	logger *zap.SugaredLogger
+}
+
+func NewNotificationsService(users UsersStorage, tasks DueTasksStorage, teams TeamsStorage, mail MailEnqueuer, cfg *config.Notifications, logger *zap.SugaredLogger) *NotificationsService {
+	return &NotificationsService{
+		users:  users,
+		tasks:  tasks,
+		teams:  teams,
+		mail:   mail,
+		cfg:    cfg,
+		logger: logger,
+	}
+}
+
+// о своих действиях пользователь не уведомляется.
+// При назначении команды письмо получает каждый ее участник, при взятии задачи - только взявший
+func (s *NotificationsService) Publish(ctx context.Context, event *TaskEvent) error {
+	recipients := []string{}
+	kind := ""
+	switch event.Type {
+	case EventTaskAssigned:
+		kind = NotifyAssigned
+		if event.UserName != "" {
+			recipients = append(recipients, event.UserName)
+		} else {
+			recipients = append(recipients, event.TeamMembers[event.Team]...)
+		}
+	case EventTaskCompleted:
+		recipients, kind = append(recipients, event.Task.Owner), NotifyCompleted
+	default:
+		return nil
+	}
+	for _, recipient := range recipients {
+		if recipient == event.Actor {
+			continue
+		}
+		if err := s.notify(ctx, event.Key+":"+kind+":"+recipient, recipient, kind, event.Task); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// напоминает о задачах со сроком в ближайшие DueSoonWindow, пока не отменен ctx
+func (s *NotificationsService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.notifyDueSoon(ctx)
+		}
+	}
+}
+
+func (s *NotificationsService) notifyDueSoon(ctx context.Context) {
+	tasks, err := s.tasks.GetTasksDueBefore(WithPolling(ctx), time.Now().Add(s.cfg.DueSoonWindow))
+	if err != nil {
+		s.logger.Error("notifications: ", err.Error())
+		return
+	}
+	if len(tasks) == 0 {
+		return
+	}
+	ctx, span := tracer.Start(ctx, "notifications.due_soon", trace.WithAttributes(attribute.Int("tasks", len(tasks))))
+	defer span.End()
+
+	for _, task := range tasks {
+		// если письмо не встало в очередь, задача проверится снова на следующем шаге,
+		// а уже поставленные письма по ключу не продублируются
+		recipients, err := s.dueSoonRecipients(ctx, task)
+		if err != nil {
+			s.logger.Error("notifications: ", err.Error())
+			continue
+		}
+		queued := true
+		for _, username := range recipients {
+			key := fmt.Sprintf("%s:%d:%d:%s", NotifyDueSoon, task.ID, task.DueAt.Unix(), username)
+			if err := s.notify(ctx, key, username, NotifyDueSoon, task); err != nil {
+				s.logger.Error(err.Error())
+				queued = false
+			}
+		}
+		if !queued {
+			continue
+		}
+		if err := s.tasks.MarkDueNotified(ctx, task.ID); err != nil {
+			s.logger.Error("notifications: ", err.Error())
+		}
+	}
+}
+
+// исполнители и участники назначенных команд, каждый по одному разу
+func (s *NotificationsService) dueSoonRecipients(ctx context.Context, task *Task) ([]string, error) {
+	recipients := slices.Clone(task.Executors)
+	for _, name := range task.Teams {
+		team, err := s.teams.GetTeam(ctx, name)
+		if err == ErrNoTeam {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		for _, member := range team.Members {
+			if !slices.Contains(recipients, member) {
+				recipients = append(recipients, member)
+			}
+		}
+	}
+	return recipients, nil
+}
+
+func (s *NotificationsService) notify(ctx context.Context, key, username, kind string, task *Task) error {
+	if username == "" {
+		return nil
+	}
+	user, err := s.users.GetUser(ctx, username)
+	if err == ErrNoUser {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("notifications: %w", err)
+	}
+	if !user.Wants(kind) {
+		return nil
+	}
+
+	subject, body, err := renderNotification(kind, username, task)
+	if err != nil {
+		// шаблон не исправится от повтора
+		s.logger.Error("notifications: ", err.Error())
+		return nil
+	}
+	// ключ хешируется, чтобы уместиться в колонку при любой длине логина
+	if err := s.mail.Enqueue(ctx, hashToken(key), user.Email, subject, body); err != nil {
+		return fmt.Errorf("notifications: enqueue for %s: %w", username, err)
+	}
+	return nil
+}
+
+func renderNotification(kind, to string, task *Task) (string, string, error) {
+	var b strings.Builder
+	err := notificationTemplates.ExecuteTemplate(&b, kind, map[string]interface{}{
+		"To":   to,
+		"Task": task,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	subject, body, _ := strings.Cut(b.String(), "\n")
+	return subject, body, nil
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/config"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+type OutboxStorage interface {
+	// возвращает неотправленные события в порядке записи
+	GetPendingEvents(ctx context.Context, limit int) ([]*OutboxEvent, error)
+	MarkDelivered(ctx context.Context, id uint64) error
+	// удаляет отправленные до before события
+	DeleteDeliveredEvents(ctx context.Context, before time.Time) error
+}
+
+// OutboxRelay читает события из outbox, передает их получателю и отмечает отправленными.
+// Доставка не реже одного раза: если процесс упадет после отправки, событие уйдет повторно
+// с тем же ключом идемпотентности
+type OutboxRelay struct {
+	repo      OutboxStorage
+	teams     TeamsStorage
+	publisher EventPublisher
+	cfg       *config.Outbox
+	logger    *zap.SugaredLogger
+	wake      chan struct{}
+	// подряд неудачные попытки и время следующей
+	failures int
+	retryAt  time.Time
+}
+
+func NewOutboxRelay(repo OutboxStorage, teams TeamsStorage, publisher EventPublisher, cfg *config.Outbox, logger *zap.SugaredLogger) *OutboxRelay {
+	return &OutboxRelay{
+		repo:      repo,
+		teams:     teams,
+		publisher: publisher,
+		cfg:       cfg,
+		logger:    logger,
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// будит relay, не дожидаясь очередного опроса
+func (r *OutboxRelay) Notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// отправляет события, пока не отменен ctx
+func (r *OutboxRelay) Run(ctx context.Context) {
+	poll := time.NewTicker(r.cfg.PollInterval)
+	defer poll.Stop()
+	cleanup := time.NewTicker(r.cfg.Retention)
+	defer cleanup.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-cleanup.C:
+			if err := r.repo.DeleteDeliveredEvents(ctx, time.Now().Add(-r.cfg.Retention)); err != nil {
+				r.logger.Error("outbox: ", err.Error())
+			}
+			continue
+		case <-poll.C:
+		case <-r.wake:
+		}
+		r.relay(ctx)
+	}
+}
+
+// отправляет накопившиеся события пачками, пока они не закончатся.
+// Событие отмечается отправленным, только если его приняли все получатели,
+// иначе отправка повторяется с экспоненциальной задержкой
+func (r *OutboxRelay) relay(ctx context.Context) {
+	if time.Now().Before(r.retryAt) {
+		return
+	}
+	for {
+		events, err := r.repo.GetPendingEvents(WithPolling(ctx), r.cfg.BatchSize)
+		if err != nil {
+			r.logger.Error("outbox: ", err.Error())
+			return
+		}
+		if len(events) == 0 {
+			return
+		}
+		if !r.relayBatch(ctx, events) || len(events) < r.cfg.BatchSize {
+			return
+		}
+	}
+}
+
+// возвращает false, если отправку нужно прервать до следующего опроса
+func (r *OutboxRelay) relayBatch(ctx context.Context, events []*OutboxEvent) bool {
+	ctx, span := tracer.Start(ctx, "outbox.relay", trace.WithAttributes(attribute.Int("events", len(events))))
+	defer span.End()
+
+	for _, outboxEvent := range events {
+		event := &TaskEvent{}
+		if err := json.Unmarshal(outboxEvent.Payload, event); err != nil {
+			// битое событие не должно блокировать очередь
+			r.logger.Error("outbox: event ", outboxEvent.ID, ": ", err.Error())
+		} else {
+			// id строки outbox служит id события в SSE
+			event.ID = outboxEvent.ID
+			event.Key = outboxEvent.Key
+			err := r.expandTeams(ctx, event)
+			if err == nil {
+				err = r.publisher.Publish(ctx, event)
+			}
+			if err != nil {
+				r.failures++
+				delay := r.backoff()
+				r.retryAt = time.Now().Add(delay)
+				r.logger.Error("outbox: event ", outboxEvent.ID, ": ", err.Error(), ", retry in ", delay)
+				span.SetStatus(codes.Error, err.Error())
+				return false
+			}
+			r.failures = 0
+		}
+
+		if err := r.repo.MarkDelivered(ctx, outboxEvent.ID); err != nil {
+			r.logger.Error("outbox: ", err.Error())
+			span.SetStatus(codes.Error, err.Error())
+			return false
+		}
+	}
+	return true
+}
+
+// состав команд берется на момент отправки: в outbox его не записать в той же транзакции
+func (r *OutboxRelay) expandTeams(ctx context.Context, event *TaskEvent) error {
+	names := slices.Clone(event.Task.Teams)
+	if event.Team != "" && !slices.Contains(names, event.Team) {
+		names = append(names, event.Team)
+	}
+	event.TeamMembers = map[string][]string{}
+	for _, name := range names {
+		team, err := r.teams.GetTeam(ctx, name)
+		if err == ErrNoTeam {
+			continue
+		} else if err != nil {
+			return err
+		}
+		event.TeamMembers[name] = team.Members
+	}
+	return nil
+}
+
+// PollInterval * 2^(failures-1), не больше MaxBackoff
+func (r *OutboxRelay) backoff() time.Duration {
+	d := r.cfg.PollInterval
+	for i := 1; i < r.failures && d < r.cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, r.cfg.MaxBackoff)
+}
@@ -0,0 +1,37 @@
+package service
+
+import (
+	"context"
+	"testing"
+)
+
+func TestEventVisibleToTeamMembers(t *testing.T) {
+	relay := &OutboxRelay{teams: &fakeTeamsStorage{teams: map[string]*Team{
+		"backend":  {Name: "backend", Owner: "bob", Members: []string{"bob", "erin"}},
+		"frontend": {Name: "frontend", Owner: "frank", Members: []string{"frank"}},
+	}}}
+	task := &Task{ID: 1, Owner: "alice", Teams: []string{"backend", "deleted"}, Watchers: []string{"walter"}}
+	tests := []struct {
+		name     string
+		event    *TaskEvent
+		username string
+		want     bool
+	}{
+		{"owner", &TaskEvent{Task: task}, "alice", true},
+		{"watcher", &TaskEvent{Task: task}, "walter", true},
+		{"member of a task team", &TaskEvent{Task: task}, "erin", true},
+		{"member of an unassigned team", &TaskEvent{Task: task, Team: "frontend"}, "frank", true},
+		{"member of another team", &TaskEvent{Task: task}, "frank", false},
+		{"stranger", &TaskEvent{Task: task}, "mallory", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := relay.expandTeams(context.Background(), tt.event); err != nil {
+				t.Fatal(err)
+			}
+			if got := tt.event.VisibleTo(tt.username); got != tt.want {
+				t.Errorf("VisibleTo(%s) = %v, want %v", tt.username, got, tt.want)
+			}
+		})
+	}
+}
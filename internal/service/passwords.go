@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/mail"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+var (
+	ErrBadResetToken = errors.New("password reset link is invalid or expired")
+	ErrExternalUser  = errors.New("password is managed by the external login provider")
+)
+
+// первая строка - тема письма, остальное - текст
+var passwordResetTemplate = template.Must(template.New("reset").Parse(`Password reset
+Hi {{.To}},
+
+Someone requested a password reset for your account. To set a new password, open:
+
+{{.Link}}
+
+The link is valid for {{.TTL}} and can be used once. If it wasn't you, ignore this email.
+`))
+
+// сколько ждать отправки письма со ссылкой для сброса
+const resetMailTimeout = 30 * time.Second
+
+// возвращает ErrIncorrectPassword если старый пароль неверный, *ValidationError если новый не подходит под политику.
+// Завершать другие сессии пользователя должен вызывающий
+func (s *UsersService) ChangePassword(ctx context.Context, username, oldPassword, newPassword string) error {
+	user, err := s.repo.GetUser(ctx, username)
+	if err != nil {
+		return err
+	}
+	if user.Provider != "" {
+		return ErrExternalUser
+	}
+	if subtle.ConstantTimeCompare([]byte(oldPassword), []byte(user.Password)) != 1 {
+		return ErrIncorrectPassword
+	}
+	if err := s.validateNewPassword(username, newPassword); err != nil {
+		return err
+	}
+	return s.repo.SetPassword(ctx, username, newPassword)
+}
+
+// отправляет на почту пользователя одноразовую ссылку для сброса пароля.
+// Отсутствие пользователя или почты не считается ошибкой, чтобы по ответу нельзя было перебирать логины.
+// Письмо отправляется в фоне: по времени ответа тоже не должно быть видно, есть ли пользователь
+func (s *UsersService) RequestPasswordReset(ctx context.Context, username string) error {
+	user, err := s.findUser(ctx, username)
+	if err == ErrNoUser {
+		s.logger.Info("password reset for unknown user: ", username)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if user.Email == "" || user.Provider != "" {
+		s.logger.Info("password reset is not possible for user: ", username)
+		return nil
+	}
+
+	token, err := randomString(32)
+	if err != nil {
+		return err
+	}
+	reset := &PasswordReset{
+		Hash:      hashToken(token),
+		ExpiresAt: time.Now().Add(s.resetCfg.TTL),
+	}
+	username = user.UserName
+	if err := s.repo.SetPasswordReset(ctx, username, reset); err != nil {
+		return err
+	}
+
+	var buf strings.Builder
+	err = passwordResetTemplate.Execute(&buf, map[string]interface{}{
+		"To":   username,
+		"Link": s.resetCfg.URL + "?token=" + url.QueryEscape(token),
+		"TTL":  s.resetCfg.TTL,
+	})
+	if err != nil {
+		return err
+	}
+	subject, body, _ := strings.Cut(buf.String(), "\n")
+	// в очередь письмо не ставится, чтобы токен не хранился в открытом виде
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), resetMailTimeout)
+		defer cancel()
+		if err := s.notifier.Send(ctx, user.Email, subject, body); err != nil {
+			s.logger.Error("password reset mail for ", username, ": ", err.Error())
+		}
+	}()
+	return nil
+}
+
+// задает новый пароль по токену из письма и возвращает имя пользователя.
+// Завершать сессии пользователя должен вызывающий
+func (s *UsersService) ResetPassword(ctx context.Context, token, newPassword string) (string, error) {
+	if token == "" {
+		return "", ErrBadResetToken
+	}
+	// логин до проверки токена неизвестен, совпадение пароля с логином здесь не проверяется
+	if err := s.validateNewPassword("", newPassword); err != nil {
+		return "", err
+	}
+	return s.repo.ResetPassword(ctx, hashToken(token), newPassword, time.Now())
+}
+
+func (s *UsersService) GetProfile(ctx context.Context, username string) (*Profile, error) {
+	user, err := s.repo.GetUser(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	return profileOf(user), nil
+}
+
+// возвращает ErrBadEmail если адрес указан неверно. На почту приходят ссылки для сброса пароля,
+// поэтому для ее смены нужен пароль: иначе ErrIncorrectPassword. Почту пользователя внешнего
+// провайдера обновляет провайдер при каждом входе, ее смена возвращает ErrExternalUser
+func (s *UsersService) UpdateProfile(ctx context.Context, username, displayName, email, password string) (*Profile, error) {
+	if email != "" {
+		addr, err := mail.ParseAddress(email)
+		if err != nil {
+			return nil, ErrBadEmail
+		}
+		email = addr.Address
+	}
+	user, err := s.repo.GetUser(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if email != user.Email {
+		if user.Provider != "" {
+			return nil, ErrExternalUser
+		}
+		if subtle.ConstantTimeCompare([]byte(password), []byte(user.Password)) != 1 {
+			return nil, ErrIncorrectPassword
+		}
+	}
+	displayName = strings.TrimSpace(displayName)
+	if err := s.repo.UpdateProfile(ctx, username, displayName, email); err != nil {
+		return nil, err
+	}
+	return s.GetProfile(ctx, username)
+}
+
+func profileOf(user *User) *Profile {
+	roles := user.Roles
+	if roles == nil {
+		roles = []string{}
+	}
+	return &Profile{
+		UserName:    user.UserName,
+		DisplayName: user.DisplayName,
+		Email:       user.Email,
+		Roles:       roles,
+	}
+}
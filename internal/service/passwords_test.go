@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/config"
+	"go.uber.org/zap"
+)
+
+func (f *fakeUsersStorage) SetPasswordReset(ctx context.Context, username string, reset *PasswordReset) error {
+	user, ok := f.users[username]
+	if !ok {
+		return ErrNoUser
+	}
+	user.PasswordReset = reset
+	return nil
+}
+
+func (f *fakeUsersStorage) ResetPassword(ctx context.Context, hash, password string, now time.Time) (string, error) {
+	for _, user := range f.users {
+		if user.PasswordReset != nil && user.PasswordReset.Hash == hash && user.PasswordReset.ExpiresAt.After(now) {
+			user.Password = password
+			user.PasswordReset = nil
+			return user.UserName, nil
+		}
+	}
+	return "", ErrBadResetToken
+}
+
+func (f *fakeUsersStorage) UpdateProfile(ctx context.Context, username, displayName, email string) error {
+	user, ok := f.users[username]
+	if !ok {
+		return ErrNoUser
+	}
+	user.DisplayName = displayName
+	user.Email = email
+	return nil
+}
+
+type sentMail struct {
+	to, subject, body string
+}
+
+// передает письма в канал, чтобы тест дождался фоновой отправки
+type chanNotifier struct {
+	mails chan sentMail
+}
+
+func (n *chanNotifier) Send(ctx context.Context, to, subject, body string) error {
+	n.mails <- sentMail{to, subject, body}
+	return nil
+}
+
+// блокирует отправку до закрытия release
+type slowNotifier struct {
+	release chan struct{}
+}
+
+func (n *slowNotifier) Send(ctx context.Context, to, subject, body string) error {
+	<-n.release
+	return nil
+}
+
+const testResetURL = "http://localhost:8080/password/reset"
+
+var resetLink = regexp.MustCompile(regexp.QuoteMeta(testResetURL) + `\?token=(\S+)`)
+
+func newTestPasswordsService(notifier Notifier) (*UsersService, *fakeUsersStorage) {
+	repo := &fakeUsersStorage{users: map[string]*User{
+		"alice":   {UserName: "alice", Password: "Old-password1", Email: "alice@example.com"},
+		"noemail": {UserName: "noemail", Password: "Old-password1"},
+		"sso":     {UserName: "sso", Email: "sso@example.com", Provider: "oidc"},
+	}}
+	policy := &config.PasswordPolicy{MinLength: 8, MaxLength: 128, RequireUpper: true, RequireLower: true, RequireDigit: true}
+	reset := &config.PasswordReset{TTL: time.Hour, URL: testResetURL}
+	return NewUsersService(repo, notifier, policy, reset, zap.NewNop().Sugar()), repo
+}
+
+// запрашивает сброс для alice и возвращает токен из письма
+func requestReset(t *testing.T, s *UsersService, mails <-chan sentMail) string {
+	t.Helper()
+	if err := s.RequestPasswordReset(context.Background(), "alice"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case mail := <-mails:
+		if mail.to != "alice@example.com" {
+			t.Fatalf("reset mail sent to %s", mail.to)
+		}
+		m := resetLink.FindStringSubmatch(mail.body)
+		if m == nil {
+			t.Fatalf("no reset link in mail:\n%s", mail.body)
+		}
+		token, err := url.QueryUnescape(m[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	case <-time.After(5 * time.Second):
+		t.Fatal("reset mail was not sent")
+	}
+	return ""
+}
+
+func TestResetPassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    func(token string) string
+		password string
+		// сброс истекает перед попыткой
+		expire  bool
+		wantErr error
+	}{
+		{"valid token", func(token string) string { return token }, "New-password1", false, nil},
+		{"empty token", func(string) string { return "" }, "New-password1", false, ErrBadResetToken},
+		{"wrong token", func(token string) string { return token + "x" }, "New-password1", false, ErrBadResetToken},
+		{"expired token", func(token string) string { return token }, "New-password1", true, ErrBadResetToken},
+		{"weak password", func(token string) string { return token }, "short", false, &ValidationError{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notifier := &chanNotifier{mails: make(chan sentMail, 1)}
+			s, repo := newTestPasswordsService(notifier)
+			token := requestReset(t, s, notifier.mails)
+			if repo.users["alice"].PasswordReset.Hash == token {
+				t.Fatal("reset token stored in plain text")
+			}
+			if tt.expire {
+				repo.users["alice"].PasswordReset.ExpiresAt = time.Now().Add(-time.Second)
+			}
+
+			username, err := s.ResetPassword(context.Background(), tt.token(token), tt.password)
+			var invalid *ValidationError
+			if _, wantInvalid := tt.wantErr.(*ValidationError); wantInvalid {
+				if !errors.As(err, &invalid) {
+					t.Fatalf("got %v, want validation error", err)
+				}
+			} else if err != tt.wantErr {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				if repo.users["alice"].Password != "Old-password1" {
+					t.Error("password changed")
+				}
+				return
+			}
+			if username != "alice" || repo.users["alice"].Password != tt.password {
+				t.Errorf("password of %q not changed", username)
+			}
+			// ссылка одноразовая
+			if _, err := s.ResetPassword(context.Background(), token, "Other-password1"); err != ErrBadResetToken {
+				t.Errorf("second use: %v", err)
+			}
+		})
+	}
+}
+
+func TestRequestPasswordResetSilent(t *testing.T) {
+	for _, username := range []string{"nobody", "noemail", "sso"} {
+		t.Run(username, func(t *testing.T) {
+			notifier := &chanNotifier{mails: make(chan sentMail, 1)}
+			s, _ := newTestPasswordsService(notifier)
+			if err := s.RequestPasswordReset(context.Background(), username); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case mail := <-notifier.mails:
+				t.Errorf("mail sent to %s", mail.to)
+			case <-time.After(50 * time.Millisecond):
+			}
+		})
+	}
+}
+
+func TestRequestPasswordResetDoesNotWaitForMail(t *testing.T) {
+	notifier := &slowNotifier{release: make(chan struct{})}
+	defer close(notifier.release)
+	s, _ := newTestPasswordsService(notifier)
+
+	done := make(chan error, 1)
+	go func() { done <- s.RequestPasswordReset(context.Background(), "alice") }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("request waits for the mail server")
+	}
+}
+
+func TestUpdateProfileEmail(t *testing.T) {
+	tests := []struct {
+		name      string
+		username  string
+		email     string
+		password  string
+		wantErr   error
+		wantEmail string
+	}{
+		{"same email without password", "alice", "alice@example.com", "", nil, "alice@example.com"},
+		{"new email with password", "alice", "Alice <alice@new.example.com>", "Old-password1", nil, "alice@new.example.com"},
+		{"new email without password", "alice", "alice@new.example.com", "", ErrIncorrectPassword, "alice@example.com"},
+		{"new email with wrong password", "alice", "alice@new.example.com", "wrong", ErrIncorrectPassword, "alice@example.com"},
+		{"remove email without password", "alice", "", "", ErrIncorrectPassword, "alice@example.com"},
+		{"bad email", "alice", "not an email", "Old-password1", ErrBadEmail, "alice@example.com"},
+		{"external user", "sso", "sso@new.example.com", "", ErrExternalUser, "sso@example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, repo := newTestPasswordsService(&chanNotifier{mails: make(chan sentMail, 1)})
+			_, err := s.UpdateProfile(context.Background(), tt.username, "Name", tt.email, tt.password)
+			if err != tt.wantErr {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if got := repo.users[tt.username].Email; got != tt.wantEmail {
+				t.Errorf("email %q, want %q", got, tt.wantEmail)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/config"
+	"go.uber.org/zap"
+)
+
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// группы запросов с отдельными ограничениями
+const (
+	LimitAuth  = "auth"
+	LimitTasks = "tasks"
+)
+
+const rateLimitKeyPrefix = "rate:"
+
+type RateLimitStorage interface {
+	// забирает токен из корзины key емкостью burst, которая пополняется на rate токенов в секунду.
+	// Возвращает, удалось ли забрать токен, и сколько токенов осталось
+	Take(ctx context.Context, key string, rate float64, burst int) (bool, float64, error)
+}
+
+// результат проверки для заголовков X-RateLimit-*
+type RateLimitResult struct {
+	Allowed bool
+	// размер корзины
+	Limit     int
+	Remaining int
+	// через сколько появится следующий токен, если запрос не разрешен
+	RetryAfter time.Duration
+	// через сколько корзина наполнится полностью
+	Reset time.Duration
+}
+
+type rateLimit struct {
+	rate  float64
+	burst int
+}
+
+// RateLimiter ограничивает частоту запросов по группам. Как и LoginGuard, при недоступности
+// основного хранилища использует запасное в памяти процесса
+type RateLimiter struct {
+	repo     RateLimitStorage
+	fallback RateLimitStorage
+	limits   map[string]rateLimit
+	logger   *zap.SugaredLogger
+}
+
+func NewRateLimiter(repo, fallback RateLimitStorage, cfg *config.RateLimit, logger *zap.SugaredLogger) *RateLimiter {
+	return &RateLimiter{
+		repo:     repo,
+		fallback: fallback,
+		limits: map[string]rateLimit{
+			LimitAuth:  {rate: cfg.AuthRate, burst: cfg.AuthBurst},
+			LimitTasks: {rate: cfg.TasksRate, burst: cfg.TasksBurst},
+		},
+		logger: logger,
+	}
+}
+
+// забирает токен для key в группе limit. Для группы без ограничения возвращает nil
+func (l *RateLimiter) Allow(ctx context.Context, limit, key string) (*RateLimitResult, error) {
+	lim, ok := l.limits[limit]
+	if !ok || lim.rate <= 0 || lim.burst <= 0 {
+		return nil, nil
+	}
+
+	key = rateLimitKeyPrefix + limit + ":" + key
+	allowed, tokens, err := l.repo.Take(ctx, key, lim.rate, lim.burst)
+	if err != nil {
+		l.logger.Warn("rate limit storage error, using fallback: ", err)
+		allowed, tokens, err = l.fallback.Take(ctx, key, lim.rate, lim.burst)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	res := &RateLimitResult{
+		Allowed:   allowed,
+		Limit:     lim.burst,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     secondsDuration((float64(lim.burst) - tokens) / lim.rate),
+	}
+	if !allowed {
+		res.RetryAfter = secondsDuration((1 - tokens) / lim.rate)
+	}
+	return res, nil
+}
+
+func secondsDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/config"
+	"github.com/RusGadzhiev/TaskManager/internal/storage/rateLimitStorage/memory"
+	"go.uber.org/zap"
+)
+
+// хранилище, которое всегда недоступно
+type brokenRateLimitStorage struct{}
+
+func (brokenRateLimitStorage) Take(ctx context.Context, key string, rate float64, burst int) (bool, float64, error) {
+	return false, 0, errors.New("connection refused")
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	cfg := &config.RateLimit{AuthRate: 0.5, AuthBurst: 2, TasksRate: 0}
+	tests := []struct {
+		name     string
+		repo     RateLimitStorage
+		limit    string
+		requests int
+		// результат последнего запроса, nil если ограничения нет
+		want *RateLimitResult
+	}{
+		{"within burst", memory.NewRateLimitRepoMemory(), LimitAuth, 1, &RateLimitResult{Allowed: true, Limit: 2, Remaining: 1, Reset: 2 * time.Second}},
+		{"burst exhausted", memory.NewRateLimitRepoMemory(), LimitAuth, 3, &RateLimitResult{Allowed: false, Limit: 2, Remaining: 0, RetryAfter: 2 * time.Second, Reset: 4 * time.Second}},
+		{"storage down uses fallback", brokenRateLimitStorage{}, LimitAuth, 3, &RateLimitResult{Allowed: false, Limit: 2, Remaining: 0, RetryAfter: 2 * time.Second, Reset: 4 * time.Second}},
+		{"limit turned off", memory.NewRateLimitRepoMemory(), LimitTasks, 100, nil},
+		{"unknown limit", memory.NewRateLimitRepoMemory(), "other", 1, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewRateLimiter(tt.repo, memory.NewRateLimitRepoMemory(), cfg, zap.NewNop().Sugar())
+			var res *RateLimitResult
+			for range tt.requests {
+				var err error
+				if res, err = l.Allow(context.Background(), tt.limit, "ip:203.0.113.7"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if (res == nil) != (tt.want == nil) {
+				t.Fatalf("got %+v, want %+v", res, tt.want)
+			}
+			if res == nil {
+				return
+			}
+			// за время теста корзина немного пополняется
+			if res.Allowed != tt.want.Allowed || res.Limit != tt.want.Limit || res.Remaining != tt.want.Remaining ||
+				!near(res.RetryAfter, tt.want.RetryAfter) || !near(res.Reset, tt.want.Reset) {
+				t.Errorf("got %+v, want %+v", res, tt.want)
+			}
+		})
+	}
+}
+
+func near(got, want time.Duration) bool {
+	return got <= want && got > want-100*time.Millisecond
+}
@@ -3,13 +3,15 @@ package service
 import (
 	"context"
 	"errors"
-	"math/rand"
 	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/config"
 )
 
 var (
 	ErrNoUserBySession = errors.New("no user by session")
-	letterRunes        = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
+	ErrNoSession       = errors.New("no such session")
+	ErrBadCSRFToken    = errors.New("invalid CSRF token")
 )
 
 type SessionsStorage interface {
@@ -19,44 +21,365 @@ type SessionsStorage interface {
 	Add(ctx context.Context, cookieVal string, username string, dur time.Duration) error
 	// удаляет cookie
 	Delete(ctx context.Context, cookieVal string) error
+	// удаляет cookie и возвращает username, из одновременных вызовов username получает только один.
+	// Возвращает ошибку service.ErrNoUserBySession если сессии нет
+	Take(ctx context.Context, cookieVal string) (string, error)
+	// сохраняет сведения о сессии и добавляет ее в список сессий пользователя
+	AddSessionInfo(ctx context.Context, info *SessionInfo, dur time.Duration) error
+	// возвращает ошибку service.ErrNoSession если сессии нет
+	GetSessionInfo(ctx context.Context, id string) (*SessionInfo, error)
+	// возвращает живые сессии пользователя, истекшие убираются из списка
+	GetSessionInfos(ctx context.Context, username string) ([]*SessionInfo, error)
+	// продлевает сессию до dur
+	Expire(ctx context.Context, cookieVal string, dur time.Duration) error
+	// обновляет время последней активности и продлевает сведения о сессии до dur, если сессия еще есть
+	TouchSessionInfo(ctx context.Context, username, id string, lastSeen time.Time, dur time.Duration) error
+	DeleteSessionInfo(ctx context.Context, username, id string) error
+	// возвращает токен CSRF сессии id, если токена еще нет - сохраняет newToken.
+	// Возвращает ошибку service.ErrNoSession если сессии нет
+	CSRFToken(ctx context.Context, id, newToken string) (string, error)
 }
 
+// SessionsService работает в одном из режимов:
+// redis - значение куки является ключом сессии в хранилище и проверяется при каждом запросе;
+// jwt - кука содержит подписанный короткоживущий access токен, который проверяется без хранилища,
+// а в хранилище лежат только refresh токены для его обновления
 type SessionsService struct {
 	repo SessionsStorage
+	jwt  *jwtIssuer
+	cfg  *config.Sessions
 }
 
-func NewSessionsService(repo SessionsStorage) *SessionsService {
-	return &SessionsService{
+// не чаще этого продлевается сессия при активности
+const sessionTouchInterval = time.Minute
+
+const sessionKeyPrefix = "session:"
+
+// ключ сессии в хранилище: значение куки хранится только в виде хэша
+func SessionKey(cookieVal string) string {
+	return sessionKeyPrefix + hashToken(cookieVal)
+}
+
+func NewSessionsService(repo SessionsStorage, cfg *config.Sessions) (*SessionsService, error) {
+	s := &SessionsService{
 		repo: repo,
+		cfg:  cfg,
+	}
+	if cfg.Mode == config.SessionsModeJWT {
+		issuer, err := newJWTIssuer(&cfg.JWT)
+		if err != nil {
+			return nil, err
+		}
+		s.jwt = issuer
 	}
+	return s, nil
 }
 
 func (s *SessionsService) DeleteCookie(ctx context.Context, cookieVal string) error {
-	return s.repo.Delete(ctx, cookieVal)
+	id, err := s.sessionID(cookieVal)
+	if err != nil {
+		return err
+	}
+	info, err := s.repo.GetSessionInfo(ctx, id)
+	if err == ErrNoSession && s.jwt == nil {
+		// сессия, созданная до появления сведений о сессиях, хранилась по значению куки.
+		// Такие сессии больше не принимаются, но до истечения лежат в хранилище
+		return s.repo.Delete(ctx, cookieVal)
+	} else if err == ErrNoSession {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return s.revoke(ctx, info)
 }
 
-func (s *SessionsService) AddCookie(ctx context.Context, username string) (*Session, error) {
-	cookieVal := randStringChars(32)
-	dur := 72 * time.Hour
-	err := s.repo.Add(ctx, cookieVal, username, dur)
+// remember выбирает срок жизни RememberTTL вместо TTL и постоянные куки
+func (s *SessionsService) AddCookie(ctx context.Context, username string, client ClientInfo, remember bool) (*Session, error) {
+	now := time.Now()
+	info := &SessionInfo{
+		UserName:  username,
+		CreatedAt: now,
+		LastSeen:  now,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Remember:  remember,
+	}
+	if s.jwt != nil {
+		return s.issueJWT(ctx, info)
+	}
+
+	cookieVal, err := randomString(32)
 	if err != nil {
 		return nil, err
 	}
+	dur := s.ttl(info)
+	err = s.repo.Add(ctx, SessionKey(cookieVal), username, dur)
+	if err != nil {
+		return nil, err
+	}
+	info.ID = hashToken(cookieVal)
+	info.Key = SessionKey(cookieVal)
+	if err := s.repo.AddSessionInfo(ctx, info, dur); err != nil {
+		return nil, err
+	}
 	session := &Session{
 		CookieVal: cookieVal,
 		Dur:       dur,
+		Remember:  remember,
 	}
 	return session, nil
 }
 
 func (s *SessionsService) GetUserByCookie(ctx context.Context, cookieVal string) (string, error) {
-	return s.repo.GetUser(ctx, cookieVal)
+	if s.jwt != nil {
+		claims, err := s.jwt.verify(cookieVal)
+		if err != nil {
+			return "", ErrNoUserBySession
+		}
+		return claims.Subject, nil
+	}
+	return s.repo.GetUser(ctx, SessionKey(cookieVal))
 }
 
-func randStringChars(n int) string {
-	b := make([]rune, n)
-	for i := range b {
-		b[i] = letterRunes[rand.Intn(len(letterRunes))]
+// продлевает сессию при активности: срок отсчитывается заново, но не дальше MaxLifetime от входа.
+// Возвращает продленную сессию или nil, если продлевать пока не нужно.
+// В режиме jwt сессия продлевается при обновлении токенов, здесь ничего не делается
+func (s *SessionsService) TouchCookie(ctx context.Context, cookieVal string) (*Session, error) {
+	if s.jwt != nil {
+		return nil, nil
+	}
+	info, err := s.repo.GetSessionInfo(ctx, hashToken(cookieVal))
+	if err == ErrNoSession {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if now.Sub(info.LastSeen) < sessionTouchInterval {
+		return nil, nil
+	}
+	dur := s.ttl(info)
+	if dur <= 0 {
+		if err := s.revoke(ctx, info); err != nil {
+			return nil, err
+		}
+		return nil, ErrNoUserBySession
+	}
+	if err := s.repo.Expire(ctx, info.Key, dur); err != nil {
+		return nil, err
+	}
+	if err := s.repo.TouchSessionInfo(ctx, info.UserName, info.ID, now, dur); err != nil {
+		return nil, err
+	}
+	return &Session{
+		CookieVal: cookieVal,
+		Dur:       dur,
+		Remember:  info.Remember,
+	}, nil
+}
+
+// сколько осталось жить сессии после активности сейчас
+func (s *SessionsService) ttl(info *SessionInfo) time.Duration {
+	ttl := s.cfg.TTL
+	if info.Remember {
+		ttl = s.cfg.RememberTTL
+	}
+	return min(ttl, time.Until(info.CreatedAt.Add(s.cfg.MaxLifetime)))
+}
+
+// по refresh токену выдает новую пару токенов, старый refresh токен становится недействительным.
+// В режиме redis обновление не поддерживается и всегда возвращается ErrNoUserBySession
+func (s *SessionsService) RefreshCookie(ctx context.Context, refreshVal string) (*Session, error) {
+	if s.jwt == nil || refreshVal == "" {
+		return nil, ErrNoUserBySession
+	}
+
+	info, err := s.repo.GetSessionInfo(ctx, refreshKey(refreshVal))
+	if err == ErrNoSession {
+		return nil, ErrNoUserBySession
+	} else if err != nil {
+		return nil, err
+	}
+	// при одновременном обновлении одним токеном новую пару получает только один запрос
+	if _, err := s.repo.Take(ctx, info.Key); err != nil {
+		return nil, err
+	}
+	if err := s.repo.DeleteSessionInfo(ctx, info.UserName, info.ID); err != nil {
+		return nil, err
+	}
+	// сессия получает новый id, но сохраняет время и место входа
+	info.LastSeen = time.Now()
+	return s.issueJWT(ctx, info)
+}
+
+// завершает сессию по refresh токену, например при выходе с уже истекшим access токеном
+func (s *SessionsService) RevokeRefresh(ctx context.Context, refreshVal string) error {
+	if s.jwt == nil || refreshVal == "" {
+		return nil
+	}
+	info, err := s.repo.GetSessionInfo(ctx, refreshKey(refreshVal))
+	if err == ErrNoSession {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return s.revoke(ctx, info)
+}
+
+// возвращает токен CSRF сессии, при первом обращении создает его.
+// Токен хранится в сведениях о сессии и в режиме jwt переходит к сессии при обновлении токенов.
+// Возвращает ErrNoUserBySession если сессии нет, в том числе для сессий, созданных до появления сведений о сессиях
+func (s *SessionsService) CSRFToken(ctx context.Context, cookieVal string) (string, error) {
+	id, err := s.sessionID(cookieVal)
+	if err != nil {
+		return "", err
+	}
+	newToken, err := randomString(32)
+	if err != nil {
+		return "", err
+	}
+	token, err := s.repo.CSRFToken(ctx, id, newToken)
+	if err == ErrNoSession {
+		return "", ErrNoUserBySession
+	}
+	return token, err
+}
+
+// возвращает сессии пользователя, текущая отмечена по значению куки currentCookie
+func (s *SessionsService) GetSessions(ctx context.Context, username, currentCookie string) ([]*SessionInfo, error) {
+	sessions, err := s.repo.GetSessionInfos(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	current, _ := s.sessionID(currentCookie)
+	for _, info := range sessions {
+		info.Current = info.ID == current
+	}
+	return sessions, nil
+}
+
+// возвращает ErrNoSession если у пользователя нет такой сессии
+func (s *SessionsService) RevokeSession(ctx context.Context, username, id string) error {
+	info, err := s.repo.GetSessionInfo(ctx, id)
+	if err != nil {
+		return err
+	}
+	if info.UserName != username {
+		return ErrNoSession
+	}
+	return s.revoke(ctx, info)
+}
+
+// завершает все сессии пользователя, кроме текущей
+func (s *SessionsService) RevokeOtherSessions(ctx context.Context, username, currentCookie string) error {
+	current, _ := s.sessionID(currentCookie)
+	return s.revokeSessions(ctx, username, current)
+}
+
+// завершает все сессии пользователя, например после смены пароля.
+// В режиме jwt уже выданные access токены действуют до истечения
+func (s *SessionsService) RevokeAllSessions(ctx context.Context, username string) error {
+	return s.revokeSessions(ctx, username, "")
+}
+
+func (s *SessionsService) revokeSessions(ctx context.Context, username, keep string) error {
+	sessions, err := s.repo.GetSessionInfos(ctx, username)
+	if err != nil {
+		return err
+	}
+	for _, info := range sessions {
+		if info.ID == keep {
+			continue
+		}
+		if err := s.revoke(ctx, info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SessionsService) revoke(ctx context.Context, info *SessionInfo) error {
+	if err := s.repo.Delete(ctx, info.Key); err != nil {
+		return err
+	}
+	return s.repo.DeleteSessionInfo(ctx, info.UserName, info.ID)
+}
+
+// id сессии: в режиме redis хэш значения куки, в режиме jwt хэш refresh токена из claim sid
+func (s *SessionsService) sessionID(cookieVal string) (string, error) {
+	if s.jwt != nil {
+		// подпись проверяется без срока действия: выйти можно и с истекшим access токеном
+		claims, err := s.jwt.verifySignature(cookieVal)
+		if err != nil {
+			return "", ErrNoUserBySession
+		}
+		return claims.SessionID, nil
+	}
+	return hashToken(cookieVal), nil
+}
+
+// refresh токен живет TTL сессии, поэтому каждое обновление продлевает сессию
+func (s *SessionsService) issueJWT(ctx context.Context, info *SessionInfo) (*Session, error) {
+	dur := s.ttl(info)
+	if dur <= 0 {
+		return nil, ErrNoUserBySession
+	}
+	refreshVal, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+	sessionID := refreshKey(refreshVal)
+	if err := s.repo.Add(ctx, refreshKeyPrefix+sessionID, info.UserName, dur); err != nil {
+		return nil, err
+	}
+	info.ID = sessionID
+	info.Key = refreshKeyPrefix + sessionID
+	if err := s.repo.AddSessionInfo(ctx, info, dur); err != nil {
+		return nil, err
+	}
+
+	access, err := s.jwt.issue(info.UserName, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{
+		CookieVal:  access,
+		Dur:        s.jwt.accessTTL,
+		RefreshVal: refreshVal,
+		RefreshDur: dur,
+		Remember:   info.Remember,
+	}, nil
+}
+
+// префикс ключей незавершенных входов, ожидающих второй фактор
+const (
+	twoFactorKeyPrefix = "2fa:"
+	twoFactorTTL       = 5 * time.Minute
+)
+
+// запоминает пользователя, прошедшего проверку пароля, до ввода кода 2FA
+func (s *SessionsService) AddTwoFactorChallenge(ctx context.Context, username string) (string, error) {
+	challenge, err := randomString(32)
+	if err != nil {
+		return "", err
+	}
+	if err := s.repo.Add(ctx, twoFactorKeyPrefix+hashToken(challenge), username, twoFactorTTL); err != nil {
+		return "", err
+	}
+	return challenge, nil
+}
+
+// возвращает пользователя по незавершенному входу и удаляет его: после неверного кода
+// нужно снова ввести пароль. Возвращает ErrNoUserBySession если вход истек
+func (s *SessionsService) TakeTwoFactorChallenge(ctx context.Context, challenge string) (string, error) {
+	key := twoFactorKeyPrefix + hashToken(challenge)
+	username, err := s.repo.GetUser(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	if err := s.repo.Delete(ctx, key); err != nil {
+		return "", err
 	}
-	return string(b)
+	return username, nil
 }
@@ -3,30 +3,81 @@ package service
 import (
 	"context"
 	"errors"
+	"slices"
 )
 
 var (
-	ErrBadId = errors.New("bad id")
+	ErrBadId     = errors.New("bad id")
+	ErrNoTask    = errors.New("no such task")
+	ErrNotOwner  = errors.New("only the task owner can do this")
+	ErrBadStatus = errors.New("unknown task status")
+	// изменять ход задачи могут владелец и исполнители
+	ErrNotParticipant = errors.New("only the task owner or executors can do this")
 )
 
 type TasksStorage interface {
 	GetAllTasks(ctx context.Context) ([]*Task, error)
 	GetCreatedTasks(ctx context.Context, username string) ([]*Task, error)
-	GetMyTasks(ctx context.Context, username string) ([]*Task, error)
+	// задачи, где пользователь исполнитель или назначена одна из его команд teams
+	GetMyTasks(ctx context.Context, username string, teams []string) ([]*Task, error)
+	// возвращает ошибку service.ErrNoTask если задачи нет
+	GetTask(ctx context.Context, taskId uint64) (*Task, error)
+	// Add, Assign, Unassign, AssignTeam, UnassignTeam, Claim, Complete и SetStatus записывают событие в outbox в той же транзакции
 	// возвращает id вставленной задачи
 	Add(ctx context.Context, task *Task) (uint64, error)
+	// добавляет исполнителя задачи, уже назначенные исполнители сохраняются
 	Assign(ctx context.Context, taskId uint64, username string) error
-	Unassign(ctx context.Context, taskId uint64) error
+	// убирает одного исполнителя задачи
+	Unassign(ctx context.Context, taskId uint64, username string) error
+	AssignTeam(ctx context.Context, taskId uint64, team string) error
+	UnassignTeam(ctx context.Context, taskId uint64, team string) error
+	// снимает с задачи команду и назначает исполнителем username,
+	// возвращает ошибку service.ErrNoTeamTask если команда уже снята
+	Claim(ctx context.Context, taskId uint64, team, username string) error
+	// также переводит задачу в статус done
 	Complete(ctx context.Context, taskId uint64) error
+	SetStatus(ctx context.Context, taskId uint64, status string) error
+	Watch(ctx context.Context, taskId uint64, username string) error
+	Unwatch(ctx context.Context, taskId uint64, username string) error
 }
 
+// получатель событий об изменении задач. Событие может прийти повторно,
+// если раньше его не принял другой получатель, поэтому повтор с тем же Key нужно пропускать
+type EventPublisher interface {
+	Publish(ctx context.Context, event *TaskEvent) error
+}
+
+type actorCtxKey struct{}
+
+// запоминает в ctx пользователя, от имени которого выполняется запрос,
+// хранилище записывает его в события задач
+func WithActor(ctx context.Context, username string) context.Context {
+	return context.WithValue(ctx, actorCtxKey{}, username)
+}
+
+func ActorFrom(ctx context.Context) string {
+	username, _ := ctx.Value(actorCtxKey{}).(string)
+	return username
+}
+
+// сообщает о появлении новых событий в outbox
+type OutboxNotifier interface {
+	Notify()
+}
+
+// События об изменениях пишет в outbox само хранилище в той же транзакции,
+// TasksService только будит relay после успешной записи
 type TasksService struct {
-	repo TasksStorage
+	repo   TasksStorage
+	teams  TeamsStorage
+	outbox OutboxNotifier
 }
 
-func NewTasksService(repo TasksStorage) *TasksService {
+func NewTasksService(repo TasksStorage, teams TeamsStorage, outbox OutboxNotifier) *TasksService {
 	return &TasksService{
-		repo: repo,
+		repo:   repo,
+		teams:  teams,
+		outbox: outbox,
 	}
 }
 
@@ -40,27 +91,175 @@ func (s *TasksService) GetCreatedTasks(ctx context.Context, username string) ([]
 	return tasks, err
 }
 
+// включает задачи команд, в которых состоит пользователь
 func (s *TasksService) GetMyTasks(ctx context.Context, username string) ([]*Task, error) {
-	tasks, err := s.repo.GetMyTasks(ctx, username)
+	teams, err := s.teams.GetUserTeams(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := s.repo.GetMyTasks(ctx, username, teams)
 	return tasks, err
 }
 
+func (s *TasksService) GetTask(ctx context.Context, taskId uint64) (*Task, error) {
+	task, err := s.repo.GetTask(ctx, taskId)
+	return task, err
+}
+
+// возвращает ErrNotOwner если username не является владельцем задачи
+func (s *TasksService) CheckOwner(ctx context.Context, taskId uint64, username string) error {
+	task, err := s.repo.GetTask(ctx, taskId)
+	if err != nil {
+		return err
+	}
+	if task.Owner != username {
+		return ErrNotOwner
+	}
+	return nil
+}
+
+// возвращает ErrNotParticipant если username не владелец и не исполнитель задачи
+func (s *TasksService) CheckParticipant(ctx context.Context, taskId uint64, username string) error {
+	task, err := s.repo.GetTask(ctx, taskId)
+	if err != nil {
+		return err
+	}
+	if task.Owner == username || slices.Contains(task.Executors, username) {
+		return nil
+	}
+	return ErrNotParticipant
+}
+
 func (s *TasksService) Add(ctx context.Context, task *Task) (uint64, error) {
 	id, err := s.repo.Add(ctx, task)
-	return id, err
+	if err != nil {
+		return 0, err
+	}
+	s.outbox.Notify()
+	return id, nil
 }
 
 func (s *TasksService) Assign(ctx context.Context, taskId uint64, username string) error {
 	err := s.repo.Assign(ctx, taskId, username)
-	return err
+	if err != nil {
+		return err
+	}
+	s.outbox.Notify()
+	return nil
 }
 
-func (s *TasksService) Unassign(ctx context.Context, taskId uint64) error {
-	err := s.repo.Unassign(ctx, taskId)
-	return err
+func (s *TasksService) Unassign(ctx context.Context, taskId uint64, username string) error {
+	err := s.repo.Unassign(ctx, taskId, username)
+	if err != nil {
+		return err
+	}
+	s.outbox.Notify()
+	return nil
+}
+
+// возвращает ErrNoTeam если команды нет
+func (s *TasksService) AssignTeam(ctx context.Context, taskId uint64, team string) error {
+	if _, err := s.teams.GetTeam(ctx, team); err != nil {
+		return err
+	}
+	err := s.repo.AssignTeam(ctx, taskId, team)
+	if err != nil {
+		return err
+	}
+	s.outbox.Notify()
+	return nil
 }
 
-func (s *TasksService) Complete(ctx context.Context, taskId uint64) error {
+func (s *TasksService) UnassignTeam(ctx context.Context, taskId uint64, team string) error {
+	err := s.repo.UnassignTeam(ctx, taskId, team)
+	if err != nil {
+		return err
+	}
+	s.outbox.Notify()
+	return nil
+}
+
+// участник команды забирает командную задачу себе: команда снимается, он становится исполнителем.
+// Возвращает ErrNotTeamMember если пользователь не состоит ни в одной из команд задачи
+func (s *TasksService) ClaimTask(ctx context.Context, taskId uint64, username string) error {
+	task, err := s.repo.GetTask(ctx, taskId)
+	if err != nil {
+		return err
+	}
+	teams, err := s.teams.GetUserTeams(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	team := ""
+	for _, name := range task.Teams {
+		if slices.Contains(teams, name) {
+			team = name
+			break
+		}
+	}
+	if team == "" {
+		return ErrNotTeamMember
+	}
+
+	err = s.repo.Claim(ctx, taskId, team, username)
+	if err != nil {
+		return err
+	}
+	s.outbox.Notify()
+	return nil
+}
+
+// завершить задачу может только ее владелец или исполнитель, иначе возвращает ErrNotParticipant
+func (s *TasksService) Complete(ctx context.Context, taskId uint64, username string) error {
+	if err := s.CheckParticipant(ctx, taskId, username); err != nil {
+		return err
+	}
 	err := s.repo.Complete(ctx, taskId)
+	if err != nil {
+		return err
+	}
+	s.outbox.Notify()
+	return nil
+}
+
+// возвращает ErrBadStatus для неизвестного статуса и ErrNotParticipant,
+// если username не владелец и не исполнитель задачи
+func (s *TasksService) SetStatus(ctx context.Context, taskId uint64, username, status string) error {
+	if !ValidStatus(status) {
+		return ErrBadStatus
+	}
+	if err := s.CheckParticipant(ctx, taskId, username); err != nil {
+		return err
+	}
+	err := s.repo.SetStatus(ctx, taskId, status)
+	if err != nil {
+		return err
+	}
+	s.outbox.Notify()
+	return nil
+}
+
+func (s *TasksService) Watch(ctx context.Context, taskId uint64, username string) error {
+	err := s.repo.Watch(ctx, taskId, username)
 	return err
 }
+
+func (s *TasksService) Unwatch(ctx context.Context, taskId uint64, username string) error {
+	err := s.repo.Unwatch(ctx, taskId, username)
+	return err
+}
+
+// рассылает события нескольким получателям по порядку.
+// Ошибка одного получателя не мешает остальным, возвращаются все ошибки
+type Publishers []EventPublisher
+
+func (p Publishers) Publish(ctx context.Context, event *TaskEvent) error {
+	errs := []error{}
+	for _, publisher := range p {
+		if err := publisher.Publish(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"testing"
+)
+
+// хранилище задач в памяти, реализует только методы, нужные тестам
+type fakeTasksStorage struct {
+	TasksStorage
+	tasks map[uint64]*Task
+}
+
+func (f *fakeTasksStorage) GetTask(ctx context.Context, taskId uint64) (*Task, error) {
+	task, ok := f.tasks[taskId]
+	if !ok {
+		return nil, ErrNoTask
+	}
+	return task, nil
+}
+
+func (f *fakeTasksStorage) Complete(ctx context.Context, taskId uint64) error {
+	f.tasks[taskId].Status = StatusDone
+	return nil
+}
+
+func (f *fakeTasksStorage) SetStatus(ctx context.Context, taskId uint64, status string) error {
+	f.tasks[taskId].Status = status
+	return nil
+}
+
+type nopOutbox struct{}
+
+func (nopOutbox) Notify() {}
+
+func newTestTasksService() (*TasksService, *fakeTasksStorage) {
+	repo := &fakeTasksStorage{tasks: map[uint64]*Task{
+		1: {ID: 1, Owner: "alice", Executors: []string{"bob"}, Status: StatusTodo},
+	}}
+	return NewTasksService(repo, &fakeTeamsStorage{}, nopOutbox{}), repo
+}
+
+func TestCompleteChecksParticipant(t *testing.T) {
+	tests := []struct {
+		username string
+		wantErr  error
+	}{
+		{"alice", nil},
+		{"bob", nil},
+		{"carol", ErrNotParticipant},
+	}
+	for _, tt := range tests {
+		t.Run(tt.username, func(t *testing.T) {
+			s, repo := newTestTasksService()
+			err := s.Complete(context.Background(), 1, tt.username)
+			if err != tt.wantErr {
+				t.Fatalf("Complete() error = %v, want %v", err, tt.wantErr)
+			}
+			if done := repo.tasks[1].Status == StatusDone; done != (tt.wantErr == nil) {
+				t.Errorf("task status %s", repo.tasks[1].Status)
+			}
+		})
+	}
+}
+
+func TestSetStatusChecksParticipant(t *testing.T) {
+	s, repo := newTestTasksService()
+	ctx := context.Background()
+
+	if err := s.SetStatus(ctx, 1, "carol", StatusInProgress); err != ErrNotParticipant {
+		t.Fatalf("SetStatus() by a stranger error = %v, want %v", err, ErrNotParticipant)
+	}
+	if repo.tasks[1].Status != StatusTodo {
+		t.Fatalf("status changed to %s by a stranger", repo.tasks[1].Status)
+	}
+	if err := s.SetStatus(ctx, 1, "bob", StatusInProgress); err != nil {
+		t.Fatal(err)
+	}
+	if repo.tasks[1].Status != StatusInProgress {
+		t.Errorf("status %s, want %s", repo.tasks[1].Status, StatusInProgress)
+	}
+	if err := s.SetStatus(ctx, 1, "bob", "lost"); err != ErrBadStatus {
+		t.Errorf("SetStatus() with unknown status error = %v, want %v", err, ErrBadStatus)
+	}
+}
+
+func TestCompleteMissingTask(t *testing.T) {
+	s, _ := newTestTasksService()
+	if err := s.Complete(context.Background(), 42, "alice"); err != ErrNoTask {
+		t.Errorf("Complete() error = %v, want %v", err, ErrNoTask)
+	}
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrNoTeam        = errors.New("no such team")
+	ErrTeamExist     = errors.New("team already exists")
+	ErrNotTeamOwner  = errors.New("only the team owner can do this")
+	ErrNotTeamMember = errors.New("not a member of the task team")
+	ErrNoTeamTask    = errors.New("task is not assigned to this team")
+	ErrOwnerLeave    = errors.New("the team owner cannot leave the team")
+)
+
+type TeamsStorage interface {
+	// возвращает ошибку service.ErrTeamExist если команда с таким именем уже есть
+	AddTeam(ctx context.Context, team *Team) error
+	// возвращает ошибку service.ErrNoTeam если команды нет
+	GetTeam(ctx context.Context, name string) (*Team, error)
+	GetTeams(ctx context.Context) ([]*Team, error)
+	// возвращает имена команд, в которых состоит пользователь
+	GetUserTeams(ctx context.Context, username string) ([]string, error)
+	// возвращают ошибку service.ErrNoTeam если команды нет
+	AddTeamMember(ctx context.Context, name, username string) error
+	RemoveTeamMember(ctx context.Context, name, username string) error
+}
+
+type TeamsService struct {
+	repo TeamsStorage
+}
+
+func NewTeamsService(repo TeamsStorage) *TeamsService {
+	return &TeamsService{
+		repo: repo,
+	}
+}
+
+// создает команду, владелец сразу становится ее участником.
+// Имя команды подчиняется тем же правилам, что и логин
+func (s *TeamsService) CreateTeam(ctx context.Context, owner, name string) (*Team, error) {
+	if !usernamePattern.MatchString(name) {
+		return nil, &ValidationError{Fields: map[string]string{
+			TeamName: "must be 3-32 characters: letters, digits, '.', '_' or '-', starting with a letter or digit",
+		}}
+	}
+	team := &Team{
+		Name:    name,
+		Owner:   owner,
+		Members: []string{owner},
+	}
+	if err := s.repo.AddTeam(ctx, team); err != nil {
+		return nil, err
+	}
+	return team, nil
+}
+
+func (s *TeamsService) GetTeam(ctx context.Context, name string) (*Team, error) {
+	return s.repo.GetTeam(ctx, name)
+}
+
+func (s *TeamsService) GetTeams(ctx context.Context) ([]*Team, error) {
+	return s.repo.GetTeams(ctx)
+}
+
+// возвращает имена команд, в которых состоит пользователь
+func (s *TeamsService) GetUserTeams(ctx context.Context, username string) ([]string, error) {
+	return s.repo.GetUserTeams(ctx, username)
+}
+
+// добавлять участников может только владелец команды
+func (s *TeamsService) AddTeamMember(ctx context.Context, name, owner, username string) error {
+	if err := s.checkTeamOwner(ctx, name, owner); err != nil {
+		return err
+	}
+	return s.repo.AddTeamMember(ctx, name, username)
+}
+
+// владелец убирает любого участника, кроме себя, остальные могут только выйти сами
+func (s *TeamsService) RemoveTeamMember(ctx context.Context, name, actor, username string) error {
+	team, err := s.repo.GetTeam(ctx, name)
+	if err != nil {
+		return err
+	}
+	if actor != username && team.Owner != actor {
+		return ErrNotTeamOwner
+	}
+	if username == team.Owner {
+		return ErrOwnerLeave
+	}
+	return s.repo.RemoveTeamMember(ctx, name, username)
+}
+
+func (s *TeamsService) checkTeamOwner(ctx context.Context, name, username string) error {
+	team, err := s.repo.GetTeam(ctx, name)
+	if err != nil {
+		return err
+	}
+	if team.Owner != username {
+		return ErrNotTeamOwner
+	}
+	return nil
+}
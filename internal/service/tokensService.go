@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	// по префиксу токен легко найти в конфигах и логах
+	tokenPrefix = "tm_"
+	// как часто обновлять время последнего использования
+	lastUsedPrecision = time.Minute
+)
+
+var (
+	ErrNoToken      = errors.New("no such token")
+	ErrTokenExpired = errors.New("token expired")
+	ErrBadScope     = errors.New("unknown token scope")
+)
+
+var tokenScopes = map[string]bool{
+	ScopeRead:  true,
+	ScopeWrite: true,
+	ScopeAdmin: true,
+}
+
+type TokensStorage interface {
+	AddToken(ctx context.Context, token *APIToken) error
+	// возвращает ошибку service.ErrNoToken если токена нет
+	GetTokenByHash(ctx context.Context, hash string) (*APIToken, error)
+	GetTokens(ctx context.Context, username string) ([]*APIToken, error)
+	// возвращает ошибку service.ErrNoToken если у пользователя нет такого токена
+	DeleteToken(ctx context.Context, id string, username string) error
+	SetTokenLastUsed(ctx context.Context, id string, t time.Time) error
+	DeleteUserTokens(ctx context.Context, username string) error
+}
+
+type TokensService struct {
+	repo TokensStorage
+}
+
+func NewTokensService(repo TokensStorage) *TokensService {
+	return &TokensService{
+		repo: repo,
+	}
+}
+
+// API токен отличается от значения сессии префиксом
+func IsAPIToken(raw string) bool {
+	return strings.HasPrefix(raw, tokenPrefix)
+}
+
+// создает токен и возвращает его значение, которое больше нигде не сохраняется.
+// ttl 0 - бессрочный токен
+func (s *TokensService) CreateToken(ctx context.Context, username, name string, scopes []string, ttl time.Duration) (string, *APIToken, error) {
+	if len(scopes) == 0 {
+		return "", nil, ErrBadScope
+	}
+	for _, scope := range scopes {
+		if !tokenScopes[scope] {
+			return "", nil, ErrBadScope
+		}
+	}
+
+	secret, err := randomString(32)
+	if err != nil {
+		return "", nil, err
+	}
+	id, err := randomHex(8)
+	if err != nil {
+		return "", nil, err
+	}
+	raw := tokenPrefix + secret
+
+	token := &APIToken{
+		ID:        id,
+		UserName:  username,
+		Name:      name,
+		Hash:      hashToken(raw),
+		Prefix:    raw[:len(tokenPrefix)+6],
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+	}
+	if ttl > 0 {
+		expires := token.CreatedAt.Add(ttl)
+		token.ExpiresAt = &expires
+	}
+
+	if err := s.repo.AddToken(ctx, token); err != nil {
+		return "", nil, err
+	}
+	return raw, token, nil
+}
+
+func (s *TokensService) GetTokens(ctx context.Context, username string) ([]*APIToken, error) {
+	return s.repo.GetTokens(ctx, username)
+}
+
+func (s *TokensService) RevokeToken(ctx context.Context, id string, username string) error {
+	return s.repo.DeleteToken(ctx, id, username)
+}
+
+// отзывает все токены пользователя, например при его отключении
+func (s *TokensService) RevokeUserTokens(ctx context.Context, username string) error {
+	return s.repo.DeleteUserTokens(ctx, username)
+}
+
+// проверяет значение токена и отмечает его использование.
+// Возвращает ErrNoToken для неизвестного токена и ErrTokenExpired для просроченного
+func (s *TokensService) AuthenticateToken(ctx context.Context, raw string) (*APIToken, error) {
+	if !strings.HasPrefix(raw, tokenPrefix) {
+		return nil, ErrNoToken
+	}
+	token, err := s.repo.GetTokenByHash(ctx, hashToken(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if token.ExpiresAt != nil && now.After(*token.ExpiresAt) {
+		return nil, ErrTokenExpired
+	}
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > lastUsedPrecision {
+		if err := s.repo.SetTokenLastUsed(ctx, token.ID, now); err != nil {
+			return nil, err
+		}
+		token.LastUsedAt = &now
+	}
+	return token, nil
+}
+
+// у токена 256 бит энтропии, поэтому медленный хэш для паролей не нужен
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,24 @@
+package service
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+)
+
+// у фоновых задач нет входящего запроса, трассу они начинают сами
+var tracer = otel.Tracer("github.com/RusGadzhiev/TaskManager")
+
+type pollingCtxKey struct{}
+
+// отмечает опрос очереди. Опросы идут каждые несколько секунд и обычно ничего не находят,
+// поэтому спан хранилища для них создается, только если у ctx уже есть родительский спан.
+// Родительский спан начинает сама фоновая задача, когда опрос нашел работу
+func WithPolling(ctx context.Context) context.Context {
+	return context.WithValue(ctx, pollingCtxKey{}, true)
+}
+
+func IsPolling(ctx context.Context) bool {
+	polling, _ := ctx.Value(pollingCtxKey{}).(bool)
+	return polling
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	ErrBadOTP               = errors.New("invalid two-factor code")
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnrolled = errors.New("two-factor authentication is not enrolled")
+)
+
+// TOTP по RFC 6238: HMAC-SHA1, 6 цифр, шаг 30 секунд
+const (
+	totpIssuer  = "TaskManager"
+	totpDigits  = 6
+	totpPeriod  = 30
+	totpSkew    = 1
+	secretBytes = 20
+
+	recoveryCodesCount = 10
+)
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// начинает подключение 2FA: сохраняет новый секрет и возвращает otpauth:// ссылку для приложения.
+// Повторный вызов до подтверждения заменяет секрет
+func (s *UsersService) EnrollTwoFactor(ctx context.Context, username string) (string, error) {
+	user, err := s.repo.GetUser(ctx, username)
+	if err != nil {
+		return "", err
+	}
+	if user.TwoFactorEnabled() {
+		return "", ErrTwoFactorEnabled
+	}
+
+	secret := make([]byte, secretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	settings := &TOTPSettings{
+		Secret:        b32.EncodeToString(secret),
+		RecoveryCodes: []string{},
+	}
+	if err := s.repo.SetTOTP(ctx, username, settings); err != nil {
+		return "", err
+	}
+	return otpauthURI(username, settings.Secret), nil
+}
+
+// включает 2FA после проверки первого кода и возвращает коды восстановления,
+// в хранилище они попадают только в виде хэшей
+func (s *UsersService) ConfirmTwoFactor(ctx context.Context, username, code string) ([]string, error) {
+	user, err := s.repo.GetUser(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTP == nil {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+	if user.TOTP.Enabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	step, ok := checkTOTP(user.TOTP.Secret, code, time.Now())
+	if !ok {
+		return nil, ErrBadOTP
+	}
+
+	codes := make([]string, recoveryCodesCount)
+	hashes := make([]string, recoveryCodesCount)
+	for i := range codes {
+		raw, err := randomHex(5)
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = raw[:5] + "-" + raw[5:]
+		hashes[i] = hashToken(raw)
+	}
+
+	settings := &TOTPSettings{
+		Secret:        user.TOTP.Secret,
+		Enabled:       true,
+		LastStep:      step,
+		RecoveryCodes: hashes,
+	}
+	if err := s.repo.SetTOTP(ctx, username, settings); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// проверяет код приложения или одноразовый код восстановления.
+// Возвращает ErrTwoFactorNotEnrolled если 2FA не включена
+func (s *UsersService) VerifyTwoFactor(ctx context.Context, username, code string) error {
+	user, err := s.repo.GetUser(ctx, username)
+	if err != nil {
+		return err
+	}
+	if !user.TwoFactorEnabled() {
+		return ErrTwoFactorNotEnrolled
+	}
+
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	if len(code) == totpDigits {
+		step, ok := checkTOTP(user.TOTP.Secret, code, time.Now())
+		if !ok {
+			return ErrBadOTP
+		}
+		return s.repo.UseTOTPStep(ctx, username, step)
+	}
+	return s.repo.UseRecoveryCode(ctx, username, hashToken(code))
+}
+
+// выключает 2FA пользователя, требует действующий код
+func (s *UsersService) DisableTwoFactor(ctx context.Context, username, code string) error {
+	if err := s.VerifyTwoFactor(ctx, username, code); err != nil {
+		return err
+	}
+	return s.repo.SetTOTP(ctx, username, nil)
+}
+
+// сброс 2FA администратором, например при потере телефона и кодов восстановления
+func (s *UsersService) ResetTwoFactor(ctx context.Context, username string) error {
+	return s.repo.SetTOTP(ctx, username, nil)
+}
+
+func (s *UsersService) TwoFactorEnabled(ctx context.Context, username string) (bool, error) {
+	user, err := s.repo.GetUser(ctx, username)
+	if err != nil {
+		return false, err
+	}
+	return user.TwoFactorEnabled(), nil
+}
+
+func otpauthURI(username, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", totpIssuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(totpDigits))
+	v.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + url.PathEscape(totpIssuer+":"+username) + "?" + v.Encode()
+}
+
+// возвращает шаг, для которого подходит код, с допуском в totpSkew шагов
+func checkTOTP(secret, code string, now time.Time) (int64, bool) {
+	key, err := b32.DecodeString(secret)
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(hotp(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func hotp(key []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
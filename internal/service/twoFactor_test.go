@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func (f *fakeUsersStorage) SetTOTP(ctx context.Context, username string, settings *TOTPSettings) error {
+	user, ok := f.users[username]
+	if !ok {
+		return ErrNoUser
+	}
+	user.TOTP = settings
+	return nil
+}
+
+func (f *fakeUsersStorage) UseTOTPStep(ctx context.Context, username string, step int64) error {
+	user, ok := f.users[username]
+	if !ok || user.TOTP == nil || step <= user.TOTP.LastStep {
+		return ErrBadOTP
+	}
+	user.TOTP.LastStep = step
+	return nil
+}
+
+func (f *fakeUsersStorage) UseRecoveryCode(ctx context.Context, username, hash string) error {
+	user, ok := f.users[username]
+	if !ok || user.TOTP == nil || !slices.Contains(user.TOTP.RecoveryCodes, hash) {
+		return ErrBadOTP
+	}
+	user.TOTP.RecoveryCodes = slices.DeleteFunc(user.TOTP.RecoveryCodes, func(h string) bool { return h == hash })
+	return nil
+}
+
+// секрет "12345678901234567890" из RFC 6238 в base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCheckTOTP(t *testing.T) {
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		now      int64
+		wantStep int64
+		wantOK   bool
+	}{
+		// векторы RFC 6238 для SHA1, последние 6 цифр
+		{"rfc 59", rfcSecret, "287082", 59, 1, true},
+		{"rfc 1111111109", rfcSecret, "081804", 1111111109, 37037036, true},
+		{"rfc 1111111111", rfcSecret, "050471", 1111111111, 37037037, true},
+		{"rfc 1234567890", rfcSecret, "005924", 1234567890, 41152263, true},
+		{"rfc 2000000000", rfcSecret, "279037", 2000000000, 66666666, true},
+		{"rfc 20000000000", rfcSecret, "353130", 20000000000, 666666666, true},
+		{"previous step", rfcSecret, "287082", 59 + totpPeriod, 1, true},
+		{"next step", rfcSecret, "287082", 59 - totpPeriod, 1, true},
+		{"two steps late", rfcSecret, "287082", 59 + 2*totpPeriod, 0, false},
+		{"wrong code", rfcSecret, "287083", 59, 0, false},
+		{"short code", rfcSecret, "28708", 59, 0, false},
+		{"bad secret", "not base32!", "287082", 59, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := checkTOTP(tt.secret, tt.code, time.Unix(tt.now, 0))
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("checkTOTP() = %d, %v, want %d, %v", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+// код приложения для шага step
+func totpCode(t *testing.T, secret string, step int64) string {
+	t.Helper()
+	key, err := b32.DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hotp(key, step)
+}
+
+// подключает 2FA пользователю alice и возвращает сервис, секрет, коды восстановления
+// и шаг кода, которым подключение подтверждено
+func enrolledTwoFactor(t *testing.T) (*UsersService, string, []string, int64) {
+	t.Helper()
+	repo := &fakeUsersStorage{users: map[string]*User{"alice": {UserName: "alice"}}}
+	s := NewUsersService(repo, nil, nil, nil, zap.NewNop().Sugar())
+	ctx := context.Background()
+
+	uri, err := s.EnrollTwoFactor(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(uri, "otpauth://totp/TaskManager:alice?") {
+		t.Fatalf("otpauth uri %s", uri)
+	}
+	secret := repo.users["alice"].TOTP.Secret
+	if _, err := s.ConfirmTwoFactor(ctx, "alice", "abcdef"); err != ErrBadOTP {
+		t.Fatalf("confirm with bad code: %v", err)
+	}
+	codes, err := s.ConfirmTwoFactor(ctx, "alice", totpCode(t, secret, time.Now().Unix()/totpPeriod))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodesCount {
+		t.Fatalf("got %d recovery codes", len(codes))
+	}
+	for i, hash := range repo.users["alice"].TOTP.RecoveryCodes {
+		if hash != hashToken(strings.ReplaceAll(codes[i], "-", "")) {
+			t.Fatal("recovery codes are not stored as hashes")
+		}
+	}
+	return s, secret, codes, repo.users["alice"].TOTP.LastStep
+}
+
+func TestVerifyTwoFactor(t *testing.T) {
+	s, secret, codes, step := enrolledTwoFactor(t)
+	ctx := context.Background()
+
+	// шаги проверяются по порядку: каждый зависит от уже использованных кодов
+	steps := []struct {
+		name string
+		code string
+		want error
+	}{
+		{"code used for confirmation", totpCode(t, secret, step), ErrBadOTP},
+		{"next step code", totpCode(t, secret, step+1), nil},
+		{"replayed code", totpCode(t, secret, step+1), ErrBadOTP},
+		{"older step code", totpCode(t, secret, step-1), ErrBadOTP},
+		{"wrong code", "abcdef", ErrBadOTP},
+		{"recovery code", codes[0], nil},
+		{"recovery code reused", codes[0], ErrBadOTP},
+		{"recovery code without dash in upper case", strings.ToUpper(strings.ReplaceAll(codes[1], "-", "")), nil},
+		{"recovery code with spaces", " " + codes[2] + " ", nil},
+		{"unknown recovery code", "00000-00000", ErrBadOTP},
+	}
+	for _, tt := range steps {
+		if err := s.VerifyTwoFactor(ctx, "alice", tt.code); err != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestTwoFactorLifecycle(t *testing.T) {
+	s, secret, codes, step := enrolledTwoFactor(t)
+	ctx := context.Background()
+
+	if _, err := s.EnrollTwoFactor(ctx, "alice"); err != ErrTwoFactorEnabled {
+		t.Errorf("enroll twice: %v", err)
+	}
+	if err := s.DisableTwoFactor(ctx, "alice", "00000-00000"); err != ErrBadOTP {
+		t.Errorf("disable with bad code: %v", err)
+	}
+	if err := s.DisableTwoFactor(ctx, "alice", codes[0]); err != nil {
+		t.Fatal(err)
+	}
+	if enabled, _ := s.TwoFactorEnabled(ctx, "alice"); enabled {
+		t.Error("2FA still enabled")
+	}
+	if err := s.VerifyTwoFactor(ctx, "alice", totpCode(t, secret, step+1)); err != ErrTwoFactorNotEnrolled {
+		t.Errorf("verify after disable: %v", err)
+	}
+	if _, err := s.ConfirmTwoFactor(ctx, "alice", totpCode(t, secret, step+1)); err != ErrTwoFactorNotEnrolled {
+		t.Errorf("confirm without enroll: %v", err)
+	}
+}
@@ -1,24 +1,344 @@
 package service
 
 import (
+	"slices"
 	"time"
 )
 
 type Task struct {
 	ID          uint64
 	Owner       string
-	Executor    string
+	Executors   []string
+	Teams       []string
+	Watchers    []string
 	Description string
+	Status      string
+	DueAt       *time.Time
 	Completed   bool
 	Assigned    bool
 }
 
 type User struct {
-	UserName string `bson:"username"`
-	Password string `bson:"password"`
+	UserName      string                `bson:"username"`
+	Password      string                `bson:"password"`
+	Email         string                `bson:"email,omitempty"`
+	DisplayName   string                `bson:"display_name,omitempty"`
+	Notifications *NotificationSettings `bson:"notifications,omitempty"`
+	Roles         []string              `bson:"roles,omitempty"`
+	TOTP          *TOTPSettings         `bson:"totp,omitempty"`
+	PasswordReset *PasswordReset        `bson:"password_reset,omitempty"`
+	// отключенный пользователь не может войти
+	Disabled bool `bson:"disabled,omitempty"`
+	// удаленный пользователь не находится, но его логин остается занятым
+	Deleted bool `bson:"deleted,omitempty"`
+	// для пользователей внешнего провайдера входа пароль не используется
+	Provider string `bson:"provider,omitempty"`
+	Subject  string `bson:"subject,omitempty"`
 }
 
+// команда исполнителей, владелец управляет составом
+type Team struct {
+	Name    string   `bson:"name" json:"name"`
+	Owner   string   `bson:"owner" json:"owner"`
+	Members []string `bson:"members" json:"members"`
+}
+
+func (t *Team) HasMember(username string) bool {
+	for _, name := range t.Members {
+		if name == username {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+func (u *User) HasRole(role string) bool {
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// настройки двухфакторной аутентификации, до подтверждения кодом Enabled = false
+type TOTPSettings struct {
+	// секрет в base32
+	Secret  string `bson:"secret"`
+	Enabled bool   `bson:"enabled"`
+	// последний принятый временной шаг, повторно код того же шага не принимается
+	LastStep int64 `bson:"last_step"`
+	// sha256 неиспользованных кодов восстановления
+	RecoveryCodes []string `bson:"recovery_codes"`
+}
+
+// запрошенный сброс пароля, хранится sha256 токена из письма
+type PasswordReset struct {
+	Hash      string    `bson:"hash"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+// страница списка пользователей
+type UsersPage struct {
+	Users    []*UserSummary `json:"users"`
+	Total    int64          `json:"total"`
+	Page     int            `json:"page"`
+	PageSize int            `json:"page_size"`
+}
+
+// пользователь в списке для администратора
+type UserSummary struct {
+	Profile
+	Provider string `json:"provider,omitempty"`
+	Disabled bool   `json:"disabled"`
+}
+
+// данные профиля, которые пользователь видит и меняет сам
+type Profile struct {
+	UserName    string   `json:"username"`
+	DisplayName string   `json:"display_name"`
+	Email       string   `json:"email"`
+	Roles       []string `json:"roles"`
+}
+
+func (u *User) TwoFactorEnabled() bool {
+	return u.TOTP != nil && u.TOTP.Enabled
+}
+
+// откуда вход выполнен, запоминается в сведениях о сессии
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+// сведения об активной сессии пользователя; ID - sha256 значения сессии, само значение не хранится в открытом виде
+type SessionInfo struct {
+	ID       string `json:"id"`
+	UserName string `json:"-"`
+	// ключ сессии или refresh токена в хранилище сессий, тоже построен по хэшу
+	Key       string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Remember  bool      `json:"remember"`
+	Current   bool      `json:"current"`
+	// токен CSRF для форм этой сессии
+	CSRFToken string `json:"-"`
+}
+
+// пользователь, подтвержденный внешним провайдером входа
+type ExternalIdentity struct {
+	Provider string
+	Subject  string
+	UserName string
+	Email    string
+	Roles    []string
+}
+
+const (
+	NotifyAssigned  = "assigned"
+	NotifyCompleted = "completed"
+	NotifyDueSoon   = "due_soon"
+)
+
+// какие письма получает пользователь
+type NotificationSettings struct {
+	Assigned  bool `bson:"assigned" json:"assigned"`
+	Completed bool `bson:"completed" json:"completed"`
+	DueSoon   bool `bson:"due_soon" json:"due_soon"`
+}
+
+// пользователи без сохраненных настроек получают все уведомления
+func (u *User) Wants(kind string) bool {
+	if u.Email == "" {
+		return false
+	}
+	if u.Notifications == nil {
+		return true
+	}
+	switch kind {
+	case NotifyAssigned:
+		return u.Notifications.Assigned
+	case NotifyCompleted:
+		return u.Notifications.Completed
+	case NotifyDueSoon:
+		return u.Notifications.DueSoon
+	}
+	return false
+}
+
+// RefreshVal заполняется только в режиме jwt
 type Session struct {
-	CookieVal string
-	Dur       time.Duration
+	CookieVal  string
+	Dur        time.Duration
+	RefreshVal string
+	RefreshDur time.Duration
+	// без "запомнить меня" куки живут до закрытия браузера
+	Remember bool
+}
+
+// колонки доски задач
+const (
+	StatusTodo       = "todo"
+	StatusInProgress = "in_progress"
+	StatusDone       = "done"
+)
+
+func ValidStatus(status string) bool {
+	return status == StatusTodo || status == StatusInProgress || status == StatusDone
+}
+
+// задача видна владельцу, исполнителям и наблюдателям.
+// Участников назначенных команд здесь не узнать, команды хранятся отдельно от задач,
+// для них есть VisibleToMember
+func (t *Task) VisibleTo(username string) bool {
+	if t.Owner == username {
+		return true
+	}
+	for _, name := range t.Executors {
+		if name == username {
+			return true
+		}
+	}
+	for _, name := range t.Watchers {
+		if name == username {
+			return true
+		}
+	}
+	return false
+}
+
+// teams - команды, в которых состоит пользователь
+func (t *Task) VisibleToMember(username string, teams []string) bool {
+	return t.VisibleTo(username) || slices.ContainsFunc(t.Teams, func(team string) bool {
+		return slices.Contains(teams, team)
+	})
+}
+
+const (
+	EventTaskCreated       = "task_created"
+	EventTaskAssigned      = "task_assigned"
+	EventTaskUnassigned    = "task_unassigned"
+	EventTaskCompleted     = "task_completed"
+	EventTaskStatusChanged = "task_status_changed"
+)
+
+// TaskEvent описывает изменение задачи.
+// UserName - пользователь, которого касается изменение (назначенный или снятый исполнитель),
+// Team - назначенная или снятая команда, Actor - пользователь, выполнивший действие.
+// Key - ключ идемпотентности: при повторной доставке того же события он не меняется
+type TaskEvent struct {
+	ID        uint64    `json:"id"`
+	Key       string    `json:"key"`
+	Type      string    `json:"type"`
+	Task      *Task     `json:"task"`
+	UserName  string    `json:"username,omitempty"`
+	Team      string    `json:"team,omitempty"`
+	Actor     string    `json:"actor,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	// участники команд задачи и команды Team по имени команды.
+	// Команды хранятся отдельно от задач, поэтому состав заполняется при отправке из outbox
+	TeamMembers map[string][]string `json:"-"`
+}
+
+// событие видно тем, кому видна задача, участникам ее команд, а также затронутому пользователю и команде
+func (e *TaskEvent) VisibleTo(username string) bool {
+	if e.UserName == username || e.Task.VisibleTo(username) {
+		return true
+	}
+	for _, members := range e.TeamMembers {
+		if slices.Contains(members, username) {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// подписка на события задач, по которой отправляются вебхуки
+type WebhookSubscription struct {
+	ID        uint64    `json:"id"`
+	Owner     string    `json:"owner"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"-"`
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// попытки отправки одного события по подписке
+type WebhookDelivery struct {
+	ID             uint64     `json:"id"`
+	SubscriptionID uint64     `json:"subscription_id"`
+	EventKey       string     `json:"event_key"`
+	EventType      string     `json:"event"`
+	Payload        string     `json:"payload"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	ResponseCode   int        `json:"response_code"`
+	LastError      string     `json:"last_error"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+}
+
+// письмо в очереди отправки. Key не дает поставить одно письмо дважды
+type Mail struct {
+	ID            uint64
+	Key           string
+	To            string
+	Subject       string
+	Body          string
+	Status        string
+	Attempts      int
+	LastError     string
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+	SentAt        *time.Time
+}
+
+// событие задачи, сохраненное в outbox в одной транзакции с изменением задачи
+type OutboxEvent struct {
+	ID      uint64
+	Key     string
+	Payload []byte
+}
+
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeAdmin = "admin"
+)
+
+// персональный токен доступа, хранится только хэш
+type APIToken struct {
+	ID         string     `bson:"_id" json:"id"`
+	UserName   string     `bson:"username" json:"username"`
+	Name       string     `bson:"name" json:"name"`
+	Hash       string     `bson:"hash" json:"-"`
+	Prefix     string     `bson:"prefix" json:"prefix"`
+	Scopes     []string   `bson:"scopes" json:"scopes"`
+	CreatedAt  time.Time  `bson:"created_at" json:"created_at"`
+	ExpiresAt  *time.Time `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `bson:"last_used_at,omitempty" json:"last_used_at,omitempty"`
+}
+
+// admin включает write, write включает read
+func (t *APIToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope || s == ScopeAdmin || (s == ScopeWrite && scope == ScopeRead) {
+			return true
+		}
+	}
+	return false
 }
@@ -3,44 +3,345 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/RusGadzhiev/TaskManager/internal/config"
+	"go.uber.org/zap"
 )
 
 var (
 	ErrNoUser            = errors.New("no such user")
 	ErrUserExist         = errors.New("user with this login exists")
 	ErrIncorrectPassword = errors.New("incorrect password")
+	ErrBadEmail          = errors.New("bad email address")
+	ErrUserDisabled      = errors.New("user is disabled")
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
 )
 
 type UsersStorage interface {
 	// возвращает ошибку service.ErrNoUser если юзера нет
 	GetUser(ctx context.Context, username string) (*User, error)
-	// возвращает ошибку service.ErrUserExist если юзер уже есть
+	// возвращает ошибку service.ErrUserExist если юзер с таким логином без учета регистра уже есть
 	AddUser(ctx context.Context, user *User) error
+	// возвращает до limit логинов, начинающихся с prefix в нижнем регистре, по порядку.
+	// Логины, созданные до перехода на нижний регистр, с заглавными буквами не находятся
+	GetUserNames(ctx context.Context, prefix string, limit int) ([]string, error)
+	// возвращает найденных пользователей из списка, отсутствующие пропускаются
+	GetUsers(ctx context.Context, usernames []string) ([]*User, error)
+	// возвращает ошибку service.ErrNoUser если юзера нет
+	SetNotifications(ctx context.Context, username string, settings *NotificationSettings) error
+	// обновляет почту и роли пользователя внешнего провайдера, возвращает ошибку service.ErrNoUser если юзера нет
+	UpdateExternalUser(ctx context.Context, username, email string, roles []string) error
+	// сохраняет настройки 2FA, nil их удаляет. Возвращает ошибку service.ErrNoUser если юзера нет
+	SetTOTP(ctx context.Context, username string, settings *TOTPSettings) error
+	// атомарно запоминает шаг TOTP, возвращает service.ErrBadOTP если шаг не больше уже использованного
+	UseTOTPStep(ctx context.Context, username string, step int64) error
+	// атомарно удаляет код восстановления, возвращает service.ErrBadOTP если такого кода нет
+	UseRecoveryCode(ctx context.Context, username, hash string) error
+	// возвращает ошибку service.ErrNoUser если юзера нет
+	SetPassword(ctx context.Context, username, password string) error
+	// возвращает ошибку service.ErrNoUser если юзера нет
+	UpdateProfile(ctx context.Context, username, displayName, email string) error
+	// сохраняет сброс пароля, заменяя предыдущий; возвращает ошибку service.ErrNoUser если юзера нет
+	SetPasswordReset(ctx context.Context, username string, reset *PasswordReset) error
+	// атомарно меняет пароль по действующему сбросу и удаляет его, возвращает имя пользователя.
+	// Возвращает ошибку service.ErrBadResetToken если сброса нет или он истек
+	ResetPassword(ctx context.Context, hash, password string, now time.Time) (string, error)
+	// ищет по вхождению query в логин, имя или почту без учета регистра, сортирует по логину.
+	// Возвращает страницу пользователей и общее число найденных
+	ListUsers(ctx context.Context, query string, offset, limit int) ([]*User, int64, error)
+	// возвращает ошибку service.ErrNoUser если юзера нет
+	SetDisabled(ctx context.Context, username string, disabled bool) error
+	// добавляет роль, если ее еще нет. Возвращает ошибку service.ErrNoUser если юзера нет
+	AddRole(ctx context.Context, username, role string) error
+	// помечает пользователя удаленным: логин остается занятым, а пользователь перестает находиться.
+	// Возвращает ошибку service.ErrNoUser если юзера нет
+	DeleteUser(ctx context.Context, username string) error
+}
+
+// максимальное расстояние Левенштейна для похожих логинов
+const maxSuggestionDistance = 2
+
+const (
+	// сколько логинов читается из хранилища для поиска похожих
+	maxSuggestionCandidates = 1000
+	maxSuggestions          = 5
+)
+
+// UnknownUserError возвращается при попытке сослаться на несуществующего пользователя,
+// Suggestions содержит похожие существующие логины
+type UnknownUserError struct {
+	UserName    string
+	Suggestions []string
+}
+
+func (e *UnknownUserError) Error() string {
+	return fmt.Sprintf("unknown user %q", e.UserName)
+}
+
+func (e *UnknownUserError) Unwrap() error {
+	return ErrNoUser
 }
 
 type UsersService struct {
-	repo UsersStorage
+	repo     UsersStorage
+	notifier Notifier
+	policy   *config.PasswordPolicy
+	resetCfg *config.PasswordReset
+	// логины, получившие admin из конфига. Заполняется в BootstrapAdmins до запуска серверов
+	admins map[string]bool
+	logger *zap.SugaredLogger
 }
 
-func NewUsersService(repo UsersStorage) *UsersService {
+func NewUsersService(repo UsersStorage, notifier Notifier, policy *config.PasswordPolicy, resetCfg *config.PasswordReset, logger *zap.SugaredLogger) *UsersService {
 	return &UsersService{
-		repo: repo,
+		repo:     repo,
+		notifier: notifier,
+		policy:   policy,
+		resetCfg: resetCfg,
+		admins:   map[string]bool{},
+		logger:   logger,
 	}
 }
 
+// при успехе заменяет user.UserName логином в том регистре, в котором он хранится
 func (s *UsersService) Authentificate(ctx context.Context, user *User) error {
-	realUser, err := s.repo.GetUser(ctx, user.UserName)
+	realUser, err := s.findUser(ctx, user.UserName)
 	if err != nil {
 		return err
 	}
 
-	if user.Password != realUser.Password {
+	if realUser.Provider != "" || user.Password != realUser.Password {
 		return ErrIncorrectPassword
 	}
+	// об отключении сообщается только после верного пароля
+	if realUser.Disabled {
+		return ErrUserDisabled
+	}
 
+	user.UserName = realUser.UserName
 	return nil
 }
 
+// новые логины хранятся в нижнем регистре, логины, созданные раньше, - как были заданы,
+// поэтому сначала ищется точное совпадение
+func (s *UsersService) findUser(ctx context.Context, username string) (*User, error) {
+	user, err := s.repo.GetUser(ctx, username)
+	if err == ErrNoUser && strings.ToLower(username) != username {
+		return s.repo.GetUser(ctx, strings.ToLower(username))
+	}
+	return user, err
+}
+
+// возвращает *ValidationError с ошибками по полям, если логин, пароль или почта не подходят,
+// ErrUserExist если логин занят без учета регистра. Логин приводится к нижнему регистру
 func (s *UsersService) AddUser(ctx context.Context, user *User) error {
+	user.UserName = strings.ToLower(user.UserName)
+	if err := s.validateUser(user); err != nil {
+		return err
+	}
+	if len(user.Roles) == 0 {
+		user.Roles = []string{RoleUser}
+	}
 	return s.repo.AddUser(ctx, user)
 }
+
+// находит или создает пользователя внешнего провайдера, роли и почта берутся от провайдера при каждом входе,
+// роль admin из конфига сохраняется. Возвращает ErrUserExist, если логин занят локальным пользователем или пользователем другого провайдера
+func (s *UsersService) LoginExternal(ctx context.Context, identity *ExternalIdentity) (*User, error) {
+	user, err := s.findUser(ctx, identity.UserName)
+	if err == ErrNoUser {
+		user = &User{
+			UserName: strings.ToLower(identity.UserName),
+			Email:    identity.Email,
+			Roles:    identity.Roles,
+			Provider: identity.Provider,
+			Subject:  identity.Subject,
+		}
+		if err := s.repo.AddUser(ctx, user); err != nil {
+			return nil, err
+		}
+		return user, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if user.Provider != identity.Provider || user.Subject != identity.Subject {
+		return nil, ErrUserExist
+	}
+	if user.Disabled {
+		return nil, ErrUserDisabled
+	}
+	roles := identity.Roles
+	if s.admins[user.UserName] && !slices.Contains(roles, RoleAdmin) {
+		roles = append(slices.Clone(roles), RoleAdmin)
+	}
+	if err := s.repo.UpdateExternalUser(ctx, user.UserName, identity.Email, roles); err != nil {
+		return nil, err
+	}
+	user.Email = identity.Email
+	user.Roles = roles
+	return user, nil
+}
+
+// page считается с 1, pageSize ограничивается MaxPageSize
+func (s *UsersService) ListUsers(ctx context.Context, query string, page, pageSize int) (*UsersPage, error) {
+	page = max(page, 1)
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	pageSize = min(pageSize, MaxPageSize)
+
+	users, total, err := s.repo.ListUsers(ctx, strings.TrimSpace(query), (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	res := &UsersPage{
+		Users:    make([]*UserSummary, 0, len(users)),
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}
+	for _, user := range users {
+		res.Users = append(res.Users, &UserSummary{
+			Profile:  *profileOf(user),
+			Provider: user.Provider,
+			Disabled: user.Disabled,
+		})
+	}
+	return res, nil
+}
+
+// отключенный пользователь не может войти; сессии и токены отзывает вызывающий
+func (s *UsersService) DisableUser(ctx context.Context, username string) error {
+	return s.repo.SetDisabled(ctx, username, true)
+}
+
+func (s *UsersService) EnableUser(ctx context.Context, username string) error {
+	return s.repo.SetDisabled(ctx, username, false)
+}
+
+// задачи, команды и наблюдатели ссылаются на логин, поэтому он не освобождается:
+// иначе новый пользователь с тем же логином получил бы доступ к чужим задачам.
+// Сессии и токены отзывает вызывающий
+func (s *UsersService) DeleteUser(ctx context.Context, username string) error {
+	return s.repo.DeleteUser(ctx, username)
+}
+
+// выдает роль admin пользователям из конфига; отсутствующие пропускаются,
+// чтобы роль не получил тот, кто первым зарегистрируется под этим логином
+func (s *UsersService) BootstrapAdmins(ctx context.Context, usernames []string) error {
+	for _, username := range usernames {
+		user, err := s.findUser(ctx, strings.TrimSpace(username))
+		if err == ErrNoUser {
+			s.logger.Warn("admin ", username, " is not registered")
+			continue
+		} else if err != nil {
+			return err
+		}
+		s.admins[user.UserName] = true
+		if user.HasRole(RoleAdmin) {
+			continue
+		}
+		if err := s.repo.AddRole(ctx, user.UserName, RoleAdmin); err != nil {
+			return err
+		}
+		s.logger.Info("granted admin role to ", user.UserName)
+	}
+	return nil
+}
+
+// возвращает ErrNoUser если юзера нет
+func (s *UsersService) GetUser(ctx context.Context, username string) (*User, error) {
+	return s.repo.GetUser(ctx, username)
+}
+
+func (s *UsersService) GetUsers(ctx context.Context, usernames []string) ([]*User, error) {
+	return s.repo.GetUsers(ctx, usernames)
+}
+
+func (s *UsersService) SetNotifications(ctx context.Context, username string, settings *NotificationSettings) error {
+	return s.repo.SetNotifications(ctx, username, settings)
+}
+
+// проверяет, что пользователь существует, иначе возвращает *UnknownUserError с похожими логинами
+func (s *UsersService) ValidateUser(ctx context.Context, username string) error {
+	_, err := s.repo.GetUser(ctx, username)
+	if err != ErrNoUser {
+		return err
+	}
+
+	// похожие ищутся среди логинов на ту же букву: их выборка идет по индексу,
+	// а опечатка в первой букве встречается реже остальных
+	first, _ := utf8.DecodeRuneInString(strings.ToLower(username))
+	if first == utf8.RuneError {
+		return &UnknownUserError{UserName: username, Suggestions: []string{}}
+	}
+	names, err := s.repo.GetUserNames(ctx, string(first), maxSuggestionCandidates)
+	if err != nil {
+		return err
+	}
+	suggestions := closeMatches(username, names)
+	return &UnknownUserError{
+		UserName:    username,
+		Suggestions: suggestions[:min(len(suggestions), maxSuggestions)],
+	}
+}
+
+// выбирает логины, отличающиеся от name не более чем на maxSuggestionDistance правок
+func closeMatches(name string, candidates []string) []string {
+	type match struct {
+		name string
+		dist int
+	}
+	lowered := strings.ToLower(name)
+	matches := []match{}
+	for _, c := range candidates {
+		d := levenshtein(lowered, strings.ToLower(c))
+		if d <= maxSuggestionDistance || strings.HasPrefix(strings.ToLower(c), lowered) {
+			matches = append(matches, match{c, d})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].dist != matches[j].dist {
+			return matches[i].dist < matches[j].dist
+		}
+		return matches[i].name < matches[j].name
+	})
+
+	res := make([]string, 0, len(matches))
+	for _, m := range matches {
+		res = append(res, m.name)
+	}
+	return res
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/RusGadzhiev/TaskManager/internal/config"
+	"go.uber.org/zap"
+)
+
+func (f *fakeUsersStorage) AddUser(ctx context.Context, user *User) error {
+	for name := range f.users {
+		if strings.EqualFold(name, user.UserName) {
+			return ErrUserExist
+		}
+	}
+	f.users[user.UserName] = user
+	return nil
+}
+
+func (f *fakeUsersStorage) AddRole(ctx context.Context, username, role string) error {
+	user, ok := f.users[username]
+	if !ok {
+		return ErrNoUser
+	}
+	if !user.HasRole(role) {
+		user.Roles = append(user.Roles, role)
+	}
+	return nil
+}
+
+func (f *fakeUsersStorage) UpdateExternalUser(ctx context.Context, username, email string, roles []string) error {
+	user, ok := f.users[username]
+	if !ok {
+		return ErrNoUser
+	}
+	user.Email = email
+	user.Roles = roles
+	return nil
+}
+
+func newTestUsersService() *UsersService {
+	repo := &fakeUsersStorage{users: map[string]*User{
+		// логин, созданный до приведения к нижнему регистру
+		"Alice": {UserName: "Alice", Password: "Password1"},
+		"bob":   {UserName: "bob", Password: "Password1"},
+	}}
+	policy := &config.PasswordPolicy{MinLength: 8, MaxLength: 128}
+	return NewUsersService(repo, nil, policy, nil, zap.NewNop().Sugar())
+}
+
+func TestAuthentificateUserNameCase(t *testing.T) {
+	tests := []struct {
+		login   string
+		want    string
+		wantErr error
+	}{
+		{"bob", "bob", nil},
+		{"BOB", "bob", nil},
+		{"Alice", "Alice", nil},
+		{"alice", "", ErrNoUser},
+		{"carol", "", ErrNoUser},
+	}
+	for _, tt := range tests {
+		t.Run(tt.login, func(t *testing.T) {
+			user := &User{UserName: tt.login, Password: "Password1"}
+			err := newTestUsersService().Authentificate(context.Background(), user)
+			if err != tt.wantErr {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && user.UserName != tt.want {
+				t.Errorf("logged in as %q, want %q", user.UserName, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddUserNameCase(t *testing.T) {
+	tests := []struct {
+		username string
+		want     string
+		wantErr  error
+	}{
+		{"Carol", "carol", nil},
+		{"BOB", "", ErrUserExist},
+		{"alice", "", ErrUserExist},
+	}
+	for _, tt := range tests {
+		t.Run(tt.username, func(t *testing.T) {
+			user := &User{UserName: tt.username, Password: "Password1"}
+			err := newTestUsersService().AddUser(context.Background(), user)
+			if err != tt.wantErr {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && user.UserName != tt.want {
+				t.Errorf("registered as %q, want %q", user.UserName, tt.want)
+			}
+		})
+	}
+}
+
+func TestBootstrapAdmins(t *testing.T) {
+	repo := &fakeUsersStorage{users: map[string]*User{
+		"Alice": {UserName: "Alice", Roles: []string{RoleUser}},
+		"bob":   {UserName: "bob", Roles: []string{RoleUser}},
+		"carol": {UserName: "carol", Roles: []string{RoleUser}},
+	}}
+	s := NewUsersService(repo, nil, nil, nil, zap.NewNop().Sugar())
+	if err := s.BootstrapAdmins(context.Background(), []string{"Alice", "BOB", "dave"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		username string
+		want     []string
+	}{
+		{"Alice", []string{RoleUser, RoleAdmin}},
+		{"bob", []string{RoleUser, RoleAdmin}},
+		{"carol", []string{RoleUser}},
+	}
+	for _, tt := range tests {
+		if got := repo.users[tt.username].Roles; strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s roles %v, want %v", tt.username, got, tt.want)
+		}
+	}
+	// отсутствующий в хранилище логин не резервируется за администратором
+	if _, ok := repo.users["dave"]; ok {
+		t.Error("admin dave created")
+	}
+}
+
+func TestLoginExternalKeepsConfigAdmin(t *testing.T) {
+	repo := &fakeUsersStorage{users: map[string]*User{
+		"alice": {UserName: "alice", Roles: []string{RoleUser}, Provider: "sso", Subject: "1"},
+		"bob":   {UserName: "bob", Roles: []string{RoleUser, RoleAdmin}, Provider: "sso", Subject: "2"},
+	}}
+	s := NewUsersService(repo, nil, nil, nil, zap.NewNop().Sugar())
+	ctx := context.Background()
+	if err := s.BootstrapAdmins(ctx, []string{"alice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		username string
+		subject  string
+		want     []string
+	}{
+		// admin из конфига переживает вход с ролями провайдера
+		{"alice", "1", []string{RoleUser, RoleAdmin}},
+		// роль, выданную только провайдером, провайдер и снимает
+		{"bob", "2", []string{RoleUser}},
+	}
+	for _, tt := range tests {
+		user, err := s.LoginExternal(ctx, &ExternalIdentity{Provider: "sso", Subject: tt.subject, UserName: tt.username, Roles: []string{RoleUser}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(user.Roles, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s returned roles %v, want %v", tt.username, user.Roles, tt.want)
+		}
+		if got := repo.users[tt.username].Roles; strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s stored roles %v, want %v", tt.username, got, tt.want)
+		}
+	}
+}
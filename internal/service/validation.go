@@ -0,0 +1,116 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/RusGadzhiev/TaskManager/internal/config"
+)
+
+var ErrValidation = errors.New("validation failed")
+
+// логин: 3-32 символа, латинские буквы, цифры, точка, подчеркивание и дефис, начинается с буквы или цифры
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{2,31}$`)
+
+// ValidationError содержит сообщение об ошибке для каждого неверного поля формы
+type ValidationError struct {
+	Fields map[string]string
+}
+
+func (e *ValidationError) Error() string {
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + ": " + e.Fields[name]
+	}
+	return ErrValidation.Error() + ": " + strings.Join(parts, "; ")
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrValidation
+}
+
+// проверяет данные регистрации, почту приводит к виду без имени
+func (s *UsersService) validateUser(user *User) error {
+	fields := map[string]string{}
+	if !usernamePattern.MatchString(user.UserName) {
+		fields[UserName] = "must be 3-32 characters: letters, digits, '.', '_' or '-', starting with a letter or digit"
+	}
+	if msg := checkPassword(s.policy, user.UserName, user.Password); msg != "" {
+		fields[Password] = msg
+	}
+	if user.Email != "" {
+		addr, err := mail.ParseAddress(user.Email)
+		if err != nil {
+			fields[Email] = ErrBadEmail.Error()
+		} else {
+			user.Email = addr.Address
+		}
+	}
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+func (s *UsersService) validateNewPassword(username, password string) error {
+	if msg := checkPassword(s.policy, username, password); msg != "" {
+		return &ValidationError{Fields: map[string]string{NewPassword: msg}}
+	}
+	return nil
+}
+
+// возвращает описание нарушенных правил или пустую строку
+func checkPassword(policy *config.PasswordPolicy, username, password string) string {
+	length := utf8.RuneCountInString(password)
+	if length < policy.MinLength {
+		return fmt.Sprintf("must be at least %d characters", policy.MinLength)
+	}
+	if policy.MaxLength > 0 && length > policy.MaxLength {
+		return fmt.Sprintf("must be at most %d characters", policy.MaxLength)
+	}
+	if username != "" && strings.EqualFold(password, username) {
+		return "must not be the same as the username"
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	missing := []string{}
+	if policy.RequireUpper && !upper {
+		missing = append(missing, "an uppercase letter")
+	}
+	if policy.RequireLower && !lower {
+		missing = append(missing, "a lowercase letter")
+	}
+	if policy.RequireDigit && !digit {
+		missing = append(missing, "a digit")
+	}
+	if policy.RequireSymbol && !symbol {
+		missing = append(missing, "a symbol")
+	}
+	if len(missing) > 0 {
+		return "must contain " + strings.Join(missing, ", ")
+	}
+	return ""
+}
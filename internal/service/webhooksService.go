@@ -0,0 +1,385 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+const (
+	SignatureHeader     = "X-TaskManager-Signature"
+	EventHeader         = "X-TaskManager-Event"
+	DeliveryHeader      = "X-TaskManager-Delivery"
+	IdempotencyHeader   = "X-TaskManager-Idempotency-Key"
+	deliveriesBatchSize = 50
+)
+
+var (
+	ErrNoSubscription = errors.New("no such webhook subscription")
+	ErrBadWebhookURL  = errors.New("webhook url must be absolute http(s) url")
+	ErrBadEventType   = errors.New("unknown event type")
+	// адрес вебхука указывает во внутреннюю сеть
+	ErrWebhookHostNotAllowed = errors.New("webhook host resolves to a loopback, private or link-local address")
+)
+
+// общий адрес провайдера (CGNAT) не входит в netip.Addr.IsPrivate
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// события, на которые можно подписаться
+var webhookEvents = map[string]bool{
+	EventTaskCreated:       true,
+	EventTaskAssigned:      true,
+	EventTaskUnassigned:    true,
+	EventTaskCompleted:     true,
+	EventTaskStatusChanged: true,
+}
+
+type WebhooksStorage interface {
+	// возвращает id созданной подписки
+	AddSubscription(ctx context.Context, sub *WebhookSubscription) (uint64, error)
+	// возвращает ошибку service.ErrNoSubscription если подписки нет
+	GetSubscription(ctx context.Context, id uint64) (*WebhookSubscription, error)
+	GetSubscriptions(ctx context.Context, owner string) ([]*WebhookSubscription, error)
+	GetAllSubscriptions(ctx context.Context) ([]*WebhookSubscription, error)
+	// удаляет подписку вместе с журналом отправок
+	DeleteSubscription(ctx context.Context, id uint64) error
+	// не добавляет повторную отправку события с тем же EventKey по той же подписке
+	AddDelivery(ctx context.Context, delivery *WebhookDelivery) error
+	// возвращает ожидающие отправки с NextAttemptAt не позже now и переносит их NextAttemptAt на until
+	ClaimDueDeliveries(ctx context.Context, now, until time.Time, limit int) ([]*WebhookDelivery, error)
+	UpdateDelivery(ctx context.Context, delivery *WebhookDelivery) error
+	// возвращает последние отправки по подписке, новые первыми
+	GetDeliveries(ctx context.Context, subscriptionId uint64, limit int) ([]*WebhookDelivery, error)
+}
+
+type WebhooksService struct {
+	repo   WebhooksStorage
+	client *http.Client
+	cfg    *config.Webhooks
+	logger *zap.SugaredLogger
+}
+
+func NewWebhooksService(repo WebhooksStorage, cfg *config.Webhooks, logger *zap.SugaredLogger) *WebhooksService {
+	// адрес проверяется и при подписке, и при каждом соединении:
+	// DNS имя могут перенаправить во внутреннюю сеть уже после проверки
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !cfg.AllowPrivateNetworks {
+		dialer.Control = checkDialAddress
+		// через прокси соединение шло бы не по адресу вебхука
+		transport.Proxy = nil
+	}
+	transport.DialContext = dialer.DialContext
+
+	return &WebhooksService{
+		repo:   repo,
+		client: &http.Client{Timeout: cfg.Timeout, Transport: transport},
+		cfg:    cfg,
+		logger: logger,
+	}
+}
+
+// возвращает ErrBadWebhookURL, ErrWebhookHostNotAllowed или ErrBadEventType при неверных параметрах подписки.
+// Без секрета он генерируется и возвращается в sub.Secret
+func (s *WebhooksService) AddSubscription(ctx context.Context, sub *WebhookSubscription) (uint64, error) {
+	u, err := url.Parse(sub.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return 0, ErrBadWebhookURL
+	}
+	if err := s.checkHost(ctx, u.Hostname()); err != nil {
+		return 0, err
+	}
+	if len(sub.Events) == 0 {
+		return 0, ErrBadEventType
+	}
+	for _, event := range sub.Events {
+		if !webhookEvents[event] {
+			return 0, fmt.Errorf("%w: %s", ErrBadEventType, event)
+		}
+	}
+	if sub.Secret == "" {
+		if sub.Secret, err = randomHex(32); err != nil {
+			return 0, err
+		}
+	}
+	sub.CreatedAt = time.Now()
+	return s.repo.AddSubscription(ctx, sub)
+}
+
+// все адреса хоста должны быть публичными
+func (s *WebhooksService) checkHost(ctx context.Context, host string) error {
+	if s.cfg.AllowPrivateNetworks {
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrBadWebhookURL, err)
+	}
+	for _, addr := range addrs {
+		if !publicAddr(addr) {
+			return ErrWebhookHostNotAllowed
+		}
+	}
+	return nil
+}
+
+// вызывается для уже разрешенного адреса перед соединением
+func checkDialAddress(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !publicAddr(addrPort.Addr()) {
+		return ErrWebhookHostNotAllowed
+	}
+	return nil
+}
+
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+func (s *WebhooksService) GetSubscriptions(ctx context.Context, owner string) ([]*WebhookSubscription, error) {
+	return s.repo.GetSubscriptions(ctx, owner)
+}
+
+// возвращает ErrNoSubscription, если подписки нет или она принадлежит другому пользователю
+func (s *WebhooksService) DeleteSubscription(ctx context.Context, id uint64, owner string) error {
+	if _, err := s.ownSubscription(ctx, id, owner); err != nil {
+		return err
+	}
+	return s.repo.DeleteSubscription(ctx, id)
+}
+
+// журнал отправок по подписке владельца
+func (s *WebhooksService) GetDeliveries(ctx context.Context, id uint64, owner string, limit int) ([]*WebhookDelivery, error) {
+	if _, err := s.ownSubscription(ctx, id, owner); err != nil {
+		return nil, err
+	}
+	return s.repo.GetDeliveries(ctx, id, limit)
+}
+
+func (s *WebhooksService) ownSubscription(ctx context.Context, id uint64, owner string) (*WebhookSubscription, error) {
+	sub, err := s.repo.GetSubscription(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if sub.Owner != owner {
+		return nil, ErrNoSubscription
+	}
+	return sub, nil
+}
+
+// ставит событие в очередь отправки по всем подходящим подпискам.
+// Владелец подписки получает только события видимых ему задач.
+// Повторно опубликованное событие с тем же ключом в очередь не попадает
+func (s *WebhooksService) Publish(ctx context.Context, event *TaskEvent) error {
+	subs, err := s.repo.GetAllSubscriptions(ctx)
+	if err != nil {
+		return fmt.Errorf("webhooks: %w", err)
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("webhooks: %w", err)
+	}
+
+	errs := []error{}
+	now := time.Now()
+	for _, sub := range subs {
+		if !subscribed(sub, event.Type) || !event.VisibleTo(sub.Owner) {
+			continue
+		}
+		err = s.repo.AddDelivery(ctx, &WebhookDelivery{
+			SubscriptionID: sub.ID,
+			EventKey:       event.Key,
+			EventType:      event.Type,
+			Payload:        string(payload),
+			Status:         DeliveryPending,
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("webhooks: subscription %d: %w", sub.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// отправляет ожидающие вебхуки, пока не отменен ctx
+func (s *WebhooksService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.deliverDue(ctx)
+		}
+	}
+}
+
+// отправки выбираются с арендой на cfg.Lease и идут параллельно в cfg.Workers потоков
+func (s *WebhooksService) deliverDue(ctx context.Context) {
+	now := time.Now()
+	deliveries, err := s.repo.ClaimDueDeliveries(WithPolling(ctx), now, now.Add(s.cfg.Lease), deliveriesBatchSize)
+	if err != nil {
+		s.logger.Error("webhooks: ", err.Error())
+		return
+	}
+	if len(deliveries) == 0 {
+		return
+	}
+	ctx, span := tracer.Start(ctx, "webhooks.deliver", trace.WithAttributes(attribute.Int("deliveries", len(deliveries))))
+	defer span.End()
+
+	queue := make(chan *WebhookDelivery)
+	var wg sync.WaitGroup
+	for range max(s.cfg.Workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for delivery := range queue {
+				s.deliver(ctx, delivery)
+			}
+		}()
+	}
+	for _, delivery := range deliveries {
+		queue <- delivery
+	}
+	close(queue)
+	wg.Wait()
+}
+
+func (s *WebhooksService) deliver(ctx context.Context, delivery *WebhookDelivery) {
+	sub, err := s.repo.GetSubscription(ctx, delivery.SubscriptionID)
+	if err == ErrNoSubscription {
+		return
+	} else if err != nil {
+		s.logger.Error("webhooks: ", err.Error())
+		return
+	}
+
+	s.attempt(ctx, sub, delivery)
+	if err := s.repo.UpdateDelivery(ctx, delivery); err != nil {
+		s.logger.Error("webhooks: ", err.Error())
+	}
+}
+
+// делает одну попытку отправки и обновляет состояние delivery
+func (s *WebhooksService) attempt(ctx context.Context, sub *WebhookSubscription, delivery *WebhookDelivery) {
+	delivery.Attempts++
+	code, err := s.send(ctx, sub, delivery)
+	delivery.ResponseCode = code
+
+	if err == nil {
+		now := time.Now()
+		delivery.Status = DeliveryDelivered
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+		return
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= s.cfg.MaxAttempts {
+		delivery.Status = DeliveryFailed
+		s.logger.Info("webhook delivery ", delivery.ID, " failed after ", delivery.Attempts, " attempts: ", err.Error())
+		return
+	}
+	delivery.NextAttemptAt = time.Now().Add(s.backoff(delivery.Attempts))
+}
+
+// получатель может продолжить трассу по заголовку traceparent
+func (s *WebhooksService) send(ctx context.Context, sub *WebhookSubscription, delivery *WebhookDelivery) (code int, err error) {
+	ctx, span := tracer.Start(ctx, "webhooks.send",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(http.MethodPost),
+			attribute.Int64("webhook.delivery_id", int64(delivery.ID)),
+			attribute.String("webhook.event", delivery.EventType),
+		),
+	)
+	defer func() {
+		if code != 0 {
+			span.SetAttributes(semconv.HTTPResponseStatusCode(code))
+		}
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewBufferString(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, strconv.FormatUint(delivery.ID, 10))
+	req.Header.Set(IdempotencyHeader, delivery.EventKey)
+	req.Header.Set(SignatureHeader, Sign(sub.Secret, []byte(delivery.Payload)))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// экспоненциальная задержка перед следующей попыткой: BaseBackoff * 2^(attempts-1), не больше MaxBackoff
+func (s *WebhooksService) backoff(attempts int) time.Duration {
+	d := s.cfg.BaseBackoff
+	for i := 1; i < attempts && d < s.cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, s.cfg.MaxBackoff)
+}
+
+// подпись тела запроса в формате sha256=<hex HMAC-SHA256>
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func subscribed(sub *WebhookSubscription, eventType string) bool {
+	for _, event := range sub.Events {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,426 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+)
+
+// хранилище подписок и отправок в памяти
+type fakeWebhooksStorage struct {
+	mu         sync.Mutex
+	subs       map[uint64]*WebhookSubscription
+	deliveries map[uint64]*WebhookDelivery
+	lastID     uint64
+}
+
+func newFakeWebhooksStorage() *fakeWebhooksStorage {
+	return &fakeWebhooksStorage{
+		subs:       map[uint64]*WebhookSubscription{},
+		deliveries: map[uint64]*WebhookDelivery{},
+	}
+}
+
+func (f *fakeWebhooksStorage) AddSubscription(ctx context.Context, sub *WebhookSubscription) (uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lastID++
+	sub.ID = f.lastID
+	f.subs[sub.ID] = sub
+	return sub.ID, nil
+}
+
+func (f *fakeWebhooksStorage) GetSubscription(ctx context.Context, id uint64) (*WebhookSubscription, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sub, ok := f.subs[id]
+	if !ok {
+		return nil, ErrNoSubscription
+	}
+	return sub, nil
+}
+
+func (f *fakeWebhooksStorage) GetSubscriptions(ctx context.Context, owner string) ([]*WebhookSubscription, error) {
+	subs, _ := f.GetAllSubscriptions(ctx)
+	res := []*WebhookSubscription{}
+	for _, sub := range subs {
+		if sub.Owner == owner {
+			res = append(res, sub)
+		}
+	}
+	return res, nil
+}
+
+func (f *fakeWebhooksStorage) GetAllSubscriptions(ctx context.Context) ([]*WebhookSubscription, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	subs := []*WebhookSubscription{}
+	for _, sub := range f.subs {
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
+
+func (f *fakeWebhooksStorage) DeleteSubscription(ctx context.Context, id uint64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.subs, id)
+	return nil
+}
+
+func (f *fakeWebhooksStorage) AddDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, d := range f.deliveries {
+		if d.SubscriptionID == delivery.SubscriptionID && d.EventKey == delivery.EventKey {
+			return nil
+		}
+	}
+	f.lastID++
+	delivery.ID = f.lastID
+	copied := *delivery
+	f.deliveries[delivery.ID] = &copied
+	return nil
+}
+
+func (f *fakeWebhooksStorage) ClaimDueDeliveries(ctx context.Context, now, until time.Time, limit int) ([]*WebhookDelivery, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	res := []*WebhookDelivery{}
+	for _, d := range f.deliveries {
+		if d.Status == DeliveryPending && !d.NextAttemptAt.After(now) && len(res) < limit {
+			d.NextAttemptAt = until
+			copied := *d
+			res = append(res, &copied)
+		}
+	}
+	return res, nil
+}
+
+func (f *fakeWebhooksStorage) UpdateDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	copied := *delivery
+	f.deliveries[delivery.ID] = &copied
+	return nil
+}
+
+func (f *fakeWebhooksStorage) GetDeliveries(ctx context.Context, subscriptionId uint64, limit int) ([]*WebhookDelivery, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	res := []*WebhookDelivery{}
+	for _, d := range f.deliveries {
+		if d.SubscriptionID == subscriptionId {
+			copied := *d
+			res = append(res, &copied)
+		}
+	}
+	return res, nil
+}
+
+// делает все отправки снова доступными, как будто задержка уже прошла
+func (f *fakeWebhooksStorage) expireBackoff() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, d := range f.deliveries {
+		d.NextAttemptAt = time.Now().Add(-time.Second)
+	}
+}
+
+func testWebhooksConfig() *config.Webhooks {
+	return &config.Webhooks{
+		MaxAttempts:          3,
+		BaseBackoff:          time.Second,
+		MaxBackoff:           4 * time.Second,
+		PollInterval:         time.Second,
+		Timeout:              5 * time.Second,
+		Workers:              2,
+		Lease:                time.Minute,
+		AllowPrivateNetworks: true,
+	}
+}
+
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+// поднимает получателя, отвечающего кодами из statuses по очереди
+func newReceiver(t *testing.T, statuses ...int) (*httptest.Server, <-chan receivedWebhook) {
+	t.Helper()
+	received := make(chan receivedWebhook, 16)
+	var mu sync.Mutex
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- receivedWebhook{header: r.Header.Clone(), body: body}
+
+		mu.Lock()
+		status := statuses[min(calls, len(statuses)-1)]
+		calls++
+		mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, received
+}
+
+func testEvent(key string) *TaskEvent {
+	return &TaskEvent{
+		Key:       key,
+		Type:      EventTaskCompleted,
+		Task:      &Task{ID: 1, Owner: "alice"},
+		CreatedAt: time.Now(),
+	}
+}
+
+func TestWebhookDeliveryRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantStatus   string
+		wantAttempts int
+		wantCode     int
+	}{
+		{"delivered at once", []int{http.StatusOK}, DeliveryDelivered, 1, http.StatusOK},
+		{"delivered after retry", []int{http.StatusInternalServerError, http.StatusNoContent}, DeliveryDelivered, 2, http.StatusNoContent},
+		{"failed after max attempts", []int{http.StatusBadGateway}, DeliveryFailed, 3, http.StatusBadGateway},
+		{"redirect is not success", []int{http.StatusNotModified}, DeliveryFailed, 3, http.StatusNotModified},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, received := newReceiver(t, tt.statuses...)
+			repo := newFakeWebhooksStorage()
+			s := NewWebhooksService(repo, testWebhooksConfig(), zap.NewNop().Sugar())
+			ctx := context.Background()
+
+			_, err := s.AddSubscription(ctx, &WebhookSubscription{
+				Owner:  "alice",
+				URL:    srv.URL,
+				Secret: "secret",
+				Events: []string{EventTaskCompleted},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.Publish(ctx, testEvent("key-1"))
+
+			for range testWebhooksConfig().MaxAttempts + 1 {
+				s.deliverDue(ctx)
+				repo.expireBackoff()
+			}
+
+			deliveries, _ := repo.GetDeliveries(ctx, 1, 10)
+			if len(deliveries) != 1 {
+				t.Fatalf("got %d deliveries, want 1", len(deliveries))
+			}
+			d := deliveries[0]
+			if d.Status != tt.wantStatus || d.Attempts != tt.wantAttempts || d.ResponseCode != tt.wantCode {
+				t.Errorf("got status %s, attempts %d, code %d, want %s, %d, %d",
+					d.Status, d.Attempts, d.ResponseCode, tt.wantStatus, tt.wantAttempts, tt.wantCode)
+			}
+			if len(received) != tt.wantAttempts {
+				t.Errorf("receiver got %d requests, want %d", len(received), tt.wantAttempts)
+			}
+
+			req := <-received
+			if got, want := req.header.Get(SignatureHeader), Sign("secret", req.body); got != want {
+				t.Errorf("signature %q, want %q", got, want)
+			}
+			if got := req.header.Get(IdempotencyHeader); got != "key-1" {
+				t.Errorf("idempotency key %q, want key-1", got)
+			}
+			if got := req.header.Get(EventHeader); got != EventTaskCompleted {
+				t.Errorf("event header %q, want %s", got, EventTaskCompleted)
+			}
+		})
+	}
+}
+
+func TestWebhookPublishFiltersAndDeduplicates(t *testing.T) {
+	srv, received := newReceiver(t, http.StatusOK)
+	repo := newFakeWebhooksStorage()
+	s := NewWebhooksService(repo, testWebhooksConfig(), zap.NewNop().Sugar())
+	ctx := context.Background()
+
+	for _, sub := range []*WebhookSubscription{
+		{Owner: "alice", URL: srv.URL, Events: []string{EventTaskCompleted}},
+		// не подписан на событие
+		{Owner: "alice", URL: srv.URL, Events: []string{EventTaskCreated}},
+		// задача ему не видна
+		{Owner: "bob", URL: srv.URL, Events: []string{EventTaskCompleted}},
+	} {
+		if _, err := s.AddSubscription(ctx, sub); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s.Publish(ctx, testEvent("key-1"))
+	s.Publish(ctx, testEvent("key-1"))
+	s.deliverDue(ctx)
+
+	if len(received) != 1 {
+		t.Errorf("receiver got %d requests, want 1", len(received))
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	s := NewWebhooksService(newFakeWebhooksStorage(), testWebhooksConfig(), zap.NewNop().Sugar())
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{10, 4 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := s.backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestAddSubscriptionValidation(t *testing.T) {
+	cfg := testWebhooksConfig()
+	cfg.AllowPrivateNetworks = false
+	s := NewWebhooksService(newFakeWebhooksStorage(), cfg, zap.NewNop().Sugar())
+
+	tests := []struct {
+		name    string
+		url     string
+		events  []string
+		wantErr error
+	}{
+		{"public address", "https://8.8.8.8/hook", []string{EventTaskCreated}, nil},
+		{"not http", "ftp://8.8.8.8/hook", []string{EventTaskCreated}, ErrBadWebhookURL},
+		{"relative", "/hook", []string{EventTaskCreated}, ErrBadWebhookURL},
+		{"loopback", "http://127.0.0.1:8080/hook", []string{EventTaskCreated}, ErrWebhookHostNotAllowed},
+		{"ipv6 loopback", "http://[::1]/hook", []string{EventTaskCreated}, ErrWebhookHostNotAllowed},
+		{"private", "http://10.1.2.3/hook", []string{EventTaskCreated}, ErrWebhookHostNotAllowed},
+		{"link-local metadata", "http://169.254.169.254/latest", []string{EventTaskCreated}, ErrWebhookHostNotAllowed},
+		{"shared address space", "http://100.64.0.1/hook", []string{EventTaskCreated}, ErrWebhookHostNotAllowed},
+		{"unspecified", "http://0.0.0.0/hook", []string{EventTaskCreated}, ErrWebhookHostNotAllowed},
+		{"ipv4-mapped loopback", "http://[::ffff:127.0.0.1]/hook", []string{EventTaskCreated}, ErrWebhookHostNotAllowed},
+		{"no events", "https://8.8.8.8/hook", nil, ErrBadEventType},
+		{"unknown event", "https://8.8.8.8/hook", []string{"task_deleted"}, ErrBadEventType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.AddSubscription(context.Background(), &WebhookSubscription{Owner: "alice", URL: tt.url, Events: tt.events})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAddSubscriptionSecret(t *testing.T) {
+	s := NewWebhooksService(newFakeWebhooksStorage(), testWebhooksConfig(), zap.NewNop().Sugar())
+	ctx := context.Background()
+
+	generated := &WebhookSubscription{Owner: "alice", URL: "https://8.8.8.8/hook", Events: []string{EventTaskCreated}}
+	if _, err := s.AddSubscription(ctx, generated); err != nil {
+		t.Fatal(err)
+	}
+	if len(generated.Secret) != 64 {
+		t.Errorf("generated secret %q, want 64 hex chars", generated.Secret)
+	}
+
+	given := &WebhookSubscription{Owner: "alice", URL: "https://8.8.8.8/hook", Secret: "mine", Events: []string{EventTaskCreated}}
+	if _, err := s.AddSubscription(ctx, given); err != nil {
+		t.Fatal(err)
+	}
+	if given.Secret != "mine" {
+		t.Errorf("secret %q was replaced", given.Secret)
+	}
+}
+
+// подписка могла пройти проверку, а имя потом стало указывать на внутренний адрес
+func TestWebhookDialRejectsPrivateAddress(t *testing.T) {
+	srv, received := newReceiver(t, http.StatusOK)
+	repo := newFakeWebhooksStorage()
+	cfg := testWebhooksConfig()
+	cfg.AllowPrivateNetworks = false
+	s := NewWebhooksService(repo, cfg, zap.NewNop().Sugar())
+	ctx := context.Background()
+
+	repo.AddSubscription(ctx, &WebhookSubscription{Owner: "alice", URL: srv.URL, Secret: "secret", Events: []string{EventTaskCompleted}})
+	s.Publish(ctx, testEvent("key-1"))
+	s.deliverDue(ctx)
+
+	deliveries, _ := repo.GetDeliveries(ctx, 1, 10)
+	if len(deliveries) != 1 {
+		t.Fatalf("got %d deliveries, want 1", len(deliveries))
+	}
+	d := deliveries[0]
+	if d.Status != DeliveryPending || d.Attempts != 1 || d.LastError == "" {
+		t.Errorf("got status %s, attempts %d, error %q", d.Status, d.Attempts, d.LastError)
+	}
+	if len(received) != 0 {
+		t.Errorf("receiver got %d requests, want 0", len(received))
+	}
+}
+
+func TestWebhookTraceparent(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+
+	srv, received := newReceiver(t, http.StatusOK)
+	repo := newFakeWebhooksStorage()
+	s := NewWebhooksService(repo, testWebhooksConfig(), zap.NewNop().Sugar())
+	ctx := context.Background()
+
+	// пустой опрос трассу не начинает
+	s.deliverDue(ctx)
+	if spans := recorder.Ended(); len(spans) != 0 {
+		t.Fatalf("empty poll recorded %d spans", len(spans))
+	}
+
+	_, err := s.AddSubscription(ctx, &WebhookSubscription{Owner: "alice", URL: srv.URL, Secret: "secret", Events: []string{EventTaskCompleted}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Publish(ctx, testEvent("key-1"))
+	s.deliverDue(ctx)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	deliver, send := spans["webhooks.deliver"], spans["webhooks.send"]
+	if deliver == nil || send == nil {
+		t.Fatalf("recorded spans %v", spans)
+	}
+	if send.Parent().SpanID() != deliver.SpanContext().SpanID() {
+		t.Error("send span is not a child of the deliver span")
+	}
+
+	req := <-received
+	want := fmt.Sprintf("00-%s-%s-01", send.SpanContext().TraceID(), send.SpanContext().SpanID())
+	if got := req.header.Get("traceparent"); got != want {
+		t.Errorf("traceparent %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,77 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// после стольких записей при следующей вставке удаляются истекшие
+const sweepThreshold = 10000
+
+type counter struct {
+	count   int64
+	expires time.Time
+}
+
+// счетчики неудачных входов в памяти процесса, не разделяются между экземплярами сервиса
+type AttemptsRepoMemory struct {
+	mu       sync.Mutex
+	counters map[string]*counter
+}
+
+func NewAttemptsRepoMemory() *AttemptsRepoMemory {
+	return &AttemptsRepoMemory{
+		counters: make(map[string]*counter),
+	}
+}
+
+func (repo *AttemptsRepoMemory) RegisterFailure(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	now := time.Now()
+	c, ok := repo.counters[key]
+	if !ok || now.After(c.expires) {
+		if len(repo.counters) >= sweepThreshold {
+			repo.sweep(now)
+		}
+		c = &counter{}
+		repo.counters[key] = c
+	}
+	c.count++
+	c.expires = now.Add(ttl)
+	return c.count, nil
+}
+
+func (repo *AttemptsRepoMemory) Failures(ctx context.Context, key string) (int64, time.Duration, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	c, ok := repo.counters[key]
+	if !ok {
+		return 0, 0, nil
+	}
+	left := time.Until(c.expires)
+	if left <= 0 {
+		delete(repo.counters, key)
+		return 0, 0, nil
+	}
+	return c.count, left, nil
+}
+
+func (repo *AttemptsRepoMemory) Reset(ctx context.Context, key string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	delete(repo.counters, key)
+	return nil
+}
+
+func (repo *AttemptsRepoMemory) sweep(now time.Time) {
+	for key, c := range repo.counters {
+		if now.After(c.expires) {
+			delete(repo.counters, key)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// счетчики неудачных входов в том же redis, что и сессии
+type AttemptsRepoRedis struct {
+	DB *redis.Client
+}
+
+func NewAttemptsRepoRedis(db *redis.Client) *AttemptsRepoRedis {
+	return &AttemptsRepoRedis{
+		DB: db,
+	}
+}
+
+func (repo *AttemptsRepoRedis) RegisterFailure(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	var incr *redis.IntCmd
+	_, err := repo.DB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, key)
+		pipe.Expire(ctx, key, ttl)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("incr redis error: %w", err)
+	}
+	return incr.Val(), nil
+}
+
+func (repo *AttemptsRepoRedis) Failures(ctx context.Context, key string) (int64, time.Duration, error) {
+	var get *redis.StringCmd
+	var ttl *redis.DurationCmd
+	_, err := repo.DB.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, key)
+		ttl = pipe.TTL(ctx, key)
+		return nil
+	})
+	if err == redis.Nil {
+		return 0, 0, nil
+	} else if err != nil {
+		return 0, 0, fmt.Errorf("get redis error: %w", err)
+	}
+	count, err := get.Int64()
+	if err != nil {
+		return 0, 0, fmt.Errorf("get redis error: %w", err)
+	}
+	return count, max(ttl.Val(), 0), nil
+}
+
+func (repo *AttemptsRepoRedis) Reset(ctx context.Context, key string) error {
+	_, err := repo.DB.Del(ctx, key).Result()
+	if err != nil {
+		return fmt.Errorf("delete redis error: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+)
+
+var (
+	ErrCreatingTableMySQL = errors.New("error of creating mail queue table")
+)
+
+type MailRepoMySQL struct {
+	DB *sql.DB
+}
+
+// использует подключение к базе задач
+func NewMailRepoMySQL(ctx context.Context, db *sql.DB) *MailRepoMySQL {
+	query := `
+		CREATE TABLE IF NOT EXISTS mail_queue (
+					id 				BIGINT PRIMARY KEY AUTO_INCREMENT,
+					mail_key 		CHAR(64) NOT NULL UNIQUE,
+					recipient 		VARCHAR(255) NOT NULL,
+					subject 		TEXT NOT NULL,
+					body 			MEDIUMTEXT NOT NULL,
+					status 			VARCHAR(16) NOT NULL,
+					attempts 		INT NOT NULL DEFAULT 0,
+					last_error 		TEXT,
+					next_attempt_at DATETIME(3) NOT NULL,
+					created_at 		DATETIME(3) NOT NULL,
+					sent_at 		DATETIME(3) NULL,
+					INDEX idx_mail_due (status, next_attempt_at)
+		)`
+
+	_, err := db.ExecContext(ctx, query)
+	if err != nil {
+		log.Fatalf("Error %s, Description: %s", err, ErrCreatingTableMySQL)
+	}
+
+	return &MailRepoMySQL{DB: db}
+}
+
+func (repo *MailRepoMySQL) AddMail(ctx context.Context, m *service.Mail) error {
+	res, err := repo.DB.ExecContext(ctx,
+		"INSERT IGNORE INTO mail_queue (`mail_key`, `recipient`, `subject`, `body`, `status`, `attempts`, `next_attempt_at`, `created_at`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		m.Key,
+		m.To,
+		m.Subject,
+		m.Body,
+		m.Status,
+		m.Attempts,
+		m.NextAttemptAt,
+		m.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("insert mysql error: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("insert (last inserted ID) mysql error: %w", err)
+	}
+	m.ID = uint64(id)
+	return nil
+}
+
+const selectMails = "SELECT id, mail_key, recipient, subject, body, status, attempts, COALESCE(last_error, ''), " +
+	"next_attempt_at, created_at, sent_at FROM mail_queue"
+
+// письма, выбранные другим экземпляром, пропускаются, а выбранные откладываются до until
+func (repo *MailRepoMySQL) ClaimDueMails(ctx context.Context, now, until time.Time, limit int) ([]*service.Mail, error) {
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx mysql error: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx,
+		selectMails+" WHERE status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at LIMIT ? FOR UPDATE SKIP LOCKED",
+		service.DeliveryPending, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("select mysql error: %w", err)
+	}
+	mails, err := scanMails(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(mails) == 0 {
+		return mails, nil
+	}
+
+	args := []interface{}{until}
+	for _, m := range mails {
+		args = append(args, m.ID)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(mails)), ",")
+	_, err = tx.ExecContext(ctx, "UPDATE mail_queue SET `next_attempt_at` = ? WHERE id IN ("+placeholders+")", args...)
+	if err != nil {
+		return nil, fmt.Errorf("update mysql error: %w", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit mysql error: %w", err)
+	}
+	return mails, nil
+}
+
+func (repo *MailRepoMySQL) UpdateMail(ctx context.Context, m *service.Mail) error {
+	_, err := repo.DB.ExecContext(ctx,
+		"UPDATE mail_queue SET `status` = ?, `attempts` = ?, `last_error` = ?, `next_attempt_at` = ?, `sent_at` = ? WHERE id = ?",
+		m.Status,
+		m.Attempts,
+		m.LastError,
+		m.NextAttemptAt,
+		m.SentAt,
+		m.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("update mysql error: %w", err)
+	}
+	return nil
+}
+
+func (repo *MailRepoMySQL) DeleteFinishedMails(ctx context.Context, before time.Time) error {
+	_, err := repo.DB.ExecContext(ctx, "DELETE FROM mail_queue WHERE status <> ? AND created_at < ?", service.DeliveryPending, before)
+	if err != nil {
+		return fmt.Errorf("delete mysql error: %w", err)
+	}
+	return nil
+}
+
+func scanMails(rows *sql.Rows) ([]*service.Mail, error) {
+	defer rows.Close()
+
+	mails := []*service.Mail{}
+	for rows.Next() {
+		m := &service.Mail{}
+		var sentAt sql.NullTime
+		err := rows.Scan(&m.ID, &m.Key, &m.To, &m.Subject, &m.Body, &m.Status, &m.Attempts, &m.LastError,
+			&m.NextAttemptAt, &m.CreatedAt, &sentAt)
+		if err != nil {
+			return nil, fmt.Errorf("scanning mysql error: %w", err)
+		}
+		if sentAt.Valid {
+			m.SentAt = &sentAt.Time
+		}
+		mails = append(mails, m)
+	}
+	return mails, nil
+}
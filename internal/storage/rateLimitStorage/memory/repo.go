@@ -0,0 +1,62 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// после стольких корзин при следующей вставке удаляются полные
+const sweepThreshold = 10000
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// к этому моменту корзина наполнится и ее можно забыть
+	full time.Time
+}
+
+// корзины ограничения запросов в памяти процесса, не разделяются между экземплярами сервиса
+type RateLimitRepoMemory struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func NewRateLimitRepoMemory() *RateLimitRepoMemory {
+	return &RateLimitRepoMemory{
+		buckets: make(map[string]*bucket),
+	}
+}
+
+func (repo *RateLimitRepoMemory) Take(ctx context.Context, key string, rate float64, burst int) (bool, float64, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	now := time.Now()
+	b, ok := repo.buckets[key]
+	if !ok {
+		if len(repo.buckets) >= sweepThreshold {
+			repo.sweep(now)
+		}
+		b = &bucket{tokens: float64(burst), updated: now}
+		repo.buckets[key] = b
+	}
+	b.tokens = min(float64(burst), b.tokens+now.Sub(b.updated).Seconds()*rate)
+	b.updated = now
+
+	allowed := false
+	if b.tokens >= 1 {
+		b.tokens--
+		allowed = true
+	}
+	b.full = now.Add(time.Duration((float64(burst) - b.tokens) / rate * float64(time.Second)))
+	return allowed, b.tokens, nil
+}
+
+func (repo *RateLimitRepoMemory) sweep(now time.Time) {
+	for key, b := range repo.buckets {
+		if now.After(b.full) {
+			delete(repo.buckets, key)
+		}
+	}
+}
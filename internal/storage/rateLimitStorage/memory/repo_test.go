@@ -0,0 +1,65 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTake(t *testing.T) {
+	const (
+		rate  = 2.0
+		burst = 3
+	)
+	// шаги идут по порядку с одной корзиной; elapsed - сколько прошло с предыдущего шага
+	steps := []struct {
+		name       string
+		elapsed    time.Duration
+		wantOK     bool
+		wantTokens float64
+	}{
+		{"first request", 0, true, 2},
+		{"second request", 0, true, 1},
+		{"third request", 0, true, 0},
+		{"burst exhausted", 0, false, 0},
+		{"half a token refilled", 250 * time.Millisecond, false, 0.5},
+		{"one token refilled", 250 * time.Millisecond, true, 0},
+		{"refill is capped by burst", time.Hour, true, 2},
+	}
+
+	repo := NewRateLimitRepoMemory()
+	ctx := context.Background()
+	for _, st := range steps {
+		if b, ok := repo.buckets["key"]; ok {
+			b.updated = b.updated.Add(-st.elapsed)
+		}
+		ok, tokens, err := repo.Take(ctx, "key", rate, burst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// время между шагами тоже пополняет корзину, поэтому токены сравниваются приблизительно
+		if ok != st.wantOK || tokens < st.wantTokens || tokens > st.wantTokens+0.01 {
+			t.Errorf("%s: got %v, %.3f tokens, want %v, %.3f", st.name, ok, tokens, st.wantOK, st.wantTokens)
+		}
+	}
+
+	if ok, _, _ := repo.Take(ctx, "other", rate, burst); !ok {
+		t.Error("buckets of different keys are shared")
+	}
+}
+
+func TestSweep(t *testing.T) {
+	repo := NewRateLimitRepoMemory()
+	ctx := context.Background()
+	repo.Take(ctx, "full", 1, 1)
+	repo.Take(ctx, "empty", 1, 1)
+	repo.buckets["full"].full = time.Now().Add(-time.Second)
+
+	repo.sweep(time.Now())
+	if _, ok := repo.buckets["full"]; ok {
+		t.Error("full bucket is kept")
+	}
+	if _, ok := repo.buckets["empty"]; !ok {
+		t.Error("bucket that is not full is removed")
+	}
+}
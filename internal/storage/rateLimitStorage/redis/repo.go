@@ -0,0 +1,60 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// корзины ограничения запросов в том же redis, что и сессии, общие для всех экземпляров сервиса
+type RateLimitRepoRedis struct {
+	DB *redis.Client
+}
+
+func NewRateLimitRepoRedis(db *redis.Client) *RateLimitRepoRedis {
+	return &RateLimitRepoRedis{
+		DB: db,
+	}
+}
+
+// корзина пополняется по времени сервера redis, чтобы расхождение часов экземпляров не влияло на лимит.
+// Ключ живет, пока корзина не наполнится, после этого он не нужен
+var takeScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "updated")
+local tokens = tonumber(bucket[1]) or burst
+local updated = tonumber(bucket[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - updated) * rate / 1000)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "updated", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil((burst - tokens) / rate * 1000) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+func (repo *RateLimitRepoRedis) Take(ctx context.Context, key string, rate float64, burst int) (bool, float64, error) {
+	res, err := takeScript.Run(ctx, repo.DB, []string{key}, rate, burst).Slice()
+	if err != nil {
+		return false, 0, fmt.Errorf("rate limit redis error: %w", err)
+	}
+	if len(res) != 2 {
+		return false, 0, fmt.Errorf("rate limit redis error: unexpected reply %v", res)
+	}
+	allowed, _ := res[0].(int64)
+	raw, _ := res[1].(string)
+	tokens, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return false, 0, fmt.Errorf("rate limit redis error: %w", err)
+	}
+	return allowed == 1, tokens, nil
+}
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/RusGadzhiev/TaskManager/internal/config"
@@ -14,7 +16,8 @@ import (
 )
 
 var (
-	ErrPingRedis = errors.New("error of ping redis db")
+	ErrPingRedis      = errors.New("error of ping redis db")
+	ErrMigratingRedis = errors.New("error of migrating redis sessions")
 )
 
 type SessionsRepoRedis struct {
@@ -23,7 +26,7 @@ type SessionsRepoRedis struct {
 
 func NewSessionsRepoRedis(ctx context.Context, cfg *config.RedisDb) *SessionsRepoRedis {
 	rdb := redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf(cfg.Host + ":" + cfg.Port),
+		Addr:     cfg.Host + ":" + cfg.Port,
 		Password: "",
 		DB:       0,
 	})
@@ -33,11 +36,52 @@ func NewSessionsRepoRedis(ctx context.Context, cfg *config.RedisDb) *SessionsRep
 		log.Fatalf("Error: %s, Description: %s", err, ErrPingRedis)
 	}
 
+	if err := migrateSessionKeys(ctx, rdb); err != nil {
+		log.Fatalf("Error: %s, Description: %s", err, ErrMigratingRedis)
+	}
+
 	return &SessionsRepoRedis{
 		DB: rdb,
 	}
 }
 
+// переносит сессию с ключа, равного значению куки, на ключ по хэшу, если сведения о сессии еще ссылаются на старый ключ
+var moveSessionScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], "key") ~= ARGV[1] then
+	return 0
+end
+if redis.call("EXISTS", KEYS[2]) == 1 then
+	redis.call("RENAME", KEYS[2], KEYS[3])
+end
+redis.call("HSET", KEYS[1], "key", KEYS[3])
+return 1
+`)
+
+// сессии, созданные до хранения по хэшу, переносятся на новые ключи, чтобы значение куки
+// не лежало в хранилище и пользователям не пришлось входить заново
+func migrateSessionKeys(ctx context.Context, rdb *redis.Client) error {
+	iter := rdb.Scan(ctx, 0, sessionInfoPrefix+"*", 1000).Iterator()
+	for iter.Next(ctx) {
+		infoKey := iter.Val()
+		key, err := rdb.HGet(ctx, infoKey, "key").Result()
+		if err == redis.Nil {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("get redis error: %w", err)
+		}
+		if key == "" || strings.Contains(key, ":") {
+			continue
+		}
+		if err := moveSessionScript.Run(ctx, rdb, []string{infoKey, key, service.SessionKey(key)}, key).Err(); err != nil {
+			return fmt.Errorf("migrate redis error: %w", err)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("scan redis error: %w", err)
+	}
+	return nil
+}
+
 func (repo *SessionsRepoRedis) GetUser(ctx context.Context, cookieVal string) (string, error) {
 	val, err := repo.DB.Get(ctx, cookieVal).Result()
 	if err == redis.Nil {
@@ -62,4 +106,184 @@ func (repo *SessionsRepoRedis) Delete(ctx context.Context, cookieVal string) err
 		return fmt.Errorf("delete redis error: %w", err)
 	}
 	return nil
-}
\ No newline at end of file
+}
+func (repo *SessionsRepoRedis) Take(ctx context.Context, cookieVal string) (string, error) {
+	val, err := repo.DB.GetDel(ctx, cookieVal).Result()
+	if err == redis.Nil {
+		return "", service.ErrNoUserBySession
+	} else if err != nil {
+		return "", fmt.Errorf("delete redis error: %w", err)
+	}
+	return val, nil
+}
+
+const (
+	sessionInfoPrefix  = "session_info:"
+	userSessionsPrefix = "user_sessions:"
+)
+
+// обновляет время активности и продлевает сведения о сессии, только если они еще существуют
+var touchScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+redis.call("HSET", KEYS[1], "last_seen", ARGV[1])
+redis.call("PEXPIRE", KEYS[1], ARGV[2])
+redis.call("PEXPIRE", KEYS[2], ARGV[2], "GT")
+return 1
+`)
+
+// выдает токен CSRF только существующей сессии; из одновременно созданных токенов сохраняется первый
+var csrfScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return false
+end
+local token = redis.call("HGET", KEYS[1], "csrf_token")
+if token and token ~= "" then
+	return token
+end
+redis.call("HSET", KEYS[1], "csrf_token", ARGV[1])
+return ARGV[1]
+`)
+
+func (repo *SessionsRepoRedis) AddSessionInfo(ctx context.Context, info *service.SessionInfo, dur time.Duration) error {
+	infoKey := sessionInfoPrefix + info.ID
+	setKey := userSessionsPrefix + info.UserName
+	_, err := repo.DB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, infoKey,
+			"username", info.UserName,
+			"key", info.Key,
+			"created_at", info.CreatedAt.Unix(),
+			"last_seen", info.LastSeen.Unix(),
+			"ip", info.IP,
+			"user_agent", info.UserAgent,
+			"remember", info.Remember,
+			"csrf_token", info.CSRFToken,
+		)
+		pipe.Expire(ctx, infoKey, dur)
+		pipe.SAdd(ctx, setKey, info.ID)
+		// список живет не меньше самой новой сессии
+		pipe.ExpireNX(ctx, setKey, dur)
+		pipe.ExpireGT(ctx, setKey, dur)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("insert redis error: %w", err)
+	}
+	return nil
+}
+
+func (repo *SessionsRepoRedis) GetSessionInfo(ctx context.Context, id string) (*service.SessionInfo, error) {
+	fields, err := repo.DB.HGetAll(ctx, sessionInfoPrefix+id).Result()
+	if err != nil {
+		return nil, fmt.Errorf("get redis error: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, service.ErrNoSession
+	}
+	return sessionInfo(id, fields), nil
+}
+
+func (repo *SessionsRepoRedis) GetSessionInfos(ctx context.Context, username string) ([]*service.SessionInfo, error) {
+	setKey := userSessionsPrefix + username
+	ids, err := repo.DB.SMembers(ctx, setKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("get redis error: %w", err)
+	}
+
+	cmds := make([]*redis.MapStringStringCmd, len(ids))
+	_, err = repo.DB.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			cmds[i] = pipe.HGetAll(ctx, sessionInfoPrefix+id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get redis error: %w", err)
+	}
+
+	sessions := []*service.SessionInfo{}
+	expired := []interface{}{}
+	for i, cmd := range cmds {
+		fields := cmd.Val()
+		if len(fields) == 0 {
+			expired = append(expired, ids[i])
+			continue
+		}
+		sessions = append(sessions, sessionInfo(ids[i], fields))
+	}
+	if len(expired) > 0 {
+		if err := repo.DB.SRem(ctx, setKey, expired...).Err(); err != nil {
+			return nil, fmt.Errorf("delete redis error: %w", err)
+		}
+	}
+	return sessions, nil
+}
+
+func (repo *SessionsRepoRedis) Expire(ctx context.Context, cookieVal string, dur time.Duration) error {
+	_, err := repo.DB.Expire(ctx, cookieVal, dur).Result()
+	if err != nil {
+		return fmt.Errorf("expire redis error: %w", err)
+	}
+	return nil
+}
+
+func (repo *SessionsRepoRedis) TouchSessionInfo(ctx context.Context, username, id string, lastSeen time.Time, dur time.Duration) error {
+	keys := []string{sessionInfoPrefix + id, userSessionsPrefix + username}
+	err := touchScript.Run(ctx, repo.DB, keys, lastSeen.Unix(), dur.Milliseconds()).Err()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("update redis error: %w", err)
+	}
+	return nil
+}
+
+func (repo *SessionsRepoRedis) DeleteSessionInfo(ctx context.Context, username, id string) error {
+	_, err := repo.DB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, sessionInfoPrefix+id)
+		pipe.SRem(ctx, userSessionsPrefix+username, id)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("delete redis error: %w", err)
+	}
+	return nil
+}
+
+func (repo *SessionsRepoRedis) CSRFToken(ctx context.Context, id, newToken string) (string, error) {
+	token, err := csrfScript.Run(ctx, repo.DB, []string{sessionInfoPrefix + id}, newToken).Text()
+	if err == redis.Nil {
+		return "", service.ErrNoSession
+	} else if err != nil {
+		return "", fmt.Errorf("csrf token redis error: %w", err)
+	}
+	return token, nil
+}
+
+// сведения о сессии живут столько же, сколько сама сессия, поэтому считаются они
+func (repo *SessionsRepoRedis) CountSessions(ctx context.Context) (int64, error) {
+	var n int64
+	iter := repo.DB.Scan(ctx, 0, sessionInfoPrefix+"*", 1000).Iterator()
+	for iter.Next(ctx) {
+		n++
+	}
+	if err := iter.Err(); err != nil {
+		return 0, fmt.Errorf("scan redis error: %w", err)
+	}
+	return n, nil
+}
+
+func sessionInfo(id string, fields map[string]string) *service.SessionInfo {
+	createdAt, _ := strconv.ParseInt(fields["created_at"], 10, 64)
+	lastSeen, _ := strconv.ParseInt(fields["last_seen"], 10, 64)
+	return &service.SessionInfo{
+		ID:        id,
+		UserName:  fields["username"],
+		Key:       fields["key"],
+		CreatedAt: time.Unix(createdAt, 0),
+		LastSeen:  time.Unix(lastSeen, 0),
+		IP:        fields["ip"],
+		UserAgent: fields["user_agent"],
+		Remember:  fields["remember"] == "1",
+		CSRFToken: fields["csrf_token"],
+	}
+}
@@ -0,0 +1,126 @@
+package mysql
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+)
+
+// события, которые порождают изменения задач
+var outboxEvents = map[string]string{
+	service.FilterAssign:   service.EventTaskAssigned,
+	service.FilterUnassign: service.EventTaskUnassigned,
+	// у событий команды заполнено поле Team, у взятия задачи - и Team, и UserName
+	service.FilterAssignTeam:   service.EventTaskAssigned,
+	service.FilterUnassignTeam: service.EventTaskUnassigned,
+	service.FilterClaim:        service.EventTaskAssigned,
+	service.FilterComplete:     service.EventTaskCompleted,
+	service.FilterStatus:       service.EventTaskStatusChanged,
+}
+
+func createOutboxTable(ctx context.Context, db *sql.DB) {
+	query := `
+		CREATE TABLE IF NOT EXISTS task_outbox (
+					id 				BIGINT PRIMARY KEY AUTO_INCREMENT,
+					idempotency_key CHAR(32) NOT NULL UNIQUE,
+					payload 		MEDIUMTEXT NOT NULL,
+					created_at 		DATETIME(3) NOT NULL,
+					delivered_at 	DATETIME(3) NULL,
+					INDEX idx_outbox_pending (delivered_at, id)
+		)`
+
+	_, err := db.ExecContext(ctx, query)
+	if err != nil {
+		log.Fatalf("Error %s, Description: %s", err, ErrCreatingTableMySQL)
+	}
+}
+
+// сохраняет событие с текущим состоянием задачи, читая его внутри транзакции tx
+func addOutboxEvent(ctx context.Context, tx *sql.Tx, eventType string, taskId uint64, username, team string) error {
+	tasks, err := selectSomeTasks(ctx, tx, service.FilterTask, map[string]string{service.TaskId: strconv.FormatUint(taskId, 10)})
+	if err != nil {
+		return err
+	}
+	if len(tasks) == 0 {
+		return service.ErrNoTask
+	}
+
+	key, err := newIdempotencyKey()
+	if err != nil {
+		return fmt.Errorf("outbox key error: %w", err)
+	}
+	event := &service.TaskEvent{
+		Key:       key,
+		Type:      eventType,
+		Task:      tasks[0],
+		UserName:  username,
+		Team:      team,
+		Actor:     service.ActorFrom(ctx),
+		CreatedAt: time.Now(),
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("outbox marshal error: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO task_outbox (`idempotency_key`, `payload`, `created_at`) VALUES (?, ?, ?)",
+		key, string(payload), event.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert outbox mysql error: %w", err)
+	}
+	return nil
+}
+
+func (repo *TasksRepoMySQL) GetPendingEvents(ctx context.Context, limit int) ([]*service.OutboxEvent, error) {
+	rows, err := repo.DB.QueryContext(ctx,
+		"SELECT id, idempotency_key, payload FROM task_outbox WHERE delivered_at IS NULL ORDER BY id LIMIT ?", limit)
+	if err != nil {
+		return nil, fmt.Errorf("select mysql error: %w", err)
+	}
+	defer rows.Close()
+
+	events := []*service.OutboxEvent{}
+	for rows.Next() {
+		event := &service.OutboxEvent{}
+		var payload string
+		if err = rows.Scan(&event.ID, &event.Key, &payload); err != nil {
+			return nil, fmt.Errorf("scanning mysql error: %w", err)
+		}
+		event.Payload = []byte(payload)
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func (repo *TasksRepoMySQL) MarkDelivered(ctx context.Context, id uint64) error {
+	_, err := repo.DB.ExecContext(ctx, "UPDATE task_outbox SET `delivered_at` = ? WHERE id = ?", time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("update mysql error: %w", err)
+	}
+	return nil
+}
+
+func (repo *TasksRepoMySQL) DeleteDeliveredEvents(ctx context.Context, before time.Time) error {
+	_, err := repo.DB.ExecContext(ctx, "DELETE FROM task_outbox WHERE delivered_at IS NOT NULL AND delivered_at < ?", before)
+	if err != nil {
+		return fmt.Errorf("delete mysql error: %w", err)
+	}
+	return nil
+}
+
+func newIdempotencyKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -6,6 +6,9 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/RusGadzhiev/TaskManager/internal/config"
 	"github.com/RusGadzhiev/TaskManager/internal/service"
@@ -30,6 +33,7 @@ func NewTasksRepoMySQL(ctx context.Context, config *config.MySQLDb) *TasksRepoMy
 		Addr:              config.Host + ":" + config.Port,
 		DBName:            config.Name,
 		InterpolateParams: true,
+		ParseTime:         true,
 	}
 
 	connector, err := mysql.NewConnector(&cfg)
@@ -51,6 +55,9 @@ func NewTasksRepoMySQL(ctx context.Context, config *config.MySQLDb) *TasksRepoMy
 					owner 		TEXT, 
 					executor 	TEXT,
 					description TEXT,
+					status 		VARCHAR(32) NOT NULL DEFAULT 'todo',
+					due_at 		DATETIME NULL,
+					due_notified BOOL NOT NULL DEFAULT 0,
 					completed 	BOOL,
 					assigned 	BOOL
 		);
@@ -69,17 +76,83 @@ func NewTasksRepoMySQL(ctx context.Context, config *config.MySQLDb) *TasksRepoMy
 		log.Fatalf("Error %s, Description: %s", err, ErrCreatingTableMySQL)
 	}
 
+	for column, definition := range map[string]string{
+		"status":       "VARCHAR(32) NOT NULL DEFAULT 'todo'",
+		"due_at":       "DATETIME NULL",
+		"due_notified": "BOOL NOT NULL DEFAULT 0",
+	} {
+		err = addColumnIfMissing(ctx, db, "Tasks", column, definition)
+		if err != nil {
+			log.Fatalf("Error %s, Description: %s", err, ErrCreatingTableMySQL)
+		}
+	}
+
+	// исполнители, команды и наблюдатели задачи хранятся в отдельных таблицах
+	for _, query := range []string{
+		`CREATE TABLE IF NOT EXISTS task_assignees (
+					task_id 	INT NOT NULL,
+					username 	VARCHAR(255) NOT NULL,
+					PRIMARY KEY (task_id, username),
+					INDEX idx_assignee (username),
+					CONSTRAINT fk_task_assignees_task FOREIGN KEY (task_id) REFERENCES Tasks(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS task_teams (
+					task_id 	INT NOT NULL,
+					team 		VARCHAR(255) NOT NULL,
+					PRIMARY KEY (task_id, team),
+					INDEX idx_team (team),
+					CONSTRAINT fk_task_teams_task FOREIGN KEY (task_id) REFERENCES Tasks(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS task_watchers (
+					task_id 	INT NOT NULL,
+					username 	VARCHAR(255) NOT NULL,
+					PRIMARY KEY (task_id, username),
+					INDEX idx_watcher (username),
+					CONSTRAINT fk_task_watchers_task FOREIGN KEY (task_id) REFERENCES Tasks(id) ON DELETE CASCADE
+		)`,
+	} {
+		_, err = db.ExecContext(ctx, query)
+		if err != nil {
+			log.Fatalf("Error %s, Description: %s", err, ErrCreatingTableMySQL)
+		}
+	}
+
+	// таблицы, созданные до появления внешних ключей
+	for table, constraint := range map[string]string{
+		"task_assignees": "fk_task_assignees_task",
+		"task_teams":     "fk_task_teams_task",
+		"task_watchers":  "fk_task_watchers_task",
+	} {
+		if err = addTaskForeignKeyIfMissing(ctx, db, table, constraint); err != nil {
+			log.Fatalf("Error %s, Description: %s", err, ErrCreatingTableMySQL)
+		}
+	}
+
+	if err = migrateExecutors(ctx, db); err != nil {
+		log.Fatalf("Error %s, Description: %s", err, ErrCreatingTableMySQL)
+	}
+
+	createOutboxTable(ctx, db)
+
 	return &TasksRepoMySQL{DB: db}
 }
 
 func (repo *TasksRepoMySQL) Add(ctx context.Context, task *service.Task) (uint64, error) {
-	res, err := repo.DB.ExecContext(ctx,
-		"INSERT INTO Tasks (`owner`, `executor`, `description`, `completed`, `assigned`) VALUES (?, ?, ?, ?, ?)",
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin tx mysql error: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		"INSERT INTO Tasks (`owner`, `executor`, `description`, `status`, `due_at`, `completed`, `assigned`) VALUES (?, ?, ?, ?, ?, ?, ?)",
 		task.Owner,
-		task.Executor,
+		"",
 		task.Description,
+		task.Status,
+		task.DueAt,
 		task.Completed,
-		task.Assigned,
+		len(task.Executors) > 0 || len(task.Teams) > 0,
 	)
 	if err != nil {
 		return 0, fmt.Errorf("insert mysql error: %w", err)
@@ -88,6 +161,24 @@ func (repo *TasksRepoMySQL) Add(ctx context.Context, task *service.Task) (uint64
 	if err != nil {
 		return 0, fmt.Errorf("insert (last inserted ID) mysql error: %w", err)
 	}
+	for _, executor := range task.Executors {
+		_, err = tx.ExecContext(ctx, "INSERT IGNORE INTO task_assignees (`task_id`, `username`) VALUES (?, ?)", id, executor)
+		if err != nil {
+			return 0, fmt.Errorf("insert assignee mysql error: %w", err)
+		}
+	}
+	for _, team := range task.Teams {
+		_, err = tx.ExecContext(ctx, "INSERT IGNORE INTO task_teams (`task_id`, `team`) VALUES (?, ?)", id, team)
+		if err != nil {
+			return 0, fmt.Errorf("insert team mysql error: %w", err)
+		}
+	}
+	if err = addOutboxEvent(ctx, tx, service.EventTaskCreated, uint64(id), "", ""); err != nil {
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit mysql error: %w", err)
+	}
 	return uint64(id), nil
 }
 
@@ -99,62 +190,371 @@ func (repo *TasksRepoMySQL) GetCreatedTasks(ctx context.Context, username string
 	return repo.getSomeTasks(ctx, service.FilterCreatedTasks, map[string]string{service.UserName: username})
 }
 
-func (repo *TasksRepoMySQL) GetMyTasks(ctx context.Context, username string) ([]*service.Task, error) {
-	return repo.getSomeTasks(ctx, service.FilterMyTasks, map[string]string{service.UserName: username})
+func (repo *TasksRepoMySQL) GetMyTasks(ctx context.Context, username string, teams []string) ([]*service.Task, error) {
+	if len(teams) == 0 {
+		return repo.getSomeTasks(ctx, service.FilterMyTasks, map[string]string{service.UserName: username})
+	}
+	args := []interface{}{username}
+	for _, team := range teams {
+		args = append(args, team)
+	}
+	return selectTasksQuery(ctx, repo.DB,
+		selectTasks+" WHERE t.id IN (SELECT task_id FROM task_assignees WHERE username = ?)"+
+			" OR t.id IN (SELECT task_id FROM task_teams WHERE team IN (?"+strings.Repeat(", ?", len(teams)-1)+"))",
+		args...)
+}
+
+func (repo *TasksRepoMySQL) GetTask(ctx context.Context, taskId uint64) (*service.Task, error) {
+	tasks, err := repo.getSomeTasks(ctx, service.FilterTask, map[string]string{service.TaskId: strconv.FormatUint(taskId, 10)})
+	if err != nil {
+		return nil, err
+	}
+	if len(tasks) == 0 {
+		return nil, service.ErrNoTask
+	}
+	return tasks[0], nil
+}
+
+func (repo *TasksRepoMySQL) GetTasksDueBefore(ctx context.Context, before time.Time) ([]*service.Task, error) {
+	return selectTasksQuery(ctx, repo.DB,
+		selectTasks+" WHERE t.completed = 0 AND t.due_notified = 0 AND t.due_at IS NOT NULL AND t.due_at <= ?", before)
+}
+
+func (repo *TasksRepoMySQL) MarkDueNotified(ctx context.Context, taskId uint64) error {
+	_, err := repo.DB.ExecContext(ctx, "UPDATE Tasks SET `due_notified` = 1 WHERE id = ?", taskId)
+	if err != nil {
+		return fmt.Errorf("update mysql error: %w", err)
+	}
+	return nil
+}
+
+// статусы без задач тоже попадают в результат с нулем
+func (repo *TasksRepoMySQL) CountTasksByStatus(ctx context.Context) (map[string]int64, error) {
+	rows, err := repo.DB.QueryContext(ctx, "SELECT `status`, COUNT(*) FROM Tasks GROUP BY `status`")
+	if err != nil {
+		return nil, fmt.Errorf("select mysql error: %w", err)
+	}
+	defer rows.Close()
+
+	counts := map[string]int64{service.StatusTodo: 0, service.StatusInProgress: 0, service.StatusDone: 0}
+	for rows.Next() {
+		var status string
+		var n int64
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, fmt.Errorf("scan mysql error: %w", err)
+		}
+		counts[status] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("select mysql error: %w", err)
+	}
+	return counts, nil
 }
 
 func (repo *TasksRepoMySQL) Assign(ctx context.Context, taskId uint64, username string) error {
 	return repo.updateSth(ctx, service.FilterAssign, map[string]interface{}{service.TaskId: taskId, service.UserName: username})
 }
 
-func (repo *TasksRepoMySQL) Unassign(ctx context.Context, taskId uint64) error {
-	return repo.updateSth(ctx, service.FilterUnassign, map[string]interface{}{service.TaskId: taskId})
+func (repo *TasksRepoMySQL) Unassign(ctx context.Context, taskId uint64, username string) error {
+	return repo.updateSth(ctx, service.FilterUnassign, map[string]interface{}{service.TaskId: taskId, service.UserName: username})
+}
+
+func (repo *TasksRepoMySQL) AssignTeam(ctx context.Context, taskId uint64, team string) error {
+	return repo.updateSth(ctx, service.FilterAssignTeam, map[string]interface{}{service.TaskId: taskId, service.TeamName: team})
+}
+
+func (repo *TasksRepoMySQL) UnassignTeam(ctx context.Context, taskId uint64, team string) error {
+	return repo.updateSth(ctx, service.FilterUnassignTeam, map[string]interface{}{service.TaskId: taskId, service.TeamName: team})
+}
+
+func (repo *TasksRepoMySQL) Claim(ctx context.Context, taskId uint64, team, username string) error {
+	return repo.updateSth(ctx, service.FilterClaim, map[string]interface{}{service.TaskId: taskId, service.TeamName: team, service.UserName: username})
 }
 
 func (repo *TasksRepoMySQL) Complete(ctx context.Context, taskId uint64) error {
 	return repo.updateSth(ctx, service.FilterComplete, map[string]interface{}{service.TaskId: taskId})
 }
 
+func (repo *TasksRepoMySQL) SetStatus(ctx context.Context, taskId uint64, status string) error {
+	return repo.updateSth(ctx, service.FilterStatus, map[string]interface{}{service.TaskId: taskId, service.Status: status})
+}
+
+func (repo *TasksRepoMySQL) Watch(ctx context.Context, taskId uint64, username string) error {
+	return repo.updateSth(ctx, service.FilterWatch, map[string]interface{}{service.TaskId: taskId, service.UserName: username})
+}
+
+func (repo *TasksRepoMySQL) Unwatch(ctx context.Context, taskId uint64, username string) error {
+	return repo.updateSth(ctx, service.FilterUnwatch, map[string]interface{}{service.TaskId: taskId, service.UserName: username})
+}
+
+// выбирает задачи, списки исполнителей, команд и наблюдателей дочитывает loadRelations
+const selectTasks = "SELECT t.id, t.owner, t.description, t.status, t.due_at, t.completed, t.assigned FROM Tasks t"
+
+// сколько id задач передается в одном IN при чтении связанных таблиц
+const relationsBatchSize = 500
+
+// связанные с задачей списки; читаются отдельными запросами, а не GROUP_CONCAT,
+// который обрезается по group_concat_max_len и ломается на запятых в значениях
+var taskRelations = []struct {
+	table  string
+	column string
+	add    func(task *service.Task, value string)
+}{
+	{"task_assignees", "username", func(task *service.Task, v string) { task.Executors = append(task.Executors, v) }},
+	{"task_teams", "team", func(task *service.Task, v string) { task.Teams = append(task.Teams, v) }},
+	{"task_watchers", "username", func(task *service.Task, v string) { task.Watchers = append(task.Watchers, v) }},
+}
+
+// *sql.DB или *sql.Tx
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
 func (repo *TasksRepoMySQL) getSomeTasks(ctx context.Context, filter string, args map[string]string) ([]*service.Task, error) {
+	return selectSomeTasks(ctx, repo.DB, filter, args)
+}
+
+func selectSomeTasks(ctx context.Context, q queryer, filter string, args map[string]string) ([]*service.Task, error) {
 	var rows *sql.Rows
 	var err error
 	switch filter {
 	case service.FilterAllTasks:
-		rows, err = repo.DB.QueryContext(ctx, "SELECT id, owner, executor, description, completed, assigned FROM Tasks")
+		rows, err = q.QueryContext(ctx, selectTasks)
 	case service.FilterMyTasks:
-		rows, err = repo.DB.QueryContext(ctx, "SELECT id, owner, executor, description, completed, assigned FROM Tasks WHERE executor=?", args[service.UserName])
+		rows, err = q.QueryContext(ctx, selectTasks+" WHERE t.id IN (SELECT task_id FROM task_assignees WHERE username = ?)", args[service.UserName])
 	case service.FilterCreatedTasks:
-		rows, err = repo.DB.QueryContext(ctx, "SELECT id, owner, executor, description, completed, assigned FROM Tasks WHERE owner=?", args[service.UserName])
+		rows, err = q.QueryContext(ctx, selectTasks+" WHERE t.owner = ?", args[service.UserName])
+	case service.FilterTask:
+		rows, err = q.QueryContext(ctx, selectTasks+" WHERE t.id = ?", args[service.TaskId])
 	}
 	if err != nil {
 		return nil, fmt.Errorf("select mysql error: %w", err)
 	}
-	defer rows.Close()
+	return scanTasks(ctx, q, rows)
+}
+
+func selectTasksQuery(ctx context.Context, q queryer, query string, args ...interface{}) ([]*service.Task, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("select mysql error: %w", err)
+	}
+	return scanTasks(ctx, q, rows)
+}
 
+// rows закрываются до чтения связанных таблиц: в транзакции нельзя начать запрос, пока не дочитан предыдущий
+func scanTasks(ctx context.Context, q queryer, rows *sql.Rows) ([]*service.Task, error) {
 	Tasks := []*service.Task{}
 	for rows.Next() {
-		Task := &service.Task{}
-		err = rows.Scan(&Task.ID, &Task.Owner, &Task.Executor, &Task.Description, &Task.Completed, &Task.Assigned)
+		Task := &service.Task{Executors: []string{}, Teams: []string{}, Watchers: []string{}}
+		var dueAt sql.NullTime
+		err := rows.Scan(&Task.ID, &Task.Owner, &Task.Description, &Task.Status, &dueAt, &Task.Completed, &Task.Assigned)
 		if err != nil {
+			rows.Close()
 			return nil, fmt.Errorf("scanning mysql error: %w", err)
 		}
+		if dueAt.Valid {
+			Task.DueAt = &dueAt.Time
+		}
 		Tasks = append(Tasks, Task)
 	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, fmt.Errorf("scanning mysql error: %w", err)
+	}
+	rows.Close()
+
+	if err := loadRelations(ctx, q, Tasks); err != nil {
+		return nil, err
+	}
 	return Tasks, nil
 }
 
+func loadRelations(ctx context.Context, q queryer, tasks []*service.Task) error {
+	byId := make(map[uint64]*service.Task, len(tasks))
+	ids := make([]interface{}, 0, len(tasks))
+	for _, task := range tasks {
+		byId[task.ID] = task
+		ids = append(ids, task.ID)
+	}
+
+	for start := 0; start < len(ids); start += relationsBatchSize {
+		batch := ids[start:min(start+relationsBatchSize, len(ids))]
+		in := "(?" + strings.Repeat(", ?", len(batch)-1) + ")"
+		for _, rel := range taskRelations {
+			rows, err := q.QueryContext(ctx,
+				"SELECT task_id, "+rel.column+" FROM "+rel.table+" WHERE task_id IN "+in+" ORDER BY task_id, "+rel.column, batch...)
+			if err != nil {
+				return fmt.Errorf("select %s mysql error: %w", rel.table, err)
+			}
+			for rows.Next() {
+				var id uint64
+				var value string
+				if err = rows.Scan(&id, &value); err != nil {
+					rows.Close()
+					return fmt.Errorf("scanning %s mysql error: %w", rel.table, err)
+				}
+				rel.add(byId[id], value)
+			}
+			err = rows.Err()
+			rows.Close()
+			if err != nil {
+				return fmt.Errorf("scanning %s mysql error: %w", rel.table, err)
+			}
+		}
+	}
+	return nil
+}
+
 func (repo *TasksRepoMySQL) updateSth(ctx context.Context, filter string, args map[string]interface{}) error {
-	var err error
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx mysql error: %w", err)
+	}
+	defer tx.Rollback()
+
+	// задача блокируется до конца транзакции; без нее изменения связанных таблиц оставили бы сироты
+	var id uint64
+	err = tx.QueryRowContext(ctx, "SELECT id FROM Tasks WHERE id = ? FOR UPDATE", args[service.TaskId]).Scan(&id)
+	if err == sql.ErrNoRows {
+		return service.ErrNoTask
+	} else if err != nil {
+		return fmt.Errorf("select mysql error: %w", err)
+	}
+
 	switch filter {
 	case service.FilterAssign:
-		_, err = repo.DB.QueryContext(ctx, "UPDATE Tasks SET `executor` = ?, `assigned` = 1 WHERE id = ?", args[service.UserName], args[service.TaskId])
+		_, err = tx.ExecContext(ctx, "INSERT IGNORE INTO task_assignees (`task_id`, `username`) VALUES (?, ?)", args[service.TaskId], args[service.UserName])
 	case service.FilterUnassign:
-		_, err = repo.DB.QueryContext(ctx, "UPDATE Tasks SET `executor` = \"\", `assigned` = 0 WHERE id = ?", args[service.TaskId])
+		_, err = tx.ExecContext(ctx, "DELETE FROM task_assignees WHERE task_id = ? AND username = ?", args[service.TaskId], args[service.UserName])
+	case service.FilterAssignTeam:
+		_, err = tx.ExecContext(ctx, "INSERT IGNORE INTO task_teams (`task_id`, `team`) VALUES (?, ?)", args[service.TaskId], args[service.TeamName])
+	case service.FilterUnassignTeam:
+		_, err = tx.ExecContext(ctx, "DELETE FROM task_teams WHERE task_id = ? AND team = ?", args[service.TaskId], args[service.TeamName])
+	case service.FilterClaim:
+		err = claimTask(ctx, tx, args[service.TaskId], args[service.TeamName], args[service.UserName])
 	case service.FilterComplete:
-		_, err = repo.DB.QueryContext(ctx, "UPDATE Tasks SET `completed` = 1 WHERE id = ?", args[service.TaskId])
+		_, err = tx.ExecContext(ctx, "UPDATE Tasks SET `completed` = 1, `status` = ? WHERE id = ?", service.StatusDone, args[service.TaskId])
+	case service.FilterStatus:
+		_, err = tx.ExecContext(ctx, "UPDATE Tasks SET `status` = ?, `completed` = ? WHERE id = ?",
+			args[service.Status], args[service.Status] == service.StatusDone, args[service.TaskId])
+	case service.FilterWatch:
+		_, err = tx.ExecContext(ctx, "INSERT IGNORE INTO task_watchers (`task_id`, `username`) VALUES (?, ?)", args[service.TaskId], args[service.UserName])
+	case service.FilterUnwatch:
+		_, err = tx.ExecContext(ctx, "DELETE FROM task_watchers WHERE task_id = ? AND username = ?", args[service.TaskId], args[service.UserName])
 	}
-	if err != nil {
+	if err == service.ErrNoTeamTask {
+		return err
+	} else if isNoReferencedRow(err) {
+		return service.ErrNoTask
+	} else if err != nil {
 		return fmt.Errorf("update mysql error: %w", err)
 	}
+
+	// флаг assigned отражает наличие хотя бы одного исполнителя или команды
+	switch filter {
+	case service.FilterAssign, service.FilterUnassign, service.FilterAssignTeam, service.FilterUnassignTeam, service.FilterClaim:
+		_, err = tx.ExecContext(ctx,
+			"UPDATE Tasks SET `assigned` = (EXISTS (SELECT 1 FROM task_assignees WHERE task_id = ?) OR EXISTS (SELECT 1 FROM task_teams WHERE task_id = ?)) WHERE id = ?",
+			args[service.TaskId], args[service.TaskId], args[service.TaskId])
+		if err != nil {
+			return fmt.Errorf("update mysql error: %w", err)
+		}
+	}
+
+	// событие записывается в той же транзакции, что и изменение задачи
+	if eventType, ok := outboxEvents[filter]; ok {
+		username, _ := args[service.UserName].(string)
+		team, _ := args[service.TeamName].(string)
+		if err = addOutboxEvent(ctx, tx, eventType, args[service.TaskId].(uint64), username, team); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("commit mysql error: %w", err)
+	}
 	return nil
 }
+
+// снимает команду и назначает исполнителя; команду снимает только первый из одновременно взявших задачу
+func claimTask(ctx context.Context, tx *sql.Tx, taskId, team, username interface{}) error {
+	res, err := tx.ExecContext(ctx, "DELETE FROM task_teams WHERE task_id = ? AND team = ?", taskId, team)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return service.ErrNoTeamTask
+	}
+	_, err = tx.ExecContext(ctx, "INSERT IGNORE INTO task_assignees (`task_id`, `username`) VALUES (?, ?)", taskId, username)
+	return err
+}
+
+// добавляет колонку в уже существующую таблицу, созданную до ее появления в схеме
+func addColumnIfMissing(ctx context.Context, db *sql.DB, table, column, definition string) error {
+	var count int
+	err := db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?",
+		table, column).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	_, err = db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// добавляет внешний ключ task_id -> Tasks(id) в таблицу, созданную без него; строки удаленных задач
+// удаляются заранее, иначе ключ не создастся
+func addTaskForeignKeyIfMissing(ctx context.Context, db *sql.DB, table, constraint string) error {
+	var count int
+	err := db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM information_schema.TABLE_CONSTRAINTS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND CONSTRAINT_NAME = ?",
+		table, constraint).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	_, err = db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE task_id NOT IN (SELECT id FROM Tasks)", table))
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, fmt.Sprintf(
+		"ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (task_id) REFERENCES Tasks(id) ON DELETE CASCADE", table, constraint))
+	return err
+}
+
+// до таблицы task_assignees единственный исполнитель хранился в Tasks.executor.
+// Колонка очищается в той же транзакции, поэтому перенос выполняется один раз
+// и не возвращает исполнителей, которых потом сняли
+func migrateExecutors(ctx context.Context, db *sql.DB) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT IGNORE INTO task_assignees (`task_id`, `username`) SELECT id, executor FROM Tasks WHERE executor IS NOT NULL AND executor <> ''")
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE Tasks SET `executor` = '', `assigned` = 1 WHERE executor IS NOT NULL AND executor <> ''")
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ошибка внешнего ключа: задачи, на которую ссылается строка, нет
+func isNoReferencedRow(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1452
+}
@@ -0,0 +1,106 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrCreatingIndexMongo = errors.New("error of creating tokens index")
+)
+
+const (
+	DBName         = "task_manager"
+	CollectionName = "tokens"
+)
+
+type TokensRepoMongoDB struct {
+	DB *mongo.Collection
+}
+
+// использует подключение к базе пользователей
+func NewTokensRepoMongoDB(ctx context.Context, client *mongo.Client) *TokensRepoMongoDB {
+	collection := client.Database(DBName).Collection(CollectionName)
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: service.UserName, Value: 1}}},
+	})
+	if err != nil {
+		log.Fatalf("Error: %s, Description: %s", err, ErrCreatingIndexMongo)
+	}
+
+	return &TokensRepoMongoDB{DB: collection}
+}
+
+func (repo *TokensRepoMongoDB) AddToken(ctx context.Context, token *service.APIToken) error {
+	_, err := repo.DB.InsertOne(ctx, token)
+	if err != nil {
+		return fmt.Errorf("insert mongo error: %w", err)
+	}
+	return nil
+}
+
+func (repo *TokensRepoMongoDB) GetTokenByHash(ctx context.Context, hash string) (*service.APIToken, error) {
+	res := repo.DB.FindOne(ctx, bson.M{"hash": hash})
+	if res.Err() == mongo.ErrNoDocuments {
+		return nil, service.ErrNoToken
+	} else if res.Err() != nil {
+		return nil, fmt.Errorf("get token mongo error: %w", res.Err())
+	}
+	var token service.APIToken
+	if err := res.Decode(&token); err != nil {
+		return nil, fmt.Errorf("get token mongo error (decode): %w", err)
+	}
+	return &token, nil
+}
+
+func (repo *TokensRepoMongoDB) GetTokens(ctx context.Context, username string) ([]*service.APIToken, error) {
+	cur, err := repo.DB.Find(ctx, bson.M{service.UserName: username}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, fmt.Errorf("find tokens mongo error: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	tokens := []*service.APIToken{}
+	if err := cur.All(ctx, &tokens); err != nil {
+		return nil, fmt.Errorf("find tokens mongo error (decode): %w", err)
+	}
+	return tokens, nil
+}
+
+func (repo *TokensRepoMongoDB) DeleteToken(ctx context.Context, id string, username string) error {
+	res, err := repo.DB.DeleteOne(ctx, bson.M{"_id": id, service.UserName: username})
+	if err != nil {
+		return fmt.Errorf("delete token mongo error: %w", err)
+	}
+	if res.DeletedCount == 0 {
+		return service.ErrNoToken
+	}
+	return nil
+}
+
+func (repo *TokensRepoMongoDB) SetTokenLastUsed(ctx context.Context, id string, t time.Time) error {
+	_, err := repo.DB.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"last_used_at": t}})
+	if err != nil {
+		return fmt.Errorf("update token mongo error: %w", err)
+	}
+	return nil
+}
+
+func (repo *TokensRepoMongoDB) DeleteUserTokens(ctx context.Context, username string) error {
+	_, err := repo.DB.DeleteMany(ctx, bson.M{service.UserName: username})
+	if err != nil {
+		return fmt.Errorf("delete tokens mongo error: %w", err)
+	}
+	return nil
+}
@@ -5,10 +5,14 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/RusGadzhiev/TaskManager/internal/config"
 	"github.com/RusGadzhiev/TaskManager/internal/service"
 
+	officialBson "go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"gopkg.in/mgo.v2/bson"
@@ -17,6 +21,8 @@ import (
 var (
 	ErrConnectionMongo = errors.New("error of connecting with mongo db")
 	ErrPingMongo       = errors.New("error of ping mongo db")
+	ErrIndexMongo      = errors.New("error of creating unique username index")
+	ErrDedupMongo      = errors.New("error of removing duplicate users")
 )
 
 const (
@@ -29,7 +35,7 @@ type UsersRepoMongoDB struct {
 }
 
 func NewUsersRepoMongoDB(ctx context.Context, cfg *config.MongoDb) (*UsersRepoMongoDB, *mongo.Client) {
-	uri := fmt.Sprintf("mongodb://" + cfg.Host + ":" + cfg.Port + "/messenger?directConnection=true")
+	uri := "mongodb://" + cfg.Host + ":" + cfg.Port + "/messenger?directConnection=true"
 	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
 	if err != nil {
 		log.Fatalf("Error: %s, Description: %s", err, ErrConnectionMongo)
@@ -41,11 +47,58 @@ func NewUsersRepoMongoDB(ctx context.Context, cfg *config.MongoDb) (*UsersRepoMo
 	}
 
 	collection := client.Database(DBName).Collection(CollectionName)
+	if err := removeDuplicateUsers(ctx, collection); err != nil {
+		log.Fatalf("Error: %s, Description: %s", err, ErrDedupMongo)
+	}
+	_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    officialBson.D{{Key: service.UserName, Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Fatalf("Error: %s, Description: %s", err, ErrIndexMongo)
+	}
 	return &UsersRepoMongoDB{DB: collection}, client
 }
 
+// до уникального индекса повторная регистрация добавляла второй документ с тем же логином.
+// Задачи, сессии и команды ссылаются на логин, поэтому остается первый документ, с которым и входили
+func removeDuplicateUsers(ctx context.Context, collection *mongo.Collection) error {
+	cur, err := collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$sort", Value: officialBson.D{{Key: "_id", Value: 1}}}},
+		{{Key: "$group", Value: officialBson.D{
+			{Key: "_id", Value: "$" + service.UserName},
+			{Key: "ids", Value: officialBson.D{{Key: "$push", Value: "$_id"}}},
+			{Key: "count", Value: officialBson.D{{Key: "$sum", Value: 1}}},
+		}}},
+		{{Key: "$match", Value: officialBson.D{{Key: "count", Value: officialBson.D{{Key: "$gt", Value: 1}}}}}},
+	})
+	if err != nil {
+		return fmt.Errorf("aggregate mongo error: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var dup struct {
+			UserName string        `bson:"_id"`
+			IDs      []interface{} `bson:"ids"`
+		}
+		if err := cur.Decode(&dup); err != nil {
+			return fmt.Errorf("aggregate mongo error (decode): %w", err)
+		}
+		res, err := collection.DeleteMany(ctx, officialBson.M{"_id": officialBson.M{"$in": dup.IDs[1:]}})
+		if err != nil {
+			return fmt.Errorf("delete mongo error: %w", err)
+		}
+		log.Printf("removed %d duplicate users %q", res.DeletedCount, dup.UserName)
+	}
+	return cur.Err()
+}
+
+// удаленные пользователи остаются в коллекции, чтобы логин не освободился
+var notDeleted = bson.M{"$ne": true}
+
 func (repo *UsersRepoMongoDB) GetUser(ctx context.Context, username string) (*service.User, error) {
-	res := repo.DB.FindOne(ctx, bson.M{service.UserName: username})
+	res := repo.DB.FindOne(ctx, bson.M{service.UserName: username, "deleted": notDeleted})
 	if res.Err() == mongo.ErrNoDocuments {
 		return nil, service.ErrNoUser
 	} else if res.Err() != nil {
@@ -58,10 +111,252 @@ func (repo *UsersRepoMongoDB) GetUser(ctx context.Context, username string) (*se
 	}
 	return &user, nil
 }
+
+// уникальный индекс различает регистр, логины, заданные до приведения к нижнему регистру,
+// проверяются отдельно. Новые логины всегда в нижнем регистре, так что их гонку ловит индекс
 func (repo *UsersRepoMongoDB) AddUser(ctx context.Context, user *service.User) error {
-	_, err := repo.DB.InsertOne(ctx, *user)
+	n, err := repo.DB.CountDocuments(ctx, bson.M{service.UserName: bson.M{"$regex": "^" + regexp.QuoteMeta(user.UserName) + "$", "$options": "i"}})
 	if err != nil {
+		return fmt.Errorf("count users mongo error: %w", err)
+	}
+	if n > 0 {
+		return service.ErrUserExist
+	}
+	_, err = repo.DB.InsertOne(ctx, *user)
+	if mongo.IsDuplicateKeyError(err) {
+		return service.ErrUserExist
+	} else if err != nil {
 		return fmt.Errorf("insert mongo error: %w", err)
 	}
 	return nil
 }
+
+// якорный регэксп без флагов выбирается по уникальному индексу логина, флаг i индекс не ограничивает.
+// Новые логины хранятся в нижнем регистре, поэтому префикс тоже приводится к нему
+func (repo *UsersRepoMongoDB) GetUserNames(ctx context.Context, prefix string, limit int) ([]string, error) {
+	filter := bson.M{service.UserName: bson.M{"$regex": "^" + regexp.QuoteMeta(strings.ToLower(prefix))}, "deleted": notDeleted}
+	opts := options.Find().
+		SetProjection(bson.M{service.UserName: 1}).
+		SetSort(officialBson.D{{Key: service.UserName, Value: 1}}).
+		SetLimit(int64(limit))
+	cur, err := repo.DB.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("find users mongo error: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	names := []string{}
+	for cur.Next(ctx) {
+		var user service.User
+		if err := cur.Decode(&user); err != nil {
+			return nil, fmt.Errorf("find users mongo error (decode): %w", err)
+		}
+		names = append(names, user.UserName)
+	}
+	if err := cur.Err(); err != nil {
+		return nil, fmt.Errorf("find users mongo error: %w", err)
+	}
+	return names, nil
+}
+
+func (repo *UsersRepoMongoDB) GetUsers(ctx context.Context, usernames []string) ([]*service.User, error) {
+	cur, err := repo.DB.Find(ctx, bson.M{service.UserName: bson.M{"$in": usernames}, "deleted": notDeleted})
+	if err != nil {
+		return nil, fmt.Errorf("find users mongo error: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	users := []*service.User{}
+	if err := cur.All(ctx, &users); err != nil {
+		return nil, fmt.Errorf("find users mongo error (decode): %w", err)
+	}
+	return users, nil
+}
+
+func (repo *UsersRepoMongoDB) SetNotifications(ctx context.Context, username string, settings *service.NotificationSettings) error {
+	res, err := repo.DB.UpdateOne(ctx, bson.M{service.UserName: username}, bson.M{"$set": bson.M{"notifications": settings}})
+	if err != nil {
+		return fmt.Errorf("update user mongo error: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return service.ErrNoUser
+	}
+	return nil
+}
+
+func (repo *UsersRepoMongoDB) UpdateExternalUser(ctx context.Context, username, email string, roles []string) error {
+	res, err := repo.DB.UpdateOne(ctx, bson.M{service.UserName: username}, bson.M{"$set": bson.M{"email": email, "roles": roles}})
+	if err != nil {
+		return fmt.Errorf("update user mongo error: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return service.ErrNoUser
+	}
+	return nil
+}
+
+func (repo *UsersRepoMongoDB) SetTOTP(ctx context.Context, username string, settings *service.TOTPSettings) error {
+	update := bson.M{"$set": bson.M{"totp": settings}}
+	if settings == nil {
+		update = bson.M{"$unset": bson.M{"totp": ""}}
+	}
+	res, err := repo.DB.UpdateOne(ctx, bson.M{service.UserName: username}, update)
+	if err != nil {
+		return fmt.Errorf("update user mongo error: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return service.ErrNoUser
+	}
+	return nil
+}
+
+func (repo *UsersRepoMongoDB) UseTOTPStep(ctx context.Context, username string, step int64) error {
+	res, err := repo.DB.UpdateOne(ctx,
+		bson.M{service.UserName: username, "totp.last_step": bson.M{"$lt": step}},
+		bson.M{"$set": bson.M{"totp.last_step": step}},
+	)
+	if err != nil {
+		return fmt.Errorf("update user mongo error: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return service.ErrBadOTP
+	}
+	return nil
+}
+
+func (repo *UsersRepoMongoDB) UseRecoveryCode(ctx context.Context, username, hash string) error {
+	res, err := repo.DB.UpdateOne(ctx,
+		bson.M{service.UserName: username, "totp.recovery_codes": hash},
+		bson.M{"$pull": bson.M{"totp.recovery_codes": hash}},
+	)
+	if err != nil {
+		return fmt.Errorf("update user mongo error: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return service.ErrBadOTP
+	}
+	return nil
+}
+
+func (repo *UsersRepoMongoDB) SetPassword(ctx context.Context, username, password string) error {
+	res, err := repo.DB.UpdateOne(ctx, bson.M{service.UserName: username}, bson.M{"$set": bson.M{"password": password}})
+	if err != nil {
+		return fmt.Errorf("update user mongo error: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return service.ErrNoUser
+	}
+	return nil
+}
+
+func (repo *UsersRepoMongoDB) UpdateProfile(ctx context.Context, username, displayName, email string) error {
+	res, err := repo.DB.UpdateOne(ctx, bson.M{service.UserName: username}, bson.M{"$set": bson.M{"display_name": displayName, "email": email}})
+	if err != nil {
+		return fmt.Errorf("update user mongo error: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return service.ErrNoUser
+	}
+	return nil
+}
+
+func (repo *UsersRepoMongoDB) SetPasswordReset(ctx context.Context, username string, reset *service.PasswordReset) error {
+	res, err := repo.DB.UpdateOne(ctx, bson.M{service.UserName: username}, bson.M{"$set": bson.M{"password_reset": reset}})
+	if err != nil {
+		return fmt.Errorf("update user mongo error: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return service.ErrNoUser
+	}
+	return nil
+}
+
+func (repo *UsersRepoMongoDB) ResetPassword(ctx context.Context, hash, password string, now time.Time) (string, error) {
+	var user service.User
+	err := repo.DB.FindOneAndUpdate(ctx,
+		bson.M{"password_reset.hash": hash, "password_reset.expires_at": bson.M{"$gt": now}},
+		bson.M{"$set": bson.M{"password": password}, "$unset": bson.M{"password_reset": ""}},
+	).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return "", service.ErrBadResetToken
+	} else if err != nil {
+		return "", fmt.Errorf("update user mongo error: %w", err)
+	}
+	return user.UserName, nil
+}
+
+func (repo *UsersRepoMongoDB) ListUsers(ctx context.Context, query string, offset, limit int) ([]*service.User, int64, error) {
+	filter := bson.M{"deleted": notDeleted}
+	if query != "" {
+		pattern := bson.M{"$regex": regexp.QuoteMeta(query), "$options": "i"}
+		filter["$or"] = []bson.M{
+			{service.UserName: pattern},
+			{"display_name": pattern},
+			{"email": pattern},
+		}
+	}
+
+	total, err := repo.DB.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("count users mongo error: %w", err)
+	}
+	opts := options.Find().
+		SetSort(officialBson.D{{Key: service.UserName, Value: 1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit))
+	cur, err := repo.DB.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("find users mongo error: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	users := []*service.User{}
+	if err := cur.All(ctx, &users); err != nil {
+		return nil, 0, fmt.Errorf("find users mongo error (decode): %w", err)
+	}
+	return users, total, nil
+}
+
+func (repo *UsersRepoMongoDB) SetDisabled(ctx context.Context, username string, disabled bool) error {
+	res, err := repo.DB.UpdateOne(ctx, bson.M{service.UserName: username, "deleted": notDeleted}, bson.M{"$set": bson.M{"disabled": disabled}})
+	if err != nil {
+		return fmt.Errorf("update user mongo error: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return service.ErrNoUser
+	}
+	return nil
+}
+
+func (repo *UsersRepoMongoDB) AddRole(ctx context.Context, username, role string) error {
+	res, err := repo.DB.UpdateOne(ctx, bson.M{service.UserName: username, "deleted": notDeleted}, bson.M{"$addToSet": bson.M{"roles": role}})
+	if err != nil {
+		return fmt.Errorf("update user mongo error: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return service.ErrNoUser
+	}
+	return nil
+}
+
+// документ остается, поэтому регистрация и вход через SSO с этим логином получат service.ErrUserExist
+func (repo *UsersRepoMongoDB) DeleteUser(ctx context.Context, username string) error {
+	res, err := repo.DB.UpdateOne(ctx, bson.M{service.UserName: username, "deleted": notDeleted}, bson.M{
+		"$set": bson.M{"deleted": true, "disabled": true, "password": ""},
+		"$unset": bson.M{
+			"email":          "",
+			"display_name":   "",
+			"notifications":  "",
+			"roles":          "",
+			"totp":           "",
+			"password_reset": "",
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("delete user mongo error: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return service.ErrNoUser
+	}
+	return nil
+}
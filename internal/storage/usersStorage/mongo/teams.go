@@ -0,0 +1,120 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+
+	officialBson "go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrTeamsIndexMongo = errors.New("error of creating teams index")
+)
+
+const (
+	TeamsCollectionName = "teams"
+)
+
+type TeamsRepoMongoDB struct {
+	DB *mongo.Collection
+}
+
+// команды хранятся рядом с пользователями и используют то же подключение
+func NewTeamsRepoMongoDB(ctx context.Context, client *mongo.Client) *TeamsRepoMongoDB {
+	collection := client.Database(DBName).Collection(TeamsCollectionName)
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: officialBson.D{{Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: officialBson.D{{Key: "members", Value: 1}}},
+	})
+	if err != nil {
+		log.Fatalf("Error: %s, Description: %s", err, ErrTeamsIndexMongo)
+	}
+
+	return &TeamsRepoMongoDB{DB: collection}
+}
+
+func (repo *TeamsRepoMongoDB) AddTeam(ctx context.Context, team *service.Team) error {
+	_, err := repo.DB.InsertOne(ctx, team)
+	if mongo.IsDuplicateKeyError(err) {
+		return service.ErrTeamExist
+	} else if err != nil {
+		return fmt.Errorf("insert team mongo error: %w", err)
+	}
+	return nil
+}
+
+func (repo *TeamsRepoMongoDB) GetTeam(ctx context.Context, name string) (*service.Team, error) {
+	res := repo.DB.FindOne(ctx, bson.M{"name": name})
+	if res.Err() == mongo.ErrNoDocuments {
+		return nil, service.ErrNoTeam
+	} else if res.Err() != nil {
+		return nil, fmt.Errorf("get team mongo error: %w", res.Err())
+	}
+	var team service.Team
+	if err := res.Decode(&team); err != nil {
+		return nil, fmt.Errorf("get team mongo error (decode): %w", err)
+	}
+	return &team, nil
+}
+
+func (repo *TeamsRepoMongoDB) GetTeams(ctx context.Context) ([]*service.Team, error) {
+	cur, err := repo.DB.Find(ctx, bson.M{}, options.Find().SetSort(officialBson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("find teams mongo error: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	teams := []*service.Team{}
+	if err := cur.All(ctx, &teams); err != nil {
+		return nil, fmt.Errorf("find teams mongo error (decode): %w", err)
+	}
+	return teams, nil
+}
+
+func (repo *TeamsRepoMongoDB) GetUserTeams(ctx context.Context, username string) ([]string, error) {
+	cur, err := repo.DB.Find(ctx, bson.M{"members": username}, options.Find().SetProjection(bson.M{"name": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("find teams mongo error: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	names := []string{}
+	for cur.Next(ctx) {
+		var team service.Team
+		if err := cur.Decode(&team); err != nil {
+			return nil, fmt.Errorf("find teams mongo error (decode): %w", err)
+		}
+		names = append(names, team.Name)
+	}
+	if err := cur.Err(); err != nil {
+		return nil, fmt.Errorf("find teams mongo error: %w", err)
+	}
+	return names, nil
+}
+
+func (repo *TeamsRepoMongoDB) AddTeamMember(ctx context.Context, name, username string) error {
+	return repo.updateMembers(ctx, name, bson.M{"$addToSet": bson.M{"members": username}})
+}
+
+func (repo *TeamsRepoMongoDB) RemoveTeamMember(ctx context.Context, name, username string) error {
+	return repo.updateMembers(ctx, name, bson.M{"$pull": bson.M{"members": username}})
+}
+
+func (repo *TeamsRepoMongoDB) updateMembers(ctx context.Context, name string, update bson.M) error {
+	res, err := repo.DB.UpdateOne(ctx, bson.M{"name": name}, update)
+	if err != nil {
+		return fmt.Errorf("update team mongo error: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return service.ErrNoTeam
+	}
+	return nil
+}
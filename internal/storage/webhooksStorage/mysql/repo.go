@@ -0,0 +1,288 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+)
+
+var (
+	ErrCreatingTableMySQL = errors.New("error of creating webhooks tables")
+)
+
+type WebhooksRepoMySQL struct {
+	DB *sql.DB
+}
+
+// использует подключение к базе задач
+func NewWebhooksRepoMySQL(ctx context.Context, db *sql.DB) *WebhooksRepoMySQL {
+	for _, query := range []string{
+		`CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+					id 			BIGINT PRIMARY KEY AUTO_INCREMENT,
+					owner 		VARCHAR(255) NOT NULL,
+					url 		TEXT NOT NULL,
+					secret 		TEXT NOT NULL,
+					events 		TEXT NOT NULL,
+					created_at 	DATETIME(3) NOT NULL,
+					INDEX idx_webhook_owner (owner)
+		)`,
+		`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+					id 				BIGINT PRIMARY KEY AUTO_INCREMENT,
+					subscription_id BIGINT NOT NULL,
+					event_key 		CHAR(32) NOT NULL,
+					event_type 		VARCHAR(64) NOT NULL,
+					payload 		MEDIUMTEXT NOT NULL,
+					status 			VARCHAR(16) NOT NULL,
+					attempts 		INT NOT NULL DEFAULT 0,
+					response_code 	INT NOT NULL DEFAULT 0,
+					last_error 		TEXT,
+					next_attempt_at DATETIME(3) NOT NULL,
+					created_at 		DATETIME(3) NOT NULL,
+					delivered_at 	DATETIME(3) NULL,
+					INDEX idx_delivery_due (status, next_attempt_at),
+					INDEX idx_delivery_subscription (subscription_id, id),
+					UNIQUE INDEX idx_delivery_event (subscription_id, event_key)
+		)`,
+	} {
+		_, err := db.ExecContext(ctx, query)
+		if err != nil {
+			log.Fatalf("Error %s, Description: %s", err, ErrCreatingTableMySQL)
+		}
+	}
+
+	if err := migrateEventKey(ctx, db); err != nil {
+		log.Fatalf("Error %s, Description: %s", err, ErrCreatingTableMySQL)
+	}
+
+	return &WebhooksRepoMySQL{DB: db}
+}
+
+// таблица отправок, созданная до появления outbox, не имеет ключа события.
+// Старым строкам достается ключ из их id: повторно они все равно не публикуются
+func migrateEventKey(ctx context.Context, db *sql.DB) error {
+	var count int
+	err := db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'webhook_deliveries' AND COLUMN_NAME = 'event_key'",
+	).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		for _, query := range []string{
+			"ALTER TABLE webhook_deliveries ADD COLUMN event_key CHAR(32) NULL AFTER subscription_id",
+			"UPDATE webhook_deliveries SET `event_key` = LPAD(HEX(id), 32, '0') WHERE event_key IS NULL",
+			"ALTER TABLE webhook_deliveries MODIFY COLUMN event_key CHAR(32) NOT NULL",
+		} {
+			if _, err = db.ExecContext(ctx, query); err != nil {
+				return err
+			}
+		}
+	}
+
+	err = db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'webhook_deliveries' AND INDEX_NAME = 'idx_delivery_event'",
+	).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	_, err = db.ExecContext(ctx, "ALTER TABLE webhook_deliveries ADD UNIQUE INDEX idx_delivery_event (subscription_id, event_key)")
+	return err
+}
+
+func (repo *WebhooksRepoMySQL) AddSubscription(ctx context.Context, sub *service.WebhookSubscription) (uint64, error) {
+	res, err := repo.DB.ExecContext(ctx,
+		"INSERT INTO webhook_subscriptions (`owner`, `url`, `secret`, `events`, `created_at`) VALUES (?, ?, ?, ?, ?)",
+		sub.Owner,
+		sub.URL,
+		sub.Secret,
+		strings.Join(sub.Events, ","),
+		sub.CreatedAt,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("insert mysql error: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("insert (last inserted ID) mysql error: %w", err)
+	}
+	return uint64(id), nil
+}
+
+const selectSubscriptions = "SELECT id, owner, url, secret, events, created_at FROM webhook_subscriptions"
+
+func (repo *WebhooksRepoMySQL) GetSubscription(ctx context.Context, id uint64) (*service.WebhookSubscription, error) {
+	subs, err := repo.getSubscriptions(ctx, selectSubscriptions+" WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(subs) == 0 {
+		return nil, service.ErrNoSubscription
+	}
+	return subs[0], nil
+}
+
+func (repo *WebhooksRepoMySQL) GetSubscriptions(ctx context.Context, owner string) ([]*service.WebhookSubscription, error) {
+	return repo.getSubscriptions(ctx, selectSubscriptions+" WHERE owner = ?", owner)
+}
+
+func (repo *WebhooksRepoMySQL) GetAllSubscriptions(ctx context.Context) ([]*service.WebhookSubscription, error) {
+	return repo.getSubscriptions(ctx, selectSubscriptions)
+}
+
+func (repo *WebhooksRepoMySQL) DeleteSubscription(ctx context.Context, id uint64) error {
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx mysql error: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM webhook_deliveries WHERE subscription_id = ?", id); err != nil {
+		return fmt.Errorf("delete mysql error: %w", err)
+	}
+	if _, err = tx.ExecContext(ctx, "DELETE FROM webhook_subscriptions WHERE id = ?", id); err != nil {
+		return fmt.Errorf("delete mysql error: %w", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("commit mysql error: %w", err)
+	}
+	return nil
+}
+
+func (repo *WebhooksRepoMySQL) AddDelivery(ctx context.Context, d *service.WebhookDelivery) error {
+	res, err := repo.DB.ExecContext(ctx,
+		"INSERT IGNORE INTO webhook_deliveries (`subscription_id`, `event_key`, `event_type`, `payload`, `status`, `attempts`, `next_attempt_at`, `created_at`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		d.SubscriptionID,
+		d.EventKey,
+		d.EventType,
+		d.Payload,
+		d.Status,
+		d.Attempts,
+		d.NextAttemptAt,
+		d.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("insert mysql error: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("insert (last inserted ID) mysql error: %w", err)
+	}
+	d.ID = uint64(id)
+	return nil
+}
+
+const selectDeliveries = "SELECT id, subscription_id, event_key, event_type, payload, status, attempts, response_code, " +
+	"COALESCE(last_error, ''), next_attempt_at, created_at, delivered_at FROM webhook_deliveries"
+
+// строки, выбранные другим экземпляром, пропускаются, а выбранные откладываются до until,
+// поэтому одну отправку не возьмут дважды, пока идет попытка
+func (repo *WebhooksRepoMySQL) ClaimDueDeliveries(ctx context.Context, now, until time.Time, limit int) ([]*service.WebhookDelivery, error) {
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx mysql error: %w", err)
+	}
+	defer tx.Rollback()
+
+	deliveries, err := getDeliveries(ctx, tx,
+		selectDeliveries+" WHERE status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at LIMIT ? FOR UPDATE SKIP LOCKED",
+		service.DeliveryPending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(deliveries) == 0 {
+		return deliveries, nil
+	}
+
+	args := []interface{}{until}
+	for _, d := range deliveries {
+		args = append(args, d.ID)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(deliveries)), ",")
+	_, err = tx.ExecContext(ctx, "UPDATE webhook_deliveries SET `next_attempt_at` = ? WHERE id IN ("+placeholders+")", args...)
+	if err != nil {
+		return nil, fmt.Errorf("update mysql error: %w", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit mysql error: %w", err)
+	}
+	return deliveries, nil
+}
+
+func (repo *WebhooksRepoMySQL) GetDeliveries(ctx context.Context, subscriptionId uint64, limit int) ([]*service.WebhookDelivery, error) {
+	return getDeliveries(ctx, repo.DB, selectDeliveries+" WHERE subscription_id = ? ORDER BY id DESC LIMIT ?", subscriptionId, limit)
+}
+
+func (repo *WebhooksRepoMySQL) UpdateDelivery(ctx context.Context, d *service.WebhookDelivery) error {
+	_, err := repo.DB.ExecContext(ctx,
+		"UPDATE webhook_deliveries SET `status` = ?, `attempts` = ?, `response_code` = ?, `last_error` = ?, `next_attempt_at` = ?, `delivered_at` = ? WHERE id = ?",
+		d.Status,
+		d.Attempts,
+		d.ResponseCode,
+		d.LastError,
+		d.NextAttemptAt,
+		d.DeliveredAt,
+		d.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("update mysql error: %w", err)
+	}
+	return nil
+}
+
+func (repo *WebhooksRepoMySQL) getSubscriptions(ctx context.Context, query string, args ...interface{}) ([]*service.WebhookSubscription, error) {
+	rows, err := repo.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("select mysql error: %w", err)
+	}
+	defer rows.Close()
+
+	subs := []*service.WebhookSubscription{}
+	for rows.Next() {
+		sub := &service.WebhookSubscription{}
+		var events string
+		err = rows.Scan(&sub.ID, &sub.Owner, &sub.URL, &sub.Secret, &events, &sub.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("scanning mysql error: %w", err)
+		}
+		sub.Events = strings.Split(events, ",")
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func getDeliveries(ctx context.Context, q queryer, query string, args ...interface{}) ([]*service.WebhookDelivery, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("select mysql error: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []*service.WebhookDelivery{}
+	for rows.Next() {
+		d := &service.WebhookDelivery{}
+		var deliveredAt sql.NullTime
+		err = rows.Scan(&d.ID, &d.SubscriptionID, &d.EventKey, &d.EventType, &d.Payload, &d.Status, &d.Attempts,
+			&d.ResponseCode, &d.LastError, &d.NextAttemptAt, &d.CreatedAt, &deliveredAt)
+		if err != nil {
+			return nil, fmt.Errorf("scanning mysql error: %w", err)
+		}
+		if deliveredAt.Valid {
+			d.DeliveredAt = &deliveredAt.Time
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,211 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+)
+
+type UsersStorage struct {
+	next service.UsersStorage
+	storageSpans
+}
+
+func NewUsersStorage(next service.UsersStorage) *UsersStorage {
+	return &UsersStorage{next: next, storageSpans: storageSpans{system: semconv.DBSystemNameMongoDB, storage: "users"}}
+}
+
+func (s *UsersStorage) GetUser(ctx context.Context, username string) (user *service.User, err error) {
+	ctx, span := s.start(ctx, "GetUser")
+	defer end(span, &err)
+	return s.next.GetUser(ctx, username)
+}
+
+func (s *UsersStorage) AddUser(ctx context.Context, user *service.User) (err error) {
+	ctx, span := s.start(ctx, "AddUser")
+	defer end(span, &err)
+	return s.next.AddUser(ctx, user)
+}
+
+func (s *UsersStorage) GetUserNames(ctx context.Context, prefix string, limit int) (names []string, err error) {
+	ctx, span := s.start(ctx, "GetUserNames")
+	defer end(span, &err)
+	return s.next.GetUserNames(ctx, prefix, limit)
+}
+
+func (s *UsersStorage) GetUsers(ctx context.Context, usernames []string) (users []*service.User, err error) {
+	ctx, span := s.start(ctx, "GetUsers")
+	defer end(span, &err)
+	return s.next.GetUsers(ctx, usernames)
+}
+
+func (s *UsersStorage) SetNotifications(ctx context.Context, username string, settings *service.NotificationSettings) (err error) {
+	ctx, span := s.start(ctx, "SetNotifications")
+	defer end(span, &err)
+	return s.next.SetNotifications(ctx, username, settings)
+}
+
+func (s *UsersStorage) UpdateExternalUser(ctx context.Context, username, email string, roles []string) (err error) {
+	ctx, span := s.start(ctx, "UpdateExternalUser")
+	defer end(span, &err)
+	return s.next.UpdateExternalUser(ctx, username, email, roles)
+}
+
+func (s *UsersStorage) SetTOTP(ctx context.Context, username string, settings *service.TOTPSettings) (err error) {
+	ctx, span := s.start(ctx, "SetTOTP")
+	defer end(span, &err)
+	return s.next.SetTOTP(ctx, username, settings)
+}
+
+func (s *UsersStorage) UseTOTPStep(ctx context.Context, username string, step int64) (err error) {
+	ctx, span := s.start(ctx, "UseTOTPStep")
+	defer end(span, &err)
+	return s.next.UseTOTPStep(ctx, username, step)
+}
+
+func (s *UsersStorage) UseRecoveryCode(ctx context.Context, username, hash string) (err error) {
+	ctx, span := s.start(ctx, "UseRecoveryCode")
+	defer end(span, &err)
+	return s.next.UseRecoveryCode(ctx, username, hash)
+}
+
+func (s *UsersStorage) SetPassword(ctx context.Context, username, password string) (err error) {
+	ctx, span := s.start(ctx, "SetPassword")
+	defer end(span, &err)
+	return s.next.SetPassword(ctx, username, password)
+}
+
+func (s *UsersStorage) UpdateProfile(ctx context.Context, username, displayName, email string) (err error) {
+	ctx, span := s.start(ctx, "UpdateProfile")
+	defer end(span, &err)
+	return s.next.UpdateProfile(ctx, username, displayName, email)
+}
+
+func (s *UsersStorage) SetPasswordReset(ctx context.Context, username string, reset *service.PasswordReset) (err error) {
+	ctx, span := s.start(ctx, "SetPasswordReset")
+	defer end(span, &err)
+	return s.next.SetPasswordReset(ctx, username, reset)
+}
+
+func (s *UsersStorage) ResetPassword(ctx context.Context, hash, password string, now time.Time) (username string, err error) {
+	ctx, span := s.start(ctx, "ResetPassword")
+	defer end(span, &err)
+	return s.next.ResetPassword(ctx, hash, password, now)
+}
+
+func (s *UsersStorage) ListUsers(ctx context.Context, query string, offset, limit int) (users []*service.User, total int64, err error) {
+	ctx, span := s.start(ctx, "ListUsers")
+	defer end(span, &err)
+	return s.next.ListUsers(ctx, query, offset, limit)
+}
+
+func (s *UsersStorage) SetDisabled(ctx context.Context, username string, disabled bool) (err error) {
+	ctx, span := s.start(ctx, "SetDisabled")
+	defer end(span, &err)
+	return s.next.SetDisabled(ctx, username, disabled)
+}
+
+func (s *UsersStorage) AddRole(ctx context.Context, username, role string) (err error) {
+	ctx, span := s.start(ctx, "AddRole")
+	defer end(span, &err)
+	return s.next.AddRole(ctx, username, role)
+}
+
+func (s *UsersStorage) DeleteUser(ctx context.Context, username string) (err error) {
+	ctx, span := s.start(ctx, "DeleteUser")
+	defer end(span, &err)
+	return s.next.DeleteUser(ctx, username)
+}
+
+type TokensStorage struct {
+	next service.TokensStorage
+	storageSpans
+}
+
+func NewTokensStorage(next service.TokensStorage) *TokensStorage {
+	return &TokensStorage{next: next, storageSpans: storageSpans{system: semconv.DBSystemNameMongoDB, storage: "tokens"}}
+}
+
+func (s *TokensStorage) AddToken(ctx context.Context, token *service.APIToken) (err error) {
+	ctx, span := s.start(ctx, "AddToken")
+	defer end(span, &err)
+	return s.next.AddToken(ctx, token)
+}
+
+func (s *TokensStorage) GetTokenByHash(ctx context.Context, hash string) (token *service.APIToken, err error) {
+	ctx, span := s.start(ctx, "GetTokenByHash")
+	defer end(span, &err)
+	return s.next.GetTokenByHash(ctx, hash)
+}
+
+func (s *TokensStorage) GetTokens(ctx context.Context, username string) (tokens []*service.APIToken, err error) {
+	ctx, span := s.start(ctx, "GetTokens")
+	defer end(span, &err)
+	return s.next.GetTokens(ctx, username)
+}
+
+func (s *TokensStorage) DeleteToken(ctx context.Context, id string, username string) (err error) {
+	ctx, span := s.start(ctx, "DeleteToken")
+	defer end(span, &err)
+	return s.next.DeleteToken(ctx, id, username)
+}
+
+func (s *TokensStorage) SetTokenLastUsed(ctx context.Context, id string, t time.Time) (err error) {
+	ctx, span := s.start(ctx, "SetTokenLastUsed")
+	defer end(span, &err)
+	return s.next.SetTokenLastUsed(ctx, id, t)
+}
+
+func (s *TokensStorage) DeleteUserTokens(ctx context.Context, username string) (err error) {
+	ctx, span := s.start(ctx, "DeleteUserTokens")
+	defer end(span, &err)
+	return s.next.DeleteUserTokens(ctx, username)
+}
+
+type TeamsStorage struct {
+	next service.TeamsStorage
+	storageSpans
+}
+
+func NewTeamsStorage(next service.TeamsStorage) *TeamsStorage {
+	return &TeamsStorage{next: next, storageSpans: storageSpans{system: semconv.DBSystemNameMongoDB, storage: "teams"}}
+}
+
+func (s *TeamsStorage) AddTeam(ctx context.Context, team *service.Team) (err error) {
+	ctx, span := s.start(ctx, "AddTeam")
+	defer end(span, &err)
+	return s.next.AddTeam(ctx, team)
+}
+
+func (s *TeamsStorage) GetTeam(ctx context.Context, name string) (team *service.Team, err error) {
+	ctx, span := s.start(ctx, "GetTeam")
+	defer end(span, &err)
+	return s.next.GetTeam(ctx, name)
+}
+
+func (s *TeamsStorage) GetTeams(ctx context.Context) (teams []*service.Team, err error) {
+	ctx, span := s.start(ctx, "GetTeams")
+	defer end(span, &err)
+	return s.next.GetTeams(ctx)
+}
+
+func (s *TeamsStorage) GetUserTeams(ctx context.Context, username string) (names []string, err error) {
+	ctx, span := s.start(ctx, "GetUserTeams")
+	defer end(span, &err)
+	return s.next.GetUserTeams(ctx, username)
+}
+
+func (s *TeamsStorage) AddTeamMember(ctx context.Context, name, username string) (err error) {
+	ctx, span := s.start(ctx, "AddTeamMember")
+	defer end(span, &err)
+	return s.next.AddTeamMember(ctx, name, username)
+}
+
+func (s *TeamsStorage) RemoveTeamMember(ctx context.Context, name, username string) (err error) {
+	ctx, span := s.start(ctx, "RemoveTeamMember")
+	defer end(span, &err)
+	return s.next.RemoveTeamMember(ctx, name, username)
+}
@@ -0,0 +1,247 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+)
+
+type TasksStorage struct {
+	next service.TasksStorage
+	storageSpans
+}
+
+func NewTasksStorage(next service.TasksStorage) *TasksStorage {
+	return &TasksStorage{next: next, storageSpans: storageSpans{system: semconv.DBSystemNameMySQL, storage: "tasks"}}
+}
+
+func (s *TasksStorage) GetAllTasks(ctx context.Context) (tasks []*service.Task, err error) {
+	ctx, span := s.start(ctx, "GetAllTasks")
+	defer end(span, &err)
+	return s.next.GetAllTasks(ctx)
+}
+
+func (s *TasksStorage) GetCreatedTasks(ctx context.Context, username string) (tasks []*service.Task, err error) {
+	ctx, span := s.start(ctx, "GetCreatedTasks")
+	defer end(span, &err)
+	return s.next.GetCreatedTasks(ctx, username)
+}
+
+func (s *TasksStorage) GetMyTasks(ctx context.Context, username string, teams []string) (tasks []*service.Task, err error) {
+	ctx, span := s.start(ctx, "GetMyTasks")
+	defer end(span, &err)
+	return s.next.GetMyTasks(ctx, username, teams)
+}
+
+func (s *TasksStorage) GetTask(ctx context.Context, taskId uint64) (task *service.Task, err error) {
+	ctx, span := s.start(ctx, "GetTask")
+	defer end(span, &err)
+	return s.next.GetTask(ctx, taskId)
+}
+
+func (s *TasksStorage) Add(ctx context.Context, task *service.Task) (id uint64, err error) {
+	ctx, span := s.start(ctx, "Add")
+	defer end(span, &err)
+	return s.next.Add(ctx, task)
+}
+
+func (s *TasksStorage) Assign(ctx context.Context, taskId uint64, username string) (err error) {
+	ctx, span := s.start(ctx, "Assign")
+	defer end(span, &err)
+	return s.next.Assign(ctx, taskId, username)
+}
+
+func (s *TasksStorage) Unassign(ctx context.Context, taskId uint64, username string) (err error) {
+	ctx, span := s.start(ctx, "Unassign")
+	defer end(span, &err)
+	return s.next.Unassign(ctx, taskId, username)
+}
+
+func (s *TasksStorage) AssignTeam(ctx context.Context, taskId uint64, team string) (err error) {
+	ctx, span := s.start(ctx, "AssignTeam")
+	defer end(span, &err)
+	return s.next.AssignTeam(ctx, taskId, team)
+}
+
+func (s *TasksStorage) UnassignTeam(ctx context.Context, taskId uint64, team string) (err error) {
+	ctx, span := s.start(ctx, "UnassignTeam")
+	defer end(span, &err)
+	return s.next.UnassignTeam(ctx, taskId, team)
+}
+
+func (s *TasksStorage) Claim(ctx context.Context, taskId uint64, team, username string) (err error) {
+	ctx, span := s.start(ctx, "Claim")
+	defer end(span, &err)
+	return s.next.Claim(ctx, taskId, team, username)
+}
+
+func (s *TasksStorage) Complete(ctx context.Context, taskId uint64) (err error) {
+	ctx, span := s.start(ctx, "Complete")
+	defer end(span, &err)
+	return s.next.Complete(ctx, taskId)
+}
+
+func (s *TasksStorage) SetStatus(ctx context.Context, taskId uint64, status string) (err error) {
+	ctx, span := s.start(ctx, "SetStatus")
+	defer end(span, &err)
+	return s.next.SetStatus(ctx, taskId, status)
+}
+
+func (s *TasksStorage) Watch(ctx context.Context, taskId uint64, username string) (err error) {
+	ctx, span := s.start(ctx, "Watch")
+	defer end(span, &err)
+	return s.next.Watch(ctx, taskId, username)
+}
+
+func (s *TasksStorage) Unwatch(ctx context.Context, taskId uint64, username string) (err error) {
+	ctx, span := s.start(ctx, "Unwatch")
+	defer end(span, &err)
+	return s.next.Unwatch(ctx, taskId, username)
+}
+
+type OutboxStorage struct {
+	next service.OutboxStorage
+	storageSpans
+}
+
+func NewOutboxStorage(next service.OutboxStorage) *OutboxStorage {
+	return &OutboxStorage{next: next, storageSpans: storageSpans{system: semconv.DBSystemNameMySQL, storage: "outbox"}}
+}
+
+func (s *OutboxStorage) GetPendingEvents(ctx context.Context, limit int) (events []*service.OutboxEvent, err error) {
+	ctx, span := s.start(ctx, "GetPendingEvents")
+	defer end(span, &err)
+	return s.next.GetPendingEvents(ctx, limit)
+}
+
+func (s *OutboxStorage) MarkDelivered(ctx context.Context, id uint64) (err error) {
+	ctx, span := s.start(ctx, "MarkDelivered")
+	defer end(span, &err)
+	return s.next.MarkDelivered(ctx, id)
+}
+
+func (s *OutboxStorage) DeleteDeliveredEvents(ctx context.Context, before time.Time) (err error) {
+	ctx, span := s.start(ctx, "DeleteDeliveredEvents")
+	defer end(span, &err)
+	return s.next.DeleteDeliveredEvents(ctx, before)
+}
+
+type DueTasksStorage struct {
+	next service.DueTasksStorage
+	storageSpans
+}
+
+func NewDueTasksStorage(next service.DueTasksStorage) *DueTasksStorage {
+	return &DueTasksStorage{next: next, storageSpans: storageSpans{system: semconv.DBSystemNameMySQL, storage: "tasks"}}
+}
+
+func (s *DueTasksStorage) GetTasksDueBefore(ctx context.Context, before time.Time) (tasks []*service.Task, err error) {
+	ctx, span := s.start(ctx, "GetTasksDueBefore")
+	defer end(span, &err)
+	return s.next.GetTasksDueBefore(ctx, before)
+}
+
+func (s *DueTasksStorage) MarkDueNotified(ctx context.Context, taskId uint64) (err error) {
+	ctx, span := s.start(ctx, "MarkDueNotified")
+	defer end(span, &err)
+	return s.next.MarkDueNotified(ctx, taskId)
+}
+
+type WebhooksStorage struct {
+	next service.WebhooksStorage
+	storageSpans
+}
+
+func NewWebhooksStorage(next service.WebhooksStorage) *WebhooksStorage {
+	return &WebhooksStorage{next: next, storageSpans: storageSpans{system: semconv.DBSystemNameMySQL, storage: "webhooks"}}
+}
+
+func (s *WebhooksStorage) AddSubscription(ctx context.Context, sub *service.WebhookSubscription) (id uint64, err error) {
+	ctx, span := s.start(ctx, "AddSubscription")
+	defer end(span, &err)
+	return s.next.AddSubscription(ctx, sub)
+}
+
+func (s *WebhooksStorage) GetSubscription(ctx context.Context, id uint64) (sub *service.WebhookSubscription, err error) {
+	ctx, span := s.start(ctx, "GetSubscription")
+	defer end(span, &err)
+	return s.next.GetSubscription(ctx, id)
+}
+
+func (s *WebhooksStorage) GetSubscriptions(ctx context.Context, owner string) (subs []*service.WebhookSubscription, err error) {
+	ctx, span := s.start(ctx, "GetSubscriptions")
+	defer end(span, &err)
+	return s.next.GetSubscriptions(ctx, owner)
+}
+
+func (s *WebhooksStorage) GetAllSubscriptions(ctx context.Context) (subs []*service.WebhookSubscription, err error) {
+	ctx, span := s.start(ctx, "GetAllSubscriptions")
+	defer end(span, &err)
+	return s.next.GetAllSubscriptions(ctx)
+}
+
+func (s *WebhooksStorage) DeleteSubscription(ctx context.Context, id uint64) (err error) {
+	ctx, span := s.start(ctx, "DeleteSubscription")
+	defer end(span, &err)
+	return s.next.DeleteSubscription(ctx, id)
+}
+
+func (s *WebhooksStorage) AddDelivery(ctx context.Context, delivery *service.WebhookDelivery) (err error) {
+	ctx, span := s.start(ctx, "AddDelivery")
+	defer end(span, &err)
+	return s.next.AddDelivery(ctx, delivery)
+}
+
+func (s *WebhooksStorage) ClaimDueDeliveries(ctx context.Context, now, until time.Time, limit int) (deliveries []*service.WebhookDelivery, err error) {
+	ctx, span := s.start(ctx, "ClaimDueDeliveries")
+	defer end(span, &err)
+	return s.next.ClaimDueDeliveries(ctx, now, until, limit)
+}
+
+func (s *WebhooksStorage) UpdateDelivery(ctx context.Context, delivery *service.WebhookDelivery) (err error) {
+	ctx, span := s.start(ctx, "UpdateDelivery")
+	defer end(span, &err)
+	return s.next.UpdateDelivery(ctx, delivery)
+}
+
+func (s *WebhooksStorage) GetDeliveries(ctx context.Context, subscriptionId uint64, limit int) (deliveries []*service.WebhookDelivery, err error) {
+	ctx, span := s.start(ctx, "GetDeliveries")
+	defer end(span, &err)
+	return s.next.GetDeliveries(ctx, subscriptionId, limit)
+}
+
+type MailStorage struct {
+	next service.MailStorage
+	storageSpans
+}
+
+func NewMailStorage(next service.MailStorage) *MailStorage {
+	return &MailStorage{next: next, storageSpans: storageSpans{system: semconv.DBSystemNameMySQL, storage: "mail"}}
+}
+
+func (s *MailStorage) AddMail(ctx context.Context, mail *service.Mail) (err error) {
+	ctx, span := s.start(ctx, "AddMail")
+	defer end(span, &err)
+	return s.next.AddMail(ctx, mail)
+}
+
+func (s *MailStorage) ClaimDueMails(ctx context.Context, now, until time.Time, limit int) (mails []*service.Mail, err error) {
+	ctx, span := s.start(ctx, "ClaimDueMails")
+	defer end(span, &err)
+	return s.next.ClaimDueMails(ctx, now, until, limit)
+}
+
+func (s *MailStorage) UpdateMail(ctx context.Context, mail *service.Mail) (err error) {
+	ctx, span := s.start(ctx, "UpdateMail")
+	defer end(span, &err)
+	return s.next.UpdateMail(ctx, mail)
+}
+
+func (s *MailStorage) DeleteFinishedMails(ctx context.Context, before time.Time) (err error) {
+	ctx, span := s.start(ctx, "DeleteFinishedMails")
+	defer end(span, &err)
+	return s.next.DeleteFinishedMails(ctx, before)
+}
@@ -0,0 +1,127 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+)
+
+type SessionsStorage struct {
+	next service.SessionsStorage
+	storageSpans
+}
+
+func NewSessionsStorage(next service.SessionsStorage) *SessionsStorage {
+	return &SessionsStorage{next: next, storageSpans: storageSpans{system: semconv.DBSystemNameRedis, storage: "sessions"}}
+}
+
+func (s *SessionsStorage) GetUser(ctx context.Context, cookieVal string) (username string, err error) {
+	ctx, span := s.start(ctx, "GetUser")
+	defer end(span, &err)
+	return s.next.GetUser(ctx, cookieVal)
+}
+
+func (s *SessionsStorage) Add(ctx context.Context, cookieVal string, username string, dur time.Duration) (err error) {
+	ctx, span := s.start(ctx, "Add")
+	defer end(span, &err)
+	return s.next.Add(ctx, cookieVal, username, dur)
+}
+
+func (s *SessionsStorage) Delete(ctx context.Context, cookieVal string) (err error) {
+	ctx, span := s.start(ctx, "Delete")
+	defer end(span, &err)
+	return s.next.Delete(ctx, cookieVal)
+}
+
+func (s *SessionsStorage) Take(ctx context.Context, cookieVal string) (_ string, err error) {
+	ctx, span := s.start(ctx, "Take")
+	defer end(span, &err)
+	return s.next.Take(ctx, cookieVal)
+}
+
+func (s *SessionsStorage) AddSessionInfo(ctx context.Context, info *service.SessionInfo, dur time.Duration) (err error) {
+	ctx, span := s.start(ctx, "AddSessionInfo")
+	defer end(span, &err)
+	return s.next.AddSessionInfo(ctx, info, dur)
+}
+
+func (s *SessionsStorage) GetSessionInfo(ctx context.Context, id string) (info *service.SessionInfo, err error) {
+	ctx, span := s.start(ctx, "GetSessionInfo")
+	defer end(span, &err)
+	return s.next.GetSessionInfo(ctx, id)
+}
+
+func (s *SessionsStorage) GetSessionInfos(ctx context.Context, username string) (infos []*service.SessionInfo, err error) {
+	ctx, span := s.start(ctx, "GetSessionInfos")
+	defer end(span, &err)
+	return s.next.GetSessionInfos(ctx, username)
+}
+
+func (s *SessionsStorage) Expire(ctx context.Context, cookieVal string, dur time.Duration) (err error) {
+	ctx, span := s.start(ctx, "Expire")
+	defer end(span, &err)
+	return s.next.Expire(ctx, cookieVal, dur)
+}
+
+func (s *SessionsStorage) TouchSessionInfo(ctx context.Context, username, id string, lastSeen time.Time, dur time.Duration) (err error) {
+	ctx, span := s.start(ctx, "TouchSessionInfo")
+	defer end(span, &err)
+	return s.next.TouchSessionInfo(ctx, username, id, lastSeen, dur)
+}
+
+func (s *SessionsStorage) DeleteSessionInfo(ctx context.Context, username, id string) (err error) {
+	ctx, span := s.start(ctx, "DeleteSessionInfo")
+	defer end(span, &err)
+	return s.next.DeleteSessionInfo(ctx, username, id)
+}
+
+func (s *SessionsStorage) CSRFToken(ctx context.Context, id, newToken string) (token string, err error) {
+	ctx, span := s.start(ctx, "CSRFToken")
+	defer end(span, &err)
+	return s.next.CSRFToken(ctx, id, newToken)
+}
+
+type LoginAttemptsStorage struct {
+	next service.LoginAttemptsStorage
+	storageSpans
+}
+
+func NewLoginAttemptsStorage(next service.LoginAttemptsStorage) *LoginAttemptsStorage {
+	return &LoginAttemptsStorage{next: next, storageSpans: storageSpans{system: semconv.DBSystemNameRedis, storage: "login_attempts"}}
+}
+
+func (s *LoginAttemptsStorage) RegisterFailure(ctx context.Context, key string, ttl time.Duration) (n int64, err error) {
+	ctx, span := s.start(ctx, "RegisterFailure")
+	defer end(span, &err)
+	return s.next.RegisterFailure(ctx, key, ttl)
+}
+
+func (s *LoginAttemptsStorage) Failures(ctx context.Context, key string) (n int64, ttl time.Duration, err error) {
+	ctx, span := s.start(ctx, "Failures")
+	defer end(span, &err)
+	return s.next.Failures(ctx, key)
+}
+
+func (s *LoginAttemptsStorage) Reset(ctx context.Context, key string) (err error) {
+	ctx, span := s.start(ctx, "Reset")
+	defer end(span, &err)
+	return s.next.Reset(ctx, key)
+}
+
+type RateLimitStorage struct {
+	next service.RateLimitStorage
+	storageSpans
+}
+
+func NewRateLimitStorage(next service.RateLimitStorage) *RateLimitStorage {
+	return &RateLimitStorage{next: next, storageSpans: storageSpans{system: semconv.DBSystemNameRedis, storage: "rate_limit"}}
+}
+
+func (s *RateLimitStorage) Take(ctx context.Context, key string, rate float64, burst int) (allowed bool, tokens float64, err error) {
+	ctx, span := s.start(ctx, "Take")
+	defer end(span, &err)
+	return s.next.Take(ctx, key, rate, burst)
+}
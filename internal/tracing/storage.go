@@ -0,0 +1,39 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// атрибуты спанов одного хранилища, общие для всех его методов
+type storageSpans struct {
+	system  attribute.KeyValue
+	storage string
+}
+
+// начинает дочерний спан вызова хранилища, ctx со спаном нужно передать в сам вызов.
+// Опрос очереди без родительского спана не трассируется, см. service.WithPolling
+func (s storageSpans) start(ctx context.Context, method string) (context.Context, trace.Span) {
+	if service.IsPolling(ctx) && !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+	return tracer.Start(ctx, s.storage+"."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(s.system, semconv.DBOperationName(method), attribute.String("storage", s.storage)),
+	)
+}
+
+// вызывается через defer: ожидаемые ответы хранилища, например "не найдено", не отмечают спан ошибкой
+func end(span trace.Span, err *error) {
+	if *err != nil && !service.IsExpectedStorageError(*err) {
+		span.RecordError(*err)
+		span.SetStatus(codes.Error, (*err).Error())
+	}
+	span.End()
+}
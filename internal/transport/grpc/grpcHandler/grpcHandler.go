@@ -0,0 +1,219 @@
+package grpcHandler
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+	"github.com/RusGadzhiev/TaskManager/internal/transport/grpc/pb"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const authorizationKey = "authorization"
+
+type ctxKey struct{}
+
+// методы, доступные без авторизации
+var publicMethods = map[string]bool{
+	pb.UsersService_Register_FullMethodName:   true,
+	pb.SessionsService_Login_FullMethodName:   true,
+	pb.SessionsService_Refresh_FullMethodName: true,
+}
+
+// методы, которым API токену достаточно scope read
+var readMethods = map[string]bool{
+	pb.TasksService_ListTasks_FullMethodName: true,
+	pb.TasksService_GetTask_FullMethodName:   true,
+}
+
+// методы сервиса, которые используют gRPC обработчики
+type Service interface {
+	// возвращает ошибку service.ErrUserExist если юзер уже есть, *service.ValidationError если данные не подходят
+	AddUser(ctx context.Context, user *service.User) error
+	// возвращает ошибку service.ErrNoUser если юзера нет, ошбику service.ErrIncorrectPassword если пароль неверный,
+	// service.ErrUserDisabled если пользователь отключен
+	Authentificate(ctx context.Context, user *service.User) error
+	// возвращает ошибку *service.UnknownUserError с похожими логинами если юзера нет
+	ValidateUser(ctx context.Context, username string) error
+
+	// возвращает *service.LockedError если вход для логина или адреса временно заблокирован
+	CheckLogin(ctx context.Context, username, ip string) error
+	LoginFailed(ctx context.Context, username, ip string)
+	LoginSucceeded(ctx context.Context, username string)
+	TwoFactorEnabled(ctx context.Context, username string) (bool, error)
+	// возвращает service.ErrBadOTP если код не подошел
+	VerifyTwoFactor(ctx context.Context, username, code string) error
+
+	AddCookie(ctx context.Context, username string, client service.ClientInfo, remember bool) (*service.Session, error)
+	TouchCookie(ctx context.Context, cookieVal string) (*service.Session, error)
+	GetUserByCookie(ctx context.Context, cookieVal string) (string, error)
+	// возвращает service.ErrNoUserBySession если обновить нельзя
+	RefreshCookie(ctx context.Context, refreshVal string) (*service.Session, error)
+	DeleteCookie(ctx context.Context, cookieVal string) error
+	// возвращает ошибку service.ErrNoToken или service.ErrTokenExpired если токен недействителен
+	AuthenticateToken(ctx context.Context, raw string) (*service.APIToken, error)
+
+	GetAllTasks(ctx context.Context) ([]*service.Task, error)
+	GetCreatedTasks(ctx context.Context, username string) ([]*service.Task, error)
+	GetMyTasks(ctx context.Context, username string) ([]*service.Task, error)
+	// возвращает ошибку service.ErrNoTask если задачи нет
+	GetTask(ctx context.Context, taskId uint64) (*service.Task, error)
+	// возвращает ошибку service.ErrNotOwner если username не владелец задачи, service.ErrNoTask если задачи нет
+	CheckOwner(ctx context.Context, taskId uint64, username string) error
+	Add(ctx context.Context, task *service.Task) (uint64, error)
+	Assign(ctx context.Context, taskId uint64, username string) error
+	Unassign(ctx context.Context, taskId uint64, username string) error
+	// возвращает ошибку service.ErrNotParticipant если username не владелец и не исполнитель задачи
+	Complete(ctx context.Context, taskId uint64, username string) error
+	// возвращает ошибку service.ErrBadStatus для неизвестного статуса, service.ErrNotParticipant
+	// если username не владелец и не исполнитель задачи
+	SetStatus(ctx context.Context, taskId uint64, username, status string) error
+	Watch(ctx context.Context, taskId uint64, username string) error
+	Unwatch(ctx context.Context, taskId uint64, username string) error
+}
+
+// GrpcHandler реализует gRPC сервисы поверх того же сервиса, что и httpHandler
+type GrpcHandler struct {
+	pb.UnimplementedTasksServiceServer
+	pb.UnimplementedUsersServiceServer
+	pb.UnimplementedSessionsServiceServer
+
+	service Service
+	logger  *zap.SugaredLogger
+}
+
+func NewGrpcHandler(s Service, logger *zap.SugaredLogger) *GrpcHandler {
+	return &GrpcHandler{
+		service: s,
+		logger:  logger,
+	}
+}
+
+func (h *GrpcHandler) RegisterServices(srv *grpc.Server) {
+	pb.RegisterTasksServiceServer(srv, h)
+	pb.RegisterUsersServiceServer(srv, h)
+	pb.RegisterSessionsServiceServer(srv, h)
+}
+
+// по токену из метаданных authorization: Bearer <token> кладет username в контекст.
+// Токеном может быть сессия из Login или API токен
+func (h *GrpcHandler) AuthInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if publicMethods[info.FullMethod] {
+		return handler(ctx, req)
+	}
+
+	token, err := tokenFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if service.IsAPIToken(token) {
+		return h.authAPIToken(ctx, token, req, info, handler)
+	}
+	username, err := h.service.GetUserByCookie(ctx, token)
+	if err == nil {
+		// сессия продлевается при активности, как и в HTTP
+		_, err = h.service.TouchCookie(ctx, token)
+	}
+	if err == service.ErrNoUserBySession {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	} else if err != nil {
+		h.logger.Error(err.Error())
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return handler(context.WithValue(service.WithActor(ctx, username), ctxKey{}, username), req)
+}
+
+func (h *GrpcHandler) authAPIToken(ctx context.Context, raw string, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	token, err := h.service.AuthenticateToken(ctx, raw)
+	if err == service.ErrNoToken || err == service.ErrTokenExpired {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	} else if err != nil {
+		h.logger.Error(err.Error())
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	scope := service.ScopeWrite
+	if readMethods[info.FullMethod] {
+		scope = service.ScopeRead
+	}
+	if !token.HasScope(scope) {
+		return nil, status.Error(codes.PermissionDenied, "token has no "+scope+" scope")
+	}
+	return handler(context.WithValue(service.WithActor(ctx, token.UserName), ctxKey{}, token.UserName), req)
+}
+
+func (h *GrpcHandler) LoggingInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	h.logger.Info("New gRPC request: ", info.FullMethod)
+	defer func() {
+		if rec := recover(); rec != nil {
+			h.logger.Error("Method: ", info.FullMethod, " Recovered: ", rec)
+			err = status.Error(codes.Internal, "internal server error")
+		}
+	}()
+	return handler(ctx, req)
+}
+
+func tokenFromContext(ctx context.Context) (string, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok || len(md.Get(authorizationKey)) == 0 {
+		return "", status.Error(codes.Unauthenticated, "missing authorization metadata")
+	}
+	token, ok := strings.CutPrefix(md.Get(authorizationKey)[0], "Bearer ")
+	if !ok || token == "" {
+		return "", status.Error(codes.Unauthenticated, "authorization must be a bearer token")
+	}
+	return token, nil
+}
+
+func usernameFromContext(ctx context.Context) string {
+	username, _ := ctx.Value(ctxKey{}).(string)
+	return username
+}
+
+// переводит ошибки сервиса в gRPC статусы
+func (h *GrpcHandler) toStatus(err error) error {
+	var unknown *service.UnknownUserError
+	var invalid *service.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.As(err, &unknown):
+		return status.Errorf(codes.InvalidArgument, "%s, did you mean: %s", err, strings.Join(unknown.Suggestions, ", "))
+	case err == service.ErrNoTask, err == service.ErrNoUser:
+		return status.Error(codes.NotFound, err.Error())
+	case err == service.ErrNotOwner, err == service.ErrNotParticipant, err == service.ErrUserDisabled:
+		return status.Error(codes.PermissionDenied, err.Error())
+	case err == service.ErrIncorrectPassword:
+		return status.Error(codes.Unauthenticated, err.Error())
+	case err == service.ErrUserExist:
+		return status.Error(codes.AlreadyExists, err.Error())
+	case err == service.ErrBadStatus, err == service.ErrBadEmail:
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	h.logger.Error(err.Error())
+	return status.Error(codes.Internal, err.Error())
+}
+
+func toPbTask(task *service.Task) *pb.Task {
+	res := &pb.Task{
+		Id:          task.ID,
+		Owner:       task.Owner,
+		Executors:   task.Executors,
+		Watchers:    task.Watchers,
+		Description: task.Description,
+		Status:      task.Status,
+		Completed:   task.Completed,
+		Assigned:    task.Assigned,
+	}
+	if task.DueAt != nil {
+		res.DueAt = timestamppb.New(*task.DueAt)
+	}
+	return res
+}
@@ -0,0 +1,132 @@
+package grpcHandler
+
+import (
+	"context"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+	"github.com/RusGadzhiev/TaskManager/internal/transport/grpc/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (h *GrpcHandler) ListTasks(ctx context.Context, req *pb.ListTasksRequest) (*pb.ListTasksResponse, error) {
+	username := usernameFromContext(ctx)
+	var tasks []*service.Task
+	var err error
+
+	switch req.Filter {
+	case pb.TaskFilter_TASK_FILTER_ALL:
+		tasks, err = h.service.GetAllTasks(ctx)
+	case pb.TaskFilter_TASK_FILTER_MY:
+		tasks, err = h.service.GetMyTasks(ctx, username)
+	case pb.TaskFilter_TASK_FILTER_CREATED:
+		tasks, err = h.service.GetCreatedTasks(ctx, username)
+	default:
+		return nil, status.Error(codes.InvalidArgument, "unknown filter")
+	}
+	if err != nil {
+		return nil, h.toStatus(err)
+	}
+
+	res := &pb.ListTasksResponse{Tasks: make([]*pb.Task, 0, len(tasks))}
+	for _, task := range tasks {
+		res.Tasks = append(res.Tasks, toPbTask(task))
+	}
+	return res, nil
+}
+
+func (h *GrpcHandler) GetTask(ctx context.Context, req *pb.GetTaskRequest) (*pb.Task, error) {
+	task, err := h.service.GetTask(ctx, req.TaskId)
+	if err != nil {
+		return nil, h.toStatus(err)
+	}
+	return toPbTask(task), nil
+}
+
+func (h *GrpcHandler) CreateTask(ctx context.Context, req *pb.CreateTaskRequest) (*pb.CreateTaskResponse, error) {
+	executors := []string{}
+	if req.Executor != "" {
+		if err := h.service.ValidateUser(ctx, req.Executor); err != nil {
+			return nil, h.toStatus(err)
+		}
+		executors = append(executors, req.Executor)
+	}
+
+	var dueAt *time.Time
+	if req.DueAt != nil {
+		t := req.DueAt.AsTime()
+		dueAt = &t
+	}
+
+	id, err := h.service.Add(ctx, &service.Task{
+		Owner:       usernameFromContext(ctx),
+		Executors:   executors,
+		Watchers:    []string{},
+		Description: req.Description,
+		Status:      service.StatusTodo,
+		DueAt:       dueAt,
+		Assigned:    len(executors) > 0,
+	})
+	if err != nil {
+		return nil, h.toStatus(err)
+	}
+	return &pb.CreateTaskResponse{TaskId: id}, nil
+}
+
+// без исполнителя назначает себя, назначать других может только владелец задачи
+func (h *GrpcHandler) Assign(ctx context.Context, req *pb.AssignRequest) (*pb.Empty, error) {
+	username := usernameFromContext(ctx)
+	executor := req.Executor
+	if executor == "" {
+		executor = username
+	} else if executor != username {
+		if err := h.service.CheckOwner(ctx, req.TaskId, username); err != nil {
+			return nil, h.toStatus(err)
+		}
+	}
+	if err := h.service.ValidateUser(ctx, executor); err != nil {
+		return nil, h.toStatus(err)
+	}
+	if err := h.service.Assign(ctx, req.TaskId, executor); err != nil {
+		return nil, h.toStatus(err)
+	}
+	return &pb.Empty{}, nil
+}
+
+// без исполнителя снимает себя, снимать других может только владелец задачи
+func (h *GrpcHandler) Unassign(ctx context.Context, req *pb.UnassignRequest) (*pb.Empty, error) {
+	username := usernameFromContext(ctx)
+	executor := req.Executor
+	if executor == "" {
+		executor = username
+	} else if executor != username {
+		if err := h.service.CheckOwner(ctx, req.TaskId, username); err != nil {
+			return nil, h.toStatus(err)
+		}
+	}
+	return h.empty(h.service.Unassign(ctx, req.TaskId, executor))
+}
+
+func (h *GrpcHandler) Complete(ctx context.Context, req *pb.TaskIdRequest) (*pb.Empty, error) {
+	return h.empty(h.service.Complete(ctx, req.TaskId, usernameFromContext(ctx)))
+}
+
+func (h *GrpcHandler) SetStatus(ctx context.Context, req *pb.SetStatusRequest) (*pb.Empty, error) {
+	return h.empty(h.service.SetStatus(ctx, req.TaskId, usernameFromContext(ctx), req.Status))
+}
+
+func (h *GrpcHandler) Watch(ctx context.Context, req *pb.TaskIdRequest) (*pb.Empty, error) {
+	return h.empty(h.service.Watch(ctx, req.TaskId, usernameFromContext(ctx)))
+}
+
+func (h *GrpcHandler) Unwatch(ctx context.Context, req *pb.TaskIdRequest) (*pb.Empty, error) {
+	return h.empty(h.service.Unwatch(ctx, req.TaskId, usernameFromContext(ctx)))
+}
+
+func (h *GrpcHandler) empty(err error) (*pb.Empty, error) {
+	if err != nil {
+		return nil, h.toStatus(err)
+	}
+	return &pb.Empty{}, nil
+}
@@ -0,0 +1,81 @@
+package grpcHandler
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+	"github.com/RusGadzhiev/TaskManager/internal/transport/grpc/pb"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// сервис с одной задачей: владелец alice, исполнитель bob.
+// Правило участника проверяет сам сервис, как service.TasksService
+type fakeTasksService struct {
+	Service
+	status string
+}
+
+func (f *fakeTasksService) checkParticipant(username string) error {
+	if !slices.Contains([]string{"alice", "bob"}, username) {
+		return service.ErrNotParticipant
+	}
+	return nil
+}
+
+func (f *fakeTasksService) Complete(ctx context.Context, taskId uint64, username string) error {
+	if err := f.checkParticipant(username); err != nil {
+		return err
+	}
+	f.status = service.StatusDone
+	return nil
+}
+
+func (f *fakeTasksService) SetStatus(ctx context.Context, taskId uint64, username, status string) error {
+	if err := f.checkParticipant(username); err != nil {
+		return err
+	}
+	f.status = status
+	return nil
+}
+
+func TestTaskChangesRequireParticipant(t *testing.T) {
+	calls := map[string]func(h *GrpcHandler, ctx context.Context) error{
+		"Complete": func(h *GrpcHandler, ctx context.Context) error {
+			_, err := h.Complete(ctx, &pb.TaskIdRequest{TaskId: 1})
+			return err
+		},
+		"SetStatus": func(h *GrpcHandler, ctx context.Context) error {
+			_, err := h.SetStatus(ctx, &pb.SetStatusRequest{TaskId: 1, Status: service.StatusInProgress})
+			return err
+		},
+	}
+	tests := []struct {
+		username string
+		wantCode codes.Code
+	}{
+		{"alice", codes.OK},
+		{"bob", codes.OK},
+		{"carol", codes.PermissionDenied},
+	}
+	for name, call := range calls {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.username, func(t *testing.T) {
+				s := &fakeTasksService{status: service.StatusTodo}
+				h := NewGrpcHandler(s, zap.NewNop().Sugar())
+				ctx := context.WithValue(context.Background(), ctxKey{}, tt.username)
+
+				err := call(h, ctx)
+				if got := status.Code(err); got != tt.wantCode {
+					t.Fatalf("got code %s, want %s", got, tt.wantCode)
+				}
+				if changed := s.status != service.StatusTodo; changed != (tt.wantCode == codes.OK) {
+					t.Errorf("task status %s", s.status)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package grpcHandler
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+	"github.com/RusGadzhiev/TaskManager/internal/transport/grpc/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (h *GrpcHandler) Register(ctx context.Context, req *pb.RegisterRequest) (*pb.Empty, error) {
+	return h.empty(h.service.AddUser(ctx, &service.User{
+		UserName: req.Username,
+		Password: req.Password,
+		Email:    req.Email,
+	}))
+}
+
+// выдает токен сессии, который передается в метаданных authorization.
+// Сессии клиентов gRPC всегда долгие, как с "запомнить меня"
+func (h *GrpcHandler) Login(ctx context.Context, req *pb.LoginRequest) (*pb.LoginResponse, error) {
+	ip := peerIP(ctx)
+	err := h.service.CheckLogin(ctx, req.Username, ip)
+	var locked *service.LockedError
+	if errors.As(err, &locked) {
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	} else if err != nil {
+		return nil, h.toStatus(err)
+	}
+
+	// несуществующий логин, неверный пароль и неверный код неразличимы для клиента
+	user := &service.User{
+		UserName: req.Username,
+		Password: req.Password,
+	}
+	err = h.service.Authentificate(ctx, user)
+	if err == service.ErrNoUser || err == service.ErrIncorrectPassword {
+		h.service.LoginFailed(ctx, req.Username, ip)
+		return nil, status.Error(codes.Unauthenticated, service.ErrInvalidCredentials.Error())
+	} else if err != nil {
+		return nil, h.toStatus(err)
+	}
+
+	twoFactor, err := h.service.TwoFactorEnabled(ctx, user.UserName)
+	if err != nil {
+		return nil, h.toStatus(err)
+	}
+	if twoFactor {
+		if req.Otp == "" {
+			return nil, status.Error(codes.Unauthenticated, "two-factor code required")
+		}
+		err := h.service.VerifyTwoFactor(ctx, user.UserName, req.Otp)
+		if err == service.ErrBadOTP {
+			h.service.LoginFailed(ctx, req.Username, ip)
+			return nil, status.Error(codes.Unauthenticated, service.ErrInvalidCredentials.Error())
+		} else if err != nil {
+			return nil, h.toStatus(err)
+		}
+	}
+	h.service.LoginSucceeded(ctx, user.UserName)
+
+	session, err := h.service.AddCookie(ctx, user.UserName, service.ClientInfo{
+		IP:        ip,
+		UserAgent: userAgent(ctx),
+	}, true)
+	if err != nil {
+		return nil, h.toStatus(err)
+	}
+	return toLoginResponse(session), nil
+}
+
+// выдает новую пару токенов по refresh токену, старый refresh токен перестает действовать
+func (h *GrpcHandler) Refresh(ctx context.Context, req *pb.RefreshRequest) (*pb.LoginResponse, error) {
+	session, err := h.service.RefreshCookie(ctx, req.RefreshToken)
+	if err == service.ErrNoUserBySession {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	} else if err != nil {
+		return nil, h.toStatus(err)
+	}
+	return toLoginResponse(session), nil
+}
+
+func toLoginResponse(session *service.Session) *pb.LoginResponse {
+	now := time.Now()
+	resp := &pb.LoginResponse{
+		Token:     session.CookieVal,
+		ExpiresAt: timestamppb.New(now.Add(session.Dur)),
+	}
+	if session.RefreshVal != "" {
+		resp.RefreshToken = session.RefreshVal
+		resp.RefreshExpiresAt = timestamppb.New(now.Add(session.RefreshDur))
+	}
+	return resp
+}
+
+// адрес клиента без порта
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+func userAgent(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("user-agent"); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (h *GrpcHandler) Logout(ctx context.Context, req *pb.Empty) (*pb.Empty, error) {
+	token, err := tokenFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if service.IsAPIToken(token) {
+		return nil, status.Error(codes.FailedPrecondition, "api tokens are revoked with /tokens/revoke")
+	}
+	return h.empty(h.service.DeleteCookie(ctx, token))
+}
@@ -0,0 +1,50 @@
+package grpcServer
+
+import (
+	"context"
+	"net"
+
+	"github.com/RusGadzhiev/TaskManager/internal/config"
+	"github.com/RusGadzhiev/TaskManager/internal/transport/grpc/grpcHandler"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+type GrpcServer struct {
+	server *grpc.Server
+	addr   string
+}
+
+func NewGrpcServer(ctx context.Context, h *grpcHandler.GrpcHandler, cfg *config.GRPCServer) *GrpcServer {
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(h.LoggingInterceptor, h.AuthInterceptor),
+		grpc.ConnectionTimeout(cfg.Timeout),
+	)
+	h.RegisterServices(server)
+
+	return &GrpcServer{
+		server: server,
+		addr:   ":" + cfg.Port,
+	}
+}
+
+func (srv *GrpcServer) Run(ctx context.Context, logger *zap.SugaredLogger) error {
+	lis, err := net.Listen("tcp", srv.addr)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		if err := srv.server.Serve(lis); err != nil {
+			logger.Fatalf("gRPC server error: %v", err)
+		}
+	}()
+
+	logger.Info("Start gRPC listen at " + srv.addr)
+	<-ctx.Done()
+
+	logger.Info("shutting down gRPC server gracefully")
+	srv.server.GracefulStop()
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package httpHandler
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+	"github.com/gorilla/mux"
+)
+
+const (
+	usersQuery    = "q"
+	usersPage     = "page"
+	usersPageSize = "per_page"
+)
+
+type AdminUsersService interface {
+	// page считается с 1, pageSize 0 - размер по умолчанию
+	ListUsers(ctx context.Context, query string, page, pageSize int) (*service.UsersPage, error)
+	// возвращает ошибку service.ErrNoUser если юзера нет
+	DisableUser(ctx context.Context, username string) error
+	EnableUser(ctx context.Context, username string) error
+	DeleteUser(ctx context.Context, username string) error
+	RevokeUserTokens(ctx context.Context, username string) error
+}
+
+// список пользователей с поиском: ?q=&page=&per_page=
+func (h *HttpHandler) Users(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	page, _ := strconv.Atoi(r.FormValue(usersPage))
+	pageSize, _ := strconv.Atoi(r.FormValue(usersPageSize))
+	users, err := h.service.ListUsers(ctx, r.FormValue(usersQuery), page, pageSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.logger.Error(err.Error())
+		return
+	}
+	renderJSON(w, users, h.logger)
+}
+
+func (h *HttpHandler) DisableUser(w http.ResponseWriter, r *http.Request) {
+	h.manageUser(w, r, service.FilterDisableUser)
+}
+
+func (h *HttpHandler) EnableUser(w http.ResponseWriter, r *http.Request) {
+	h.manageUser(w, r, service.FilterEnableUser)
+}
+
+func (h *HttpHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	h.manageUser(w, r, service.FilterDeleteUser)
+}
+
+// при отключении и удалении пользователя его сессии и токены API отзываются
+func (h *HttpHandler) manageUser(w http.ResponseWriter, r *http.Request, filter string) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	admin := mux.Vars(r)[service.UserName]
+	target := r.FormValue(service.UserName)
+	if target == admin && filter != service.FilterEnableUser {
+		http.Error(w, "administrators cannot disable or delete themselves", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	switch filter {
+	case service.FilterDisableUser:
+		err = h.service.DisableUser(ctx, target)
+	case service.FilterEnableUser:
+		err = h.service.EnableUser(ctx, target)
+	case service.FilterDeleteUser:
+		err = h.service.DeleteUser(ctx, target)
+	}
+	if err == service.ErrNoUser {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.logger.Error(err.Error())
+		return
+	}
+
+	if filter != service.FilterEnableUser {
+		if err := h.service.RevokeAllSessions(ctx, target); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			h.logger.Error(err.Error())
+			return
+		}
+		if err := h.service.RevokeUserTokens(ctx, target); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			h.logger.Error(err.Error())
+			return
+		}
+	}
+	h.logger.Info(filter, " ", target, " by ", admin)
+}
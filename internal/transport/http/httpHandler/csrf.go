@@ -0,0 +1,88 @@
+package httpHandler
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+	"github.com/gorilla/mux"
+)
+
+// значение куки сессии, по которой авторизован запрос; после обновления в режиме jwt - новое
+type sessionCookieCtxKey struct{}
+
+// данные шаблона: токен CSRF для форм и данные самой страницы
+type page struct {
+	CSRFToken string
+	Data      interface{}
+}
+
+// для небезопасных методов сверяет токен из поля формы csrf_token или заголовка X-CSRF-Token с токеном сессии.
+// Запросы по токенам API и без куки сессии не проверяются: у них нет полномочий браузера,
+// которыми мог бы воспользоваться чужой сайт
+func (h *HttpHandler) CSRFMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookieVal := sessionCookie(r)
+		if safeMethod(r.Method) || apiTokenFrom(r.Context()) != nil || cookieVal == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		expected, err := h.service.CSRFToken(r.Context(), cookieVal)
+		if err == service.ErrNoUserBySession {
+			h.logger.Info(err.Error())
+			http.Error(w, service.ErrBadCSRFToken.Error()+", log in again", http.StatusForbidden)
+			return
+		} else if err != nil {
+			h.logger.Error(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// токен из строки запроса не принимается, он может попасть в логи и Referer
+		token := r.Header.Get(service.CSRFHeader)
+		if token == "" {
+			token = r.PostFormValue(service.CSRFToken)
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+			h.logger.Info(service.ErrBadCSRFToken.Error(), " user: ", mux.Vars(r)[service.UserName], " url: ", r.URL.Path)
+			http.Error(w, service.ErrBadCSRFToken.Error(), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// токен CSRF для клиентов без HTML форм, например taskctl
+func (h *HttpHandler) CSRF(w http.ResponseWriter, r *http.Request) {
+	renderJSON(w, map[string]string{service.CSRFToken: h.csrfToken(r)}, h.logger)
+}
+
+// токен CSRF текущей сессии, пустой для запросов без сессии
+func (h *HttpHandler) csrfToken(r *http.Request) string {
+	cookieVal := sessionCookie(r)
+	if cookieVal == "" || apiTokenFrom(r.Context()) != nil {
+		return ""
+	}
+	token, err := h.service.CSRFToken(r.Context(), cookieVal)
+	if err != nil && err != service.ErrNoUserBySession {
+		h.logger.Error(err.Error())
+	}
+	return token
+}
+
+// кука сессии, проверенная AuthMiddleware, а для маршрутов без нее - из запроса
+func sessionCookie(r *http.Request) string {
+	if cookieVal, ok := r.Context().Value(sessionCookieCtxKey{}).(string); ok {
+		return cookieVal
+	}
+	cookie, err := r.Cookie(service.CookieName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
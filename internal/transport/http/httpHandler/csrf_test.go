@@ -0,0 +1,79 @@
+package httpHandler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+	"go.uber.org/zap"
+)
+
+const testCSRFToken = "csrf-of-session"
+
+// знает одну сессию "session", остальные методы не нужны
+type fakeCSRFService struct {
+	Service
+}
+
+func (s *fakeCSRFService) CSRFToken(ctx context.Context, cookieVal string) (string, error) {
+	if cookieVal != "session" {
+		return "", service.ErrNoUserBySession
+	}
+	return testCSRFToken, nil
+}
+
+func TestCSRFMiddleware(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		cookie string
+		header string
+		form   string
+		query  string
+		token  *service.APIToken
+		want   int
+	}{
+		{"safe method", http.MethodGet, "session", "", "", "", nil, http.StatusOK},
+		{"without session", http.MethodPost, "", "", "", "", nil, http.StatusOK},
+		{"api token", http.MethodPost, "session", "", "", "", &service.APIToken{}, http.StatusOK},
+		{"token in header", http.MethodPost, "session", testCSRFToken, "", "", nil, http.StatusOK},
+		{"token in form", http.MethodPost, "session", "", testCSRFToken, "", nil, http.StatusOK},
+		{"no token", http.MethodPost, "session", "", "", "", nil, http.StatusForbidden},
+		{"wrong token", http.MethodPost, "session", "forged", "", "", nil, http.StatusForbidden},
+		{"token of another session", http.MethodDelete, "session", testCSRFToken + "x", "", "", nil, http.StatusForbidden},
+		{"token in query", http.MethodPost, "session", "", "", testCSRFToken, nil, http.StatusForbidden},
+		{"unknown session", http.MethodPost, "expired", testCSRFToken, "", "", nil, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHttpHandler(&fakeCSRFService{}, nil, nil, nil, zap.NewNop().Sugar(), nil)
+			handler := h.CSRFMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			target := "/tasks/new"
+			if tt.query != "" {
+				target += "?" + url.Values{service.CSRFToken: {tt.query}}.Encode()
+			}
+			req := httptest.NewRequest(tt.method, target, strings.NewReader(url.Values{service.CSRFToken: {tt.form}}.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: service.CookieName, Value: tt.cookie})
+			}
+			if tt.header != "" {
+				req.Header.Set(service.CSRFHeader, tt.header)
+			}
+			if tt.token != nil {
+				req = req.WithContext(context.WithValue(req.Context(), apiTokenCtxKey{}, tt.token))
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package httpHandler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+	"github.com/gorilla/mux"
+)
+
+// период отправки комментария, не дающего прокси закрыть простаивающее соединение
+const sseKeepAlive = 30 * time.Second
+
+// событие, после которого клиент должен заново загрузить задачи:
+// пропущенные им события уже вытеснены из буфера
+const sseResetEvent = "reset"
+
+type EventsSubscriber interface {
+	// возвращает пропущенные события с id больше lastEventID, признак того, что их уже не восстановить,
+	// id последнего события, канал новых событий и функцию отписки
+	Subscribe(lastEventID uint64) ([]*service.TaskEvent, bool, uint64, <-chan *service.TaskEvent, func())
+}
+
+// Events отдает поток событий задач в формате Server-Sent Events,
+// пользователь получает только события задач, которые ему видны
+func (h *HttpHandler) Events(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)[service.UserName]
+
+	// у SSE соединения нет фиксированного времени жизни
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		h.logger.Error(err.Error())
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	var lastEventID uint64
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		parsed, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			http.Error(w, "bad Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		lastEventID = parsed
+	}
+
+	missed, reset, lastID, ch, unsubscribe := h.events.Subscribe(lastEventID)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	if reset {
+		// пустой id сбрасывает Last-Event-ID клиента, если событий еще не было
+		id := ""
+		if lastID != 0 {
+			id = strconv.FormatUint(lastID, 10)
+		}
+		if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: {}\n\n", id, sseResetEvent); err != nil {
+			return
+		}
+	}
+	for _, event := range missed {
+		if err := h.writeEvent(w, username, event); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(sseKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-ch:
+			if !ok {
+				h.logger.Info("SSE subscriber dropped: ", username)
+				return
+			}
+			if err := h.writeEvent(w, username, event); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (h *HttpHandler) writeEvent(w http.ResponseWriter, username string, event *service.TaskEvent) error {
+	if !event.VisibleTo(username) {
+		return nil
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		h.logger.Error(err.Error())
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
@@ -0,0 +1,444 @@
+package httpHandler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+	"github.com/gorilla/mux"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+type graphqlCtxKey int
+
+const (
+	viewerKey graphqlCtxKey = iota
+	usersLoaderKey
+)
+
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// GraphQL выполняет запрос к схеме задач и пользователей от имени авторизованного пользователя.
+// Принимает POST с JSON телом или GET с параметром query, мутации - только POST:
+// GET не проверяется на CSRF. Токену для запросов нужен scope read, для мутаций - write
+func (h *HttpHandler) GraphQL(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	var req graphqlRequest
+	if r.Method == http.MethodGet {
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if isMutation(req.Query, req.OperationName) {
+		if r.Method == http.MethodGet {
+			http.Error(w, "mutations require POST", http.StatusMethodNotAllowed)
+			return
+		}
+		if token := apiTokenFrom(ctx); token != nil && !token.HasScope(service.ScopeWrite) {
+			http.Error(w, "token has no "+service.ScopeWrite+" scope", http.StatusForbidden)
+			return
+		}
+	}
+
+	ctx = context.WithValue(ctx, viewerKey, mux.Vars(r)[service.UserName])
+	ctx = context.WithValue(ctx, usersLoaderKey, newUsersLoader(ctx, h.service))
+
+	result := graphql.Do(graphql.Params{
+		Schema:         h.schema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        ctx,
+	})
+	renderJSON(w, result, h.logger)
+}
+
+// является ли мутацией операция, которую выполнит graphql.Do. Без operationName
+// учитываются все операции документа. Ошибки разбора вернет сам graphql.Do
+func isMutation(query, operationName string) bool {
+	doc, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		return false
+	}
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok || op.Operation != ast.OperationTypeMutation {
+			continue
+		}
+		if operationName == "" || (op.Name != nil && op.Name.Value == operationName) {
+			return true
+		}
+	}
+	return false
+}
+
+// usersLoader собирает логины, запрошенные на одном уровне запроса,
+// и загружает их одним обращением к хранилищу
+type usersLoader struct {
+	mu      sync.Mutex
+	ctx     context.Context
+	service UsersService
+	pending map[string]struct{}
+	loaded  map[string]*service.User
+}
+
+func newUsersLoader(ctx context.Context, s UsersService) *usersLoader {
+	return &usersLoader{
+		ctx:     ctx,
+		service: s,
+		pending: make(map[string]struct{}),
+		loaded:  make(map[string]*service.User),
+	}
+}
+
+// откладывает загрузку пользователей до вызова возвращенной функции
+func (l *usersLoader) load(usernames ...string) func() ([]*service.User, error) {
+	l.mu.Lock()
+	for _, name := range usernames {
+		if _, ok := l.loaded[name]; !ok {
+			l.pending[name] = struct{}{}
+		}
+	}
+	l.mu.Unlock()
+
+	return func() ([]*service.User, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if len(l.pending) > 0 {
+			names := make([]string, 0, len(l.pending))
+			for name := range l.pending {
+				names = append(names, name)
+			}
+			users, err := l.service.GetUsers(l.ctx, names)
+			if err != nil {
+				return nil, err
+			}
+			for _, user := range users {
+				l.loaded[user.UserName] = user
+			}
+			// удаленные пользователи остаются в задачах только логином
+			for _, name := range names {
+				if _, ok := l.loaded[name]; !ok {
+					l.loaded[name] = &service.User{UserName: name}
+				}
+			}
+			l.pending = make(map[string]struct{})
+		}
+
+		res := make([]*service.User, 0, len(usernames))
+		for _, name := range usernames {
+			res = append(res, l.loaded[name])
+		}
+		return res, nil
+	}
+}
+
+func loaderFrom(ctx context.Context) *usersLoader {
+	return ctx.Value(usersLoaderKey).(*usersLoader)
+}
+
+func viewerFrom(ctx context.Context) string {
+	viewer, _ := ctx.Value(viewerKey).(string)
+	return viewer
+}
+
+// резолвер поля-списка пользователей по логинам из задачи
+func resolveUsers(names func(*service.Task) []string) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		thunk := loaderFrom(p.Context).load(names(p.Source.(*service.Task))...)
+		return func() (interface{}, error) {
+			return thunk()
+		}, nil
+	}
+}
+
+func newGraphQLSchema(h *HttpHandler) graphql.Schema {
+	userType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "User",
+		Fields: graphql.Fields{
+			"username": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.String),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*service.User).UserName, nil
+				},
+			},
+			"displayName": &graphql.Field{
+				Type: graphql.String,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					user := p.Source.(*service.User)
+					if user.DisplayName == "" {
+						return nil, nil
+					}
+					return user.DisplayName, nil
+				},
+			},
+			// почта видна только самому пользователю
+			"email": &graphql.Field{
+				Type: graphql.String,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					user := p.Source.(*service.User)
+					if user.UserName != viewerFrom(p.Context) || user.Email == "" {
+						return nil, nil
+					}
+					return user.Email, nil
+				},
+			},
+		},
+	})
+
+	taskType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Task",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.ID),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*service.Task).ID, nil
+				},
+			},
+			"owner": &graphql.Field{
+				Type: graphql.NewNonNull(userType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					thunk := loaderFrom(p.Context).load(p.Source.(*service.Task).Owner)
+					return func() (interface{}, error) {
+						users, err := thunk()
+						if err != nil {
+							return nil, err
+						}
+						return users[0], nil
+					}, nil
+				},
+			},
+			"executors": &graphql.Field{
+				Type:    graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(userType))),
+				Resolve: resolveUsers(func(t *service.Task) []string { return t.Executors }),
+			},
+			"teams": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String))),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*service.Task).Teams, nil
+				},
+			},
+			"watchers": &graphql.Field{
+				Type:    graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(userType))),
+				Resolve: resolveUsers(func(t *service.Task) []string { return t.Watchers }),
+			},
+			"description": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.String),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*service.Task).Description, nil
+				},
+			},
+			"status": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.String),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*service.Task).Status, nil
+				},
+			},
+			"dueAt": &graphql.Field{
+				Type: graphql.DateTime,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if due := p.Source.(*service.Task).DueAt; due != nil {
+						return *due, nil
+					}
+					return nil, nil
+				},
+			},
+			"completed": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*service.Task).Completed, nil
+				},
+			},
+			"assigned": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*service.Task).Assigned, nil
+				},
+			},
+		},
+	})
+
+	filterType := graphql.NewEnum(graphql.EnumConfig{
+		Name: "TaskFilter",
+		Values: graphql.EnumValueConfigMap{
+			"ALL":     &graphql.EnumValueConfig{Value: service.FilterAllTasks},
+			"MY":      &graphql.EnumValueConfig{Value: service.FilterMyTasks},
+			"CREATED": &graphql.EnumValueConfig{Value: service.FilterCreatedTasks},
+		},
+	})
+
+	taskIdArgs := graphql.FieldConfigArgument{
+		"taskId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+	}
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"tasks": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(taskType))),
+				Args: graphql.FieldConfigArgument{
+					"filter": &graphql.ArgumentConfig{Type: filterType, DefaultValue: service.FilterAllTasks},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					viewer := viewerFrom(p.Context)
+					switch p.Args["filter"] {
+					case service.FilterMyTasks:
+						return h.service.GetMyTasks(p.Context, viewer)
+					case service.FilterCreatedTasks:
+						return h.service.GetCreatedTasks(p.Context, viewer)
+					}
+					return h.service.GetAllTasks(p.Context)
+				},
+			},
+			"task": &graphql.Field{
+				Type: taskType,
+				Args: taskIdArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := taskIdArg(p)
+					if err != nil {
+						return nil, err
+					}
+					task, err := h.service.GetTask(p.Context, id)
+					if err == service.ErrNoTask {
+						return nil, nil
+					}
+					return task, err
+				},
+			},
+			"me": &graphql.Field{
+				Type: graphql.NewNonNull(userType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					thunk := loaderFrom(p.Context).load(viewerFrom(p.Context))
+					return func() (interface{}, error) {
+						users, err := thunk()
+						if err != nil {
+							return nil, err
+						}
+						return users[0], nil
+					}, nil
+				},
+			},
+		},
+	})
+
+	// мутации возвращают задачу в актуальном состоянии
+	taskAfter := func(p graphql.ResolveParams, err error) (interface{}, error) {
+		if err != nil {
+			return nil, err
+		}
+		id, _ := taskIdArg(p)
+		return h.service.GetTask(p.Context, id)
+	}
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createTask": &graphql.Field{
+				Type: graphql.NewNonNull(taskType),
+				Args: graphql.FieldConfigArgument{
+					"description": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"executor":    &graphql.ArgumentConfig{Type: graphql.String},
+					"dueAt":       &graphql.ArgumentConfig{Type: graphql.DateTime},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					executors := []string{}
+					if executor, _ := p.Args["executor"].(string); executor != "" {
+						if err := h.service.ValidateUser(p.Context, executor); err != nil {
+							return nil, err
+						}
+						executors = append(executors, executor)
+					}
+					var dueAt *time.Time
+					if due, ok := p.Args["dueAt"].(time.Time); ok {
+						dueAt = &due
+					}
+
+					id, err := h.service.Add(p.Context, &service.Task{
+						Owner:       viewerFrom(p.Context),
+						Executors:   executors,
+						Watchers:    []string{},
+						Description: p.Args["description"].(string),
+						Status:      service.StatusTodo,
+						DueAt:       dueAt,
+						Assigned:    len(executors) > 0,
+					})
+					if err != nil {
+						return nil, err
+					}
+					return h.service.GetTask(p.Context, id)
+				},
+			},
+			"assign": &graphql.Field{
+				Type: graphql.NewNonNull(taskType),
+				Args: graphql.FieldConfigArgument{
+					"taskId":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"executor": &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := taskIdArg(p)
+					if err != nil {
+						return nil, err
+					}
+					executor, _ := p.Args["executor"].(string)
+					return taskAfter(p, h.assignTask(p.Context, id, viewerFrom(p.Context), executor))
+				},
+			},
+			"unassign": &graphql.Field{
+				Type: graphql.NewNonNull(taskType),
+				Args: graphql.FieldConfigArgument{
+					"taskId":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"executor": &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := taskIdArg(p)
+					if err != nil {
+						return nil, err
+					}
+					executor, _ := p.Args["executor"].(string)
+					return taskAfter(p, h.unassignTask(p.Context, id, viewerFrom(p.Context), executor))
+				},
+			},
+			"complete": &graphql.Field{
+				Type: graphql.NewNonNull(taskType),
+				Args: taskIdArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := taskIdArg(p)
+					if err != nil {
+						return nil, err
+					}
+					return taskAfter(p, h.service.Complete(p.Context, id, viewerFrom(p.Context)))
+				},
+			},
+		},
+	})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query:    query,
+		Mutation: mutation,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return schema
+}
+
+func taskIdArg(p graphql.ResolveParams) (uint64, error) {
+	id, _ := p.Args["taskId"].(string)
+	return strconv.ParseUint(id, 10, 64)
+}
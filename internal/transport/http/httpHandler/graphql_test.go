@@ -0,0 +1,101 @@
+package httpHandler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+func TestIsMutation(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         string
+		operationName string
+		want          bool
+	}{
+		{"shorthand query", `{ myTasks { id } }`, "", false},
+		{"named query", `query List { myTasks { id } }`, "", false},
+		{"mutation", `mutation { complete(taskId: 1) { id } }`, "", true},
+		{"query selected from mixed document", `query List { myTasks { id } } mutation Done { complete(taskId: 1) { id } }`, "List", false},
+		{"mutation selected from mixed document", `query List { myTasks { id } } mutation Done { complete(taskId: 1) { id } }`, "Done", true},
+		{"mixed document without name", `query List { myTasks { id } } mutation Done { complete(taskId: 1) { id } }`, "", true},
+		{"parse error", `mutation {`, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isMutation(tt.query, tt.operationName); got != tt.want {
+				t.Errorf("isMutation() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// одна задача: владелец alice, исполнитель bob. Правило участника проверяет сервис
+type fakeGraphQLService struct {
+	Service
+	task *service.Task
+}
+
+func (s *fakeGraphQLService) GetTask(ctx context.Context, taskId uint64) (*service.Task, error) {
+	if taskId != s.task.ID {
+		return nil, service.ErrNoTask
+	}
+	return s.task, nil
+}
+
+func (s *fakeGraphQLService) Complete(ctx context.Context, taskId uint64, username string) error {
+	if username != s.task.Owner && !slices.Contains(s.task.Executors, username) {
+		return service.ErrNotParticipant
+	}
+	s.task.Status = service.StatusDone
+	return nil
+}
+
+func TestGraphQLCompleteRequiresParticipant(t *testing.T) {
+	tests := []struct {
+		viewer  string
+		wantErr string
+	}{
+		{"bob", ""},
+		{"carol", service.ErrNotParticipant.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.viewer, func(t *testing.T) {
+			s := &fakeGraphQLService{task: &service.Task{ID: 1, Owner: "alice", Executors: []string{"bob"}, Status: service.StatusTodo}}
+			h := NewHttpHandler(s, nil, nil, nil, zap.NewNop().Sugar(), nil)
+
+			body := `{"query": "mutation { complete(taskId: 1) { id status } }"}`
+			req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(body))
+			req = mux.SetURLVars(req, map[string]string{service.UserName: tt.viewer})
+			rec := httptest.NewRecorder()
+			h.GraphQL(rec, req)
+
+			var res struct {
+				Errors []struct {
+					Message string `json:"message"`
+				} `json:"errors"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+				t.Fatal(err)
+			}
+			gotErr := ""
+			if len(res.Errors) > 0 {
+				gotErr = res.Errors[0].Message
+			}
+			if gotErr != tt.wantErr {
+				t.Fatalf("got error %q, want %q", gotErr, tt.wantErr)
+			}
+			if done := s.task.Status == service.StatusDone; done != (tt.wantErr == "") {
+				t.Errorf("task status %s", s.task.Status)
+			}
+		})
+	}
+}
@@ -3,62 +3,129 @@ package httpHandler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"html/template"
 	"net/http"
+	"net/netip"
 	"strconv"
 	"time"
 
 	"github.com/RusGadzhiev/TaskManager/internal/service"
 	"github.com/gorilla/mux"
+	"github.com/graphql-go/graphql"
 	"go.uber.org/zap"
 )
 
 const (
-	templateCreate       = "create.html"
-	templateAssign       = "assign.html"
-	templateUnassign     = "unassign.html"
-	templateRegistration = "registration.html"
-	templateLogout       = "logout.html"
-	templateComplete     = "complete.html"
-	templateLogin        = "login.html"
+	templateCreate        = "create.html"
+	templateAssign        = "assign.html"
+	templateUnassign      = "unassign.html"
+	templateRegistration  = "registration.html"
+	templateLogout        = "logout.html"
+	templateComplete      = "complete.html"
+	templateLogin         = "login.html"
+	templateWatch         = "watch.html"
+	templateUnwatch       = "unwatch.html"
+	templateNotifications = "notifications.html"
+	// формат поля datetime-local
+	dueAtLayout = "2006-01-02T15:04"
 )
 
 type TasksService interface {
 	GetAllTasks(ctx context.Context) ([]*service.Task, error)
 	GetCreatedTasks(ctx context.Context, username string) ([]*service.Task, error)
 	GetMyTasks(ctx context.Context, username string) ([]*service.Task, error)
+	// возвращает ошибку service.ErrNoTask если задачи нет
+	GetTask(ctx context.Context, taskId uint64) (*service.Task, error)
+	// возвращает ошибку service.ErrNotOwner если username не владелец задачи, service.ErrNoTask если задачи нет
+	CheckOwner(ctx context.Context, taskId uint64, username string) error
 	// возвращает id вставленной задачи
 	Add(ctx context.Context, task *service.Task) (uint64, error)
+	// добавляет исполнителя, не затирая уже назначенных
 	Assign(ctx context.Context, taskId uint64, username string) error
-	Unassign(ctx context.Context, taskId uint64) error
-	Complete(ctx context.Context, taskId uint64) error
+	Unassign(ctx context.Context, taskId uint64, username string) error
+	// возвращает ошибку service.ErrNoTeam если команды нет
+	AssignTeam(ctx context.Context, taskId uint64, team string) error
+	UnassignTeam(ctx context.Context, taskId uint64, team string) error
+	// возвращает ошибку service.ErrNotTeamMember если пользователь не в команде задачи,
+	// service.ErrNoTeamTask если команду с задачи уже сняли
+	ClaimTask(ctx context.Context, taskId uint64, username string) error
+	// возвращает ошибку service.ErrNotParticipant если username не владелец и не исполнитель задачи
+	Complete(ctx context.Context, taskId uint64, username string) error
+	// возвращает ошибку service.ErrBadStatus для неизвестного статуса, service.ErrNotParticipant
+	// если username не владелец и не исполнитель задачи
+	SetStatus(ctx context.Context, taskId uint64, username, status string) error
+	Watch(ctx context.Context, taskId uint64, username string) error
+	Unwatch(ctx context.Context, taskId uint64, username string) error
 }
 
 type UsersService interface {
-	// возвращает ошибку service.ErrNoUser если юзера нет, ошбику service.ErrIncorrectPassword если пароль неверный
+	// возвращает ошибку service.ErrNoUser если юзера нет, ошбику service.ErrIncorrectPassword если пароль неверный,
+	// service.ErrUserDisabled если пользователь отключен
 	Authentificate(ctx context.Context, user *service.User) error
-	// возвращает ошибку service.ErrUserExist если юзер уже есть
+	// возвращает ошибку service.ErrUserExist если юзер уже есть, *service.ValidationError если данные не подходят
 	AddUser(ctx context.Context, user *service.User) error
+	// возвращает ошибку *service.UnknownUserError с похожими логинами если юзера нет
+	ValidateUser(ctx context.Context, username string) error
+	// возвращает найденных пользователей, отсутствующие пропускаются
+	GetUsers(ctx context.Context, usernames []string) ([]*service.User, error)
+	// возвращает ошибку service.ErrNoUser если юзера нет
+	SetNotifications(ctx context.Context, username string, settings *service.NotificationSettings) error
+	// возвращает ошибку service.ErrNoUser если юзера нет
+	GetUser(ctx context.Context, username string) (*service.User, error)
 }
 
 type SessionsService interface {
 	DeleteCookie(ctx context.Context, cookieVal string) error
 	// возвращает значение созданной куки и продолжительность действия
-	AddCookie(ctx context.Context, username string) (*service.Session, error)
+	// remember выбирает долгий срок жизни сессии и постоянные куки
+	AddCookie(ctx context.Context, username string, client service.ClientInfo, remember bool) (*service.Session, error)
+	// продлевает сессию при активности, возвращает nil если продлевать пока не нужно
+	TouchCookie(ctx context.Context, cookieVal string) (*service.Session, error)
 	// возвращает юзернейм по значению куки
 	GetUserByCookie(ctx context.Context, cookieVal string) (string, error)
+	// выдает новую сессию по refresh токену, возвращает service.ErrNoUserBySession если обновить нельзя
+	RefreshCookie(ctx context.Context, refreshVal string) (*service.Session, error)
+	// завершает сессию по refresh токену
+	RevokeRefresh(ctx context.Context, refreshVal string) error
+	// возвращает токен CSRF сессии, service.ErrNoUserBySession если сессии нет
+	CSRFToken(ctx context.Context, cookieVal string) (string, error)
+}
+
+type LoginGuardService interface {
+	// возвращает *service.LockedError если вход для логина или адреса временно заблокирован
+	CheckLogin(ctx context.Context, username, ip string) error
+	// учитывает неудачную попытку входа, возвращается после прогрессивной задержки
+	LoginFailed(ctx context.Context, username, ip string)
+	LoginSucceeded(ctx context.Context, username string)
 }
 
 type Service interface {
 	UsersService
 	TasksService
 	SessionsService
+	WebhooksService
+	TokensService
+	ExternalUsersService
+	TwoFactorService
+	LoginGuardService
+	SessionsManagementService
+	ProfileService
+	AdminUsersService
+	TeamsService
+	RateLimitService
 }
 
 type HttpHandler struct {
 	service Service
-	tmpl    *template.Template
-	logger  *zap.SugaredLogger
+	events  EventsSubscriber
+	// nil если вход через OIDC не настроен
+	sso SSOProvider
+	// адреса прокси, которым доверяется X-Forwarded-For
+	trustedProxies []netip.Prefix
+	schema         graphql.Schema
+	tmpl           *template.Template
+	logger         *zap.SugaredLogger
 }
 
 func (h *HttpHandler) New(w http.ResponseWriter, r *http.Request) {
@@ -66,23 +133,52 @@ func (h *HttpHandler) New(w http.ResponseWriter, r *http.Request) {
 	defer cancel()
 
 	if r.Method == http.MethodGet {
-		h.execTmpl(w, templateCreate)
+		h.execTmpl(w, r, templateCreate)
 		return
 	}
 
 	vars := mux.Vars(r)
-	executor := r.FormValue(service.Executor)
-	assign := false
-	if executor != "" {
-		assign = true
+	executors := []string{}
+	if executor := r.FormValue(service.Executor); executor != "" {
+		if !h.validateExecutor(ctx, w, executor) {
+			return
+		}
+		executors = append(executors, executor)
+	}
+	teams := []string{}
+	if team := r.FormValue(service.TeamName); team != "" {
+		_, err := h.service.GetTeam(ctx, team)
+		if err == service.ErrNoTeam {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			h.logger.Error(err.Error())
+			return
+		}
+		teams = append(teams, team)
+	}
+
+	var dueAt *time.Time
+	if due := r.FormValue(service.DueAt); due != "" {
+		t, err := time.ParseInLocation(dueAtLayout, due, time.Local)
+		if err != nil {
+			http.Error(w, "bad due date", http.StatusBadRequest)
+			return
+		}
+		dueAt = &t
 	}
 
 	task := &service.Task{
 		Owner:       vars[service.UserName],
-		Executor:    executor,
+		Executors:   executors,
+		Teams:       teams,
+		Watchers:    []string{},
 		Description: r.FormValue(service.Description),
+		Status:      service.StatusTodo,
+		DueAt:       dueAt,
 		Completed:   false,
-		Assigned:    assign,
+		Assigned:    len(executors) > 0 || len(teams) > 0,
 	}
 	taskId, err := h.service.Add(ctx, task)
 	if err != nil {
@@ -109,39 +205,129 @@ func (h *HttpHandler) CreatedList(w http.ResponseWriter, r *http.Request) {
 func (h *HttpHandler) Assign(w http.ResponseWriter, r *http.Request) {
 
 	if r.Method == http.MethodGet {
-		h.execTmpl(w, templateAssign)
+		h.execTmpl(w, r, templateAssign)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10 * time.Second)
+	defer cancel()
+
+	taskId, err := strconv.Atoi(r.FormValue(service.TaskId))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.logger.Error(err.Error())
+		return
+	}
+
+	// задача назначается либо на пользователя, либо на команду
+	if team := r.FormValue(service.TeamName); team != "" {
+		err = h.assignTeam(ctx, uint64(taskId), mux.Vars(r)[service.UserName], team)
+	} else {
+		err = h.assignTask(ctx, uint64(taskId), mux.Vars(r)[service.UserName], r.FormValue(service.Executor))
+	}
+	var unknown *service.UnknownUserError
+	if errors.As(err, &unknown) {
+		h.renderUnknownUser(w, unknown)
+		return
+	} else if err == service.ErrNoTeam {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	} else if err == service.ErrNotOwner {
+		h.logger.Info(err.Error())
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	} else if err == service.ErrNoTask {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.logger.Error(err.Error())
 		return
 	}
+}
+
+// назначает исполнителя задачи от имени username.
+// Без указания исполнителя задача назначается на самого пользователя,
+// назначать других может только владелец задачи
+func (h *HttpHandler) assignTask(ctx context.Context, taskId uint64, username, executor string) error {
+	if executor == "" {
+		executor = username
+	} else if executor != username {
+		if err := h.service.CheckOwner(ctx, taskId, username); err != nil {
+			return err
+		}
+	}
+
+	if err := h.service.ValidateUser(ctx, executor); err != nil {
+		return err
+	}
+
+	return h.service.Assign(ctx, taskId, executor)
+}
 
-	h.updateSth(w, r, service.FilterAssign)
+// снимает исполнителя задачи от имени username. Без указания исполнителя пользователь снимает себя,
+// снимать других может только владелец задачи
+func (h *HttpHandler) unassignTask(ctx context.Context, taskId uint64, username, executor string) error {
+	if executor == "" {
+		executor = username
+	} else if executor != username {
+		if err := h.service.CheckOwner(ctx, taskId, username); err != nil {
+			return err
+		}
+	}
+	return h.service.Unassign(ctx, taskId, executor)
 }
 
 func (h *HttpHandler) Unassign(w http.ResponseWriter, r *http.Request) {
 
 	if r.Method == http.MethodGet {
-		h.execTmpl(w, templateUnassign)
+		h.execTmpl(w, r, templateUnassign)
 		return
 	}
 
+	if team := r.FormValue(service.TeamName); team != "" {
+		h.unassignTeam(w, r, team)
+		return
+	}
 	h.updateSth(w, r, service.FilterUnassign)
 }
 
 func (h *HttpHandler) Complete(w http.ResponseWriter, r *http.Request) {
 
 	if r.Method == http.MethodGet {
-		h.execTmpl(w, templateComplete)
+		h.execTmpl(w, r, templateComplete)
 		return
 	}
 
 	h.updateSth(w, r, service.FilterComplete)
 }
 
+func (h *HttpHandler) Watch(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method == http.MethodGet {
+		h.execTmpl(w, r, templateWatch)
+		return
+	}
+
+	h.updateSth(w, r, service.FilterWatch)
+}
+
+func (h *HttpHandler) Unwatch(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method == http.MethodGet {
+		h.execTmpl(w, r, templateUnwatch)
+		return
+	}
+
+	h.updateSth(w, r, service.FilterUnwatch)
+}
+
 func (h *HttpHandler) Login(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 20 * time.Second)
 	defer cancel()
 
 	if r.Method == http.MethodGet {
-		h.execTmpl(w, templateLogin)
+		h.execTmplData(w, r, templateLogin, map[string]bool{"SSO": h.sso != nil})
 		return
 	}
 
@@ -149,11 +335,23 @@ func (h *HttpHandler) Login(w http.ResponseWriter, r *http.Request) {
 		UserName: r.FormValue(service.UserName),
 		Password: r.FormValue(service.Password),
 	}
+	remember := r.FormValue(service.Remember) != ""
+
+	ip := clientIP(r)
+	if !h.checkLogin(ctx, w, newUser.UserName, ip) {
+		return
+	}
 
+	// несуществующий логин и неверный пароль неразличимы для клиента
 	err := h.service.Authentificate(ctx, &newUser)
 	if err == service.ErrNoUser || err == service.ErrIncorrectPassword {
+		h.logger.Info(err.Error(), " user: ", newUser.UserName, " ip: ", ip)
+		h.service.LoginFailed(ctx, newUser.UserName, ip)
+		http.Error(w, service.ErrInvalidCredentials.Error(), http.StatusUnauthorized)
+		return
+	} else if err == service.ErrUserDisabled {
 		h.logger.Info(err.Error(), " user: ", newUser.UserName)
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		http.Error(w, err.Error(), http.StatusForbidden)
 		return
 	} else if err != nil {
 		h.logger.Error(err.Error())
@@ -161,18 +359,25 @@ func (h *HttpHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	session, err := h.service.AddCookie(ctx, newUser.UserName)
+	twoFactor, err := h.service.TwoFactorEnabled(ctx, newUser.UserName)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		h.logger.Error(err.Error())
 		return
 	}
-	cookie := http.Cookie{
-		Name:    service.CookieName,
-		Value:   session.CookieVal,
-		Expires: time.Now().Add(session.Dur),
+	if twoFactor {
+		h.startTwoFactor(ctx, w, r, newUser.UserName, remember)
+		return
 	}
-	http.SetCookie(w, &cookie)
+	h.service.LoginSucceeded(ctx, newUser.UserName)
+
+	session, err := h.service.AddCookie(ctx, newUser.UserName, clientInfo(r), remember)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.logger.Error(err.Error())
+		return
+	}
+	setSessionCookies(w, session)
 	http.Redirect(w, r, "/", http.StatusFound)
 }
 
@@ -181,26 +386,33 @@ func (h *HttpHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	defer cancel()
 
 	if r.Method == http.MethodGet {
-		h.execTmpl(w, templateLogout)
+		h.execTmpl(w, r, templateLogout)
 		return
 	}
 
+	// кука access токена истекает раньше сессии, тогда сессия завершается по refresh токену
 	cookie, err := r.Cookie(service.CookieName)
-	if err != nil {
-		h.logger.Error(err.Error())
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	if err == nil {
+		err = h.service.DeleteCookie(ctx, cookie.Value)
+	} else if refresh, refreshErr := r.Cookie(service.RefreshCookieName); refreshErr == nil {
+		err = h.service.RevokeRefresh(ctx, refresh.Value)
 	}
-
-	err = h.service.DeleteCookie(ctx, cookie.Value)
 	if err != nil {
 		h.logger.Error(err.Error())
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	cookie.Expires = time.Now().AddDate(0, 0, -1)
-	http.SetCookie(w, cookie)
+	http.SetCookie(w, &http.Cookie{
+		Name:    service.CookieName,
+		Expires: time.Now().AddDate(0, 0, -1),
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     service.RefreshCookieName,
+		Path:     "/",
+		Expires:  time.Now().AddDate(0, 0, -1),
+		HttpOnly: true,
+	})
 	http.Redirect(w, r, "/login", http.StatusUnauthorized)
 }
 
@@ -209,17 +421,22 @@ func (h *HttpHandler) Registration(w http.ResponseWriter, r *http.Request) {
 	defer cancel()
 
 	if r.Method == http.MethodGet {
-		h.execTmpl(w, templateRegistration)
+		h.execTmpl(w, r, templateRegistration)
 		return
 	}
 
 	user := service.User{
 		UserName: r.FormValue(service.UserName),
 		Password: r.FormValue(service.Password),
+		Email:    r.FormValue(service.Email),
 	}
 
 	err := h.service.AddUser(ctx, &user)
-	if err == service.ErrUserExist {
+	var invalid *service.ValidationError
+	if errors.As(err, &invalid) {
+		h.renderValidationError(w, invalid)
+		return
+	} else if err == service.ErrUserExist {
 		h.logger.Info(service.ErrUserExist.Error(), ": ", user.UserName)
 		http.Error(w, service.ErrUserExist.Error(), http.StatusUnauthorized)
 		return
@@ -232,6 +449,90 @@ func (h *HttpHandler) Registration(w http.ResponseWriter, r *http.Request) {
 	renderJSON(w, "Registration success", h.logger)
 }
 
+func (h *HttpHandler) Notifications(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10 * time.Second)
+	defer cancel()
+
+	if r.Method == http.MethodGet {
+		h.execTmpl(w, r, templateNotifications)
+		return
+	}
+
+	// неотмеченные чекбоксы в форму не попадают
+	settings := &service.NotificationSettings{
+		Assigned:  r.FormValue(service.NotifyAssigned) != "",
+		Completed: r.FormValue(service.NotifyCompleted) != "",
+		DueSoon:   r.FormValue(service.NotifyDueSoon) != "",
+	}
+	err := h.service.SetNotifications(ctx, mux.Vars(r)[service.UserName], settings)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.logger.Error(err.Error())
+		return
+	}
+	renderJSON(w, settings, h.logger)
+}
+
+// проверяет блокировку входа, при блокировке отвечает 429 с Retry-After и возвращает false
+func (h *HttpHandler) checkLogin(ctx context.Context, w http.ResponseWriter, username, ip string) bool {
+	err := h.service.CheckLogin(ctx, username, ip)
+	var locked *service.LockedError
+	if errors.As(err, &locked) {
+		h.logger.Info(err.Error(), " user: ", username, " ip: ", ip)
+		w.Header().Set("Retry-After", strconv.Itoa(int(locked.RetryAfter.Seconds())+1))
+		http.Error(w, service.ErrTooManyAttempts.Error(), http.StatusTooManyRequests)
+		return false
+	} else if err != nil {
+		h.logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// адрес клиента без порта. X-Forwarded-For учитывается только от доверенных прокси,
+// см. ClientIPMiddleware; без нее берется адрес соединения
+func clientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPCtxKey{}).(string); ok {
+		return ip
+	}
+	return remoteIP(r)
+}
+
+func clientInfo(r *http.Request) service.ClientInfo {
+	return service.ClientInfo{
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+	}
+}
+
+// ставит куку сессии и, в режиме jwt, куку refresh токена.
+// Кука access токена живет столько же, сколько сам токен, выйти после этого можно по refresh токену.
+// Без "запомнить меня" куки живут до закрытия браузера
+func setSessionCookies(w http.ResponseWriter, session *service.Session) {
+	var expires, refreshExpires time.Time
+	if session.Remember {
+		expires = time.Now().Add(session.Dur)
+		refreshExpires = time.Now().Add(session.RefreshDur)
+	}
+	cookie := http.Cookie{
+		Name:    service.CookieName,
+		Value:   session.CookieVal,
+		Expires: expires,
+	}
+	http.SetCookie(w, &cookie)
+
+	if session.RefreshVal != "" {
+		http.SetCookie(w, &http.Cookie{
+			Name:     service.RefreshCookieName,
+			Value:    session.RefreshVal,
+			Path:     "/",
+			Expires:  refreshExpires,
+			HttpOnly: true,
+		})
+	}
+}
+
 // renderJSON преобразует 'v' в формат JSON и записывает результат, в виде ответа, в w.
 func renderJSON(w http.ResponseWriter, v interface{}, logger *zap.SugaredLogger) {
 	json, err := json.Marshal(v)
@@ -243,6 +544,43 @@ func renderJSON(w http.ResponseWriter, v interface{}, logger *zap.SugaredLogger)
 	w.Write(json)
 }
 
+// проверяет существование исполнителя, при ошибке пишет ответ в w и возвращает false
+func (h *HttpHandler) validateExecutor(ctx context.Context, w http.ResponseWriter, executor string) bool {
+	err := h.service.ValidateUser(ctx, executor)
+	var unknown *service.UnknownUserError
+	if errors.As(err, &unknown) {
+		h.renderUnknownUser(w, unknown)
+		return false
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.logger.Error(err.Error())
+		return false
+	}
+	return true
+}
+
+// отвечает 422 с ошибками по полям формы
+func (h *HttpHandler) renderValidationError(w http.ResponseWriter, invalid *service.ValidationError) {
+	h.logger.Info(invalid.Error())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	renderJSON(w, map[string]interface{}{
+		"error":  service.ErrValidation.Error(),
+		"fields": invalid.Fields,
+	}, h.logger)
+}
+
+// отвечает 422 со списком похожих логинов
+func (h *HttpHandler) renderUnknownUser(w http.ResponseWriter, unknown *service.UnknownUserError) {
+	h.logger.Info(unknown.Error())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	renderJSON(w, map[string]interface{}{
+		"error":       unknown.Error(),
+		"suggestions": unknown.Suggestions,
+	}, h.logger)
+}
+
 func (h *HttpHandler) listSth(w http.ResponseWriter, r *http.Request, filter string) {
 	ctx, cancel := context.WithTimeout(r.Context(), 10 * time.Second)
 	defer cancel()
@@ -281,15 +619,23 @@ func (h *HttpHandler) updateSth(w http.ResponseWriter, r *http.Request, filter s
 	}
 	vars := mux.Vars(r)
 	switch filter {
-	case service.FilterAssign:
-		err = h.service.Assign(ctx, uint64(taskId), vars[service.UserName])
 	case service.FilterUnassign:
-		err = h.service.Unassign(ctx, uint64(taskId))
+		err = h.unassignTask(ctx, uint64(taskId), vars[service.UserName], r.FormValue(service.Executor))
 	case service.FilterComplete:
-		err = h.service.Complete(ctx, uint64(taskId))
+		err = h.service.Complete(ctx, uint64(taskId), vars[service.UserName])
+	case service.FilterWatch:
+		err = h.service.Watch(ctx, uint64(taskId), vars[service.UserName])
+	case service.FilterUnwatch:
+		err = h.service.Unwatch(ctx, uint64(taskId), vars[service.UserName])
 	}
 
-	if err != nil {
+	if err == service.ErrNoTask {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err == service.ErrNotOwner || err == service.ErrNotParticipant {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	} else if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		h.logger.Error(err.Error())
 		return
@@ -297,8 +643,13 @@ func (h *HttpHandler) updateSth(w http.ResponseWriter, r *http.Request, filter s
 }
 
 // выпонлняет шаблон с именем tmpl, ответ в w записывает
-func (h *HttpHandler) execTmpl(w http.ResponseWriter, tmpl string) {
-	err := h.tmpl.ExecuteTemplate(w, tmpl, nil)
+func (h *HttpHandler) execTmpl(w http.ResponseWriter, r *http.Request, tmpl string) {
+	h.execTmplData(w, r, tmpl, nil)
+}
+
+// шаблон получает page: данные доступны как .Data, токен CSRF текущей сессии - как .CSRFToken
+func (h *HttpHandler) execTmplData(w http.ResponseWriter, r *http.Request, tmpl string, data interface{}) {
+	err := h.tmpl.ExecuteTemplate(w, tmpl, &page{CSRFToken: h.csrfToken(r), Data: data})
 	if err != nil {
 		h.logger.Error(err.Error())
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -308,17 +659,70 @@ func (h *HttpHandler) execTmpl(w http.ResponseWriter, tmpl string) {
 func (h *HttpHandler) Router() *mux.Router {
 	r := mux.NewRouter()
 	r.StrictSlash(true)
-	r.HandleFunc("/", h.List).Methods("GET")
-	r.HandleFunc("/login", h.Login).Methods("POST", "GET")
-	r.HandleFunc("/logout", h.Logout).Methods("POST", "GET")
-	r.HandleFunc("/registration", h.Registration).Methods("POST", "GET")
+	r.Handle("/", h.RateLimitMiddleware(service.LimitTasks, http.HandlerFunc(h.List))).Methods("GET")
+	r.Handle("/login", h.RateLimitPostMiddleware(service.LimitAuth, http.HandlerFunc(h.Login))).Methods("POST", "GET")
+	r.Handle("/login/2fa", h.RateLimitPostMiddleware(service.LimitAuth, http.HandlerFunc(h.LoginTwoFactor))).Methods("POST", "GET")
+	r.Handle("/login/oidc", h.RateLimitMiddleware(service.LimitAuth, http.HandlerFunc(h.LoginOIDC))).Methods("GET")
+	r.Handle("/login/oidc/callback", h.RateLimitMiddleware(service.LimitAuth, http.HandlerFunc(h.OIDCCallback))).Methods("GET")
+	r.Handle("/logout", h.CSRFMiddleware(http.HandlerFunc(h.Logout))).Methods("POST", "GET")
+	r.Handle("/registration", h.RateLimitPostMiddleware(service.LimitAuth, http.HandlerFunc(h.Registration))).Methods("POST", "GET")
+	r.Handle("/password/forgot", h.RateLimitPostMiddleware(service.LimitAuth, http.HandlerFunc(h.ForgotPassword))).Methods("POST", "GET")
+	r.Handle("/password/reset", h.RateLimitPostMiddleware(service.LimitAuth, http.HandlerFunc(h.ResetPassword))).Methods("POST", "GET")
+	r.Handle("/csrf", h.AuthMiddleware(http.HandlerFunc(h.CSRF))).Methods("GET")
 	r.Handle("/tasks", h.AuthMiddleware(http.HandlerFunc(h.MyList))).Methods("GET")
 	r.Handle("/tasks/created", h.AuthMiddleware(http.HandlerFunc(h.CreatedList))).Methods("GET")
 	r.Handle("/tasks/new", h.AuthMiddleware(http.HandlerFunc(h.New))).Methods("POST", "GET")
 	r.Handle("/tasks/assign", h.AuthMiddleware(http.HandlerFunc(h.Assign))).Methods("POST", "GET")
 	r.Handle("/tasks/unassign", h.AuthMiddleware(http.HandlerFunc(h.Unassign))).Methods("POST", "GET")
+	r.Handle("/tasks/claim", h.AuthMiddleware(http.HandlerFunc(h.Claim))).Methods("POST", "GET")
 	r.Handle("/tasks/complete", h.AuthMiddleware(http.HandlerFunc(h.Complete))).Methods("POST", "GET")
+	r.Handle("/tasks/watch", h.AuthMiddleware(http.HandlerFunc(h.Watch))).Methods("POST", "GET")
+	r.Handle("/tasks/unwatch", h.AuthMiddleware(http.HandlerFunc(h.Unwatch))).Methods("POST", "GET")
+	r.Handle("/teams", h.AuthMiddleware(http.HandlerFunc(h.Teams))).Methods("GET")
+	r.Handle("/teams/new", h.AuthMiddleware(http.HandlerFunc(h.NewTeam))).Methods("POST", "GET")
+	r.Handle("/teams/members/add", h.AuthMiddleware(http.HandlerFunc(h.AddTeamMember))).Methods("POST")
+	r.Handle("/teams/members/remove", h.AuthMiddleware(http.HandlerFunc(h.RemoveTeamMember))).Methods("POST")
+	r.Handle("/events", h.AuthMiddleware(http.HandlerFunc(h.Events))).Methods("GET")
+	r.Handle("/ws/board", h.AuthMiddleware(http.HandlerFunc(h.Board))).Methods("GET")
+	r.Handle("/graphql", h.ReadAuthMiddleware(http.HandlerFunc(h.GraphQL))).Methods("POST", "GET")
+	r.Handle("/profile", h.AuthMiddleware(http.HandlerFunc(h.Profile))).Methods("POST", "GET")
+	r.Handle("/profile/password", h.AuthMiddleware(h.RequireScope(service.ScopeAdmin, http.HandlerFunc(h.ChangePassword)))).Methods("POST", "GET")
+	r.Handle("/profile/notifications", h.AuthMiddleware(http.HandlerFunc(h.Notifications))).Methods("POST", "GET")
+	r.Handle("/profile/2fa", h.AuthMiddleware(http.HandlerFunc(h.TwoFactor))).Methods("GET")
+	r.Handle("/profile/2fa/enroll", h.AuthMiddleware(h.RequireScope(service.ScopeAdmin, http.HandlerFunc(h.EnrollTwoFactor)))).Methods("POST")
+	r.Handle("/profile/2fa/confirm", h.AuthMiddleware(h.RequireScope(service.ScopeAdmin, http.HandlerFunc(h.ConfirmTwoFactor)))).Methods("POST")
+	r.Handle("/profile/2fa/disable", h.AuthMiddleware(h.RequireScope(service.ScopeAdmin, http.HandlerFunc(h.DisableTwoFactor)))).Methods("POST")
+	r.Handle("/admin/users", h.AuthMiddleware(h.RequireScope(service.ScopeAdmin, h.RequireRole(service.RoleAdmin, http.HandlerFunc(h.Users))))).Methods("GET")
+	r.Handle("/admin/users/disable", h.AuthMiddleware(h.RequireScope(service.ScopeAdmin, h.RequireRole(service.RoleAdmin, http.HandlerFunc(h.DisableUser))))).Methods("POST")
+	r.Handle("/admin/users/enable", h.AuthMiddleware(h.RequireScope(service.ScopeAdmin, h.RequireRole(service.RoleAdmin, http.HandlerFunc(h.EnableUser))))).Methods("POST")
+	r.Handle("/admin/users/delete", h.AuthMiddleware(h.RequireScope(service.ScopeAdmin, h.RequireRole(service.RoleAdmin, http.HandlerFunc(h.DeleteUser))))).Methods("POST")
+	r.Handle("/admin/users/2fa/reset", h.AuthMiddleware(h.RequireScope(service.ScopeAdmin, h.RequireRole(service.RoleAdmin, http.HandlerFunc(h.ResetTwoFactor))))).Methods("POST")
+	r.Handle("/sessions", h.AuthMiddleware(h.RequireScope(service.ScopeAdmin, http.HandlerFunc(h.Sessions)))).Methods("GET")
+	r.Handle("/sessions/revoke", h.AuthMiddleware(h.RequireScope(service.ScopeAdmin, http.HandlerFunc(h.RevokeSession)))).Methods("POST")
+	r.Handle("/sessions/revoke-others", h.AuthMiddleware(h.RequireScope(service.ScopeAdmin, http.HandlerFunc(h.RevokeOtherSessions)))).Methods("POST")
+	r.Handle("/tokens", h.AuthMiddleware(h.RequireScope(service.ScopeAdmin, http.HandlerFunc(h.Tokens)))).Methods("GET")
+	r.Handle("/tokens/new", h.AuthMiddleware(h.RequireScope(service.ScopeAdmin, http.HandlerFunc(h.NewToken)))).Methods("POST", "GET")
+	r.Handle("/tokens/revoke", h.AuthMiddleware(h.RequireScope(service.ScopeAdmin, http.HandlerFunc(h.RevokeToken)))).Methods("POST")
+	r.Handle("/webhooks", h.AuthMiddleware(http.HandlerFunc(h.Webhooks))).Methods("GET")
+	r.Handle("/webhooks/new", h.AuthMiddleware(http.HandlerFunc(h.NewWebhook))).Methods("POST", "GET")
+	r.Handle("/webhooks/delete", h.AuthMiddleware(http.HandlerFunc(h.DeleteWebhook))).Methods("POST")
+	r.Handle("/webhooks/{webhookId:[0-9]+}/deliveries", h.AuthMiddleware(http.HandlerFunc(h.WebhookDeliveries))).Methods("GET")
+
+	// middleware из r.Use не применяются к запросам без маршрута, поэтому 404 и 405 оборачиваются отдельно
+	r.NotFoundHandler = h.unmatched(http.NotFoundHandler())
+	r.MethodNotAllowedHandler = h.unmatched(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
 
+	r.Use(func(hdl http.Handler) http.Handler {
+		return h.ClientIPMiddleware(hdl)
+	})
+	r.Use(func(hdl http.Handler) http.Handler {
+		return h.MetricsMiddleware(hdl)
+	})
+	r.Use(func(hdl http.Handler) http.Handler {
+		return h.TracingMiddleware(hdl)
+	})
 	r.Use(func(hdl http.Handler) http.Handler {
 		return h.PanicRecoverMiddleware(hdl)
 	})
@@ -328,10 +732,15 @@ func (h *HttpHandler) Router() *mux.Router {
 	return r
 }
 
-func NewHttpHandler(s Service, logger *zap.SugaredLogger, tmpl *template.Template) *HttpHandler {
-	return &HttpHandler{
-		service: s,
-		logger:  logger,
-		tmpl:    tmpl,
+func NewHttpHandler(s Service, events EventsSubscriber, sso SSOProvider, trustedProxies []netip.Prefix, logger *zap.SugaredLogger, tmpl *template.Template) *HttpHandler {
+	h := &HttpHandler{
+		service:        s,
+		events:         events,
+		sso:            sso,
+		trustedProxies: trustedProxies,
+		logger:         logger,
+		tmpl:           tmpl,
 	}
+	h.schema = newGraphQLSchema(h)
+	return h
 }
@@ -0,0 +1,81 @@
+package httpHandler
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/metrics"
+	"github.com/gorilla/mux"
+)
+
+// учитывает запрос в метриках по шаблону маршрута, должен стоять снаружи PanicRecoverMiddleware,
+// чтобы видеть ответ 500 после паники
+func (h *HttpHandler) MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+
+		metrics.ObserveRequest(routeTemplate(r), r.Method, sw.status, start)
+	})
+}
+
+// метка запросов, для которых не нашлось маршрута: путь в метку не попадает, иначе их число не ограничено
+const unmatchedRoute = "unmatched"
+
+// шаблон маршрута, а не путь, чтобы спаны и метрики одного обработчика группировались вместе
+func routeTemplate(r *http.Request) string {
+	if cur := mux.CurrentRoute(r); cur != nil {
+		if tmpl, err := cur.GetPathTemplate(); err == nil {
+			return tmpl
+		}
+	}
+	return unmatchedRoute
+}
+
+// те же middleware, что у маршрутов в Router, для ответов 404 и 405
+func (h *HttpHandler) unmatched(next http.Handler) http.Handler {
+	return h.ClientIPMiddleware(h.MetricsMiddleware(h.TracingMiddleware(h.LoggingMiddleware(next))))
+}
+
+// запоминает код ответа. Flush и Hijack нужны потокам событий и websocket
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	// после перехвата соединения, например для websocket, ответом считается 101
+	w.status = http.StatusSwitchingProtocols
+	return hj.Hijack()
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
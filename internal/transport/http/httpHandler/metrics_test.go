@@ -0,0 +1,43 @@
+package httpHandler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/RusGadzhiev/TaskManager/internal/metrics"
+	"go.uber.org/zap"
+)
+
+func TestUnmatchedRequestsAreCounted(t *testing.T) {
+	router := NewHttpHandler(nil, nil, nil, nil, zap.NewNop().Sugar(), nil).Router()
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		want   int
+		series string
+	}{
+		{"unknown path", http.MethodGet, "/no-such-page", http.StatusNotFound, `method="GET",route="unmatched",status="404"`},
+		{"metrics are not served by the api", http.MethodGet, "/metrics", http.StatusNotFound, `method="GET",route="unmatched",status="404"`},
+		{"wrong method", http.MethodDelete, "/login", http.StatusMethodNotAllowed, `method="DELETE",route="unmatched",status="405"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+			if rec.Code != tt.want {
+				t.Fatalf("status %d, want %d", rec.Code, tt.want)
+			}
+
+			scrape := httptest.NewRecorder()
+			metrics.Handler().ServeHTTP(scrape, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+			body, _ := io.ReadAll(scrape.Body)
+			if !strings.Contains(string(body), "taskmanager_http_requests_total{"+tt.series+"}") {
+				t.Errorf("request is not counted as %s", tt.series)
+			}
+		})
+	}
+}
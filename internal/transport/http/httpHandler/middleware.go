@@ -1,31 +1,74 @@
 package httpHandler
 
 import (
+	"context"
 	"net/http"
+	"strings"
 
 	"github.com/RusGadzhiev/TaskManager/internal/service"
 	"github.com/gorilla/mux"
 )
 
+type apiTokenCtxKey struct{}
+
 func (h *HttpHandler) LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		h.logger.Info("New request: ", "method - ", r.Method, " remote_addr - ", r.RemoteAddr, " url - ", r.URL.Path)
+		h.logger.Info("New request: ", "method - ", r.Method, " remote_addr - ", r.RemoteAddr, " url - ", r.URL.Path, " trace_id - ", traceID(r))
 		next.ServeHTTP(w, r)
 	})
 }
 
-// по значению куки устанавливает значение username
+// по значению куки или персональному токену из заголовка Authorization: Bearer устанавливает значение username.
+// Токену для безопасных методов нужен scope read, для остальных - write.
+// Затем запрос проходит RateLimitMiddleware по логину, запросы по куке - еще и CSRFMiddleware
 func (h *HttpHandler) AuthMiddleware(next http.Handler) http.Handler {
+	return h.authenticate(next, methodScope)
+}
+
+// как AuthMiddleware, но токену достаточно scope read при любом методе:
+// для обработчиков, которые сами проверяют write по содержимому запроса
+func (h *HttpHandler) ReadAuthMiddleware(next http.Handler) http.Handler {
+	return h.authenticate(next, func(r *http.Request) string { return service.ScopeRead })
+}
+
+func methodScope(r *http.Request) string {
+	if safeMethod(r.Method) {
+		return service.ScopeRead
+	}
+	return service.ScopeWrite
+}
+
+func (h *HttpHandler) authenticate(next http.Handler, scopeFor func(r *http.Request) string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie(service.CookieName)
-		if err != nil {
-			h.logger.Info("Permission denied")
-			http.Redirect(w, r, "/login", http.StatusUnauthorized)
+		if raw, ok := bearerToken(r); ok {
+			token, err := h.service.AuthenticateToken(r.Context(), raw)
+			if err == service.ErrNoToken || err == service.ErrTokenExpired {
+				h.logger.Info(err.Error())
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			} else if err != nil {
+				h.logger.Error(err.Error())
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			if scope := scopeFor(r); !token.HasScope(scope) {
+				http.Error(w, "token has no "+scope+" scope", http.StatusForbidden)
+				return
+			}
+
+			mux.Vars(r)[service.UserName] = token.UserName
+			ctx := context.WithValue(service.WithActor(r.Context(), token.UserName), apiTokenCtxKey{}, token)
+			h.RateLimitMiddleware(service.LimitTasks, next).ServeHTTP(w, r.WithContext(ctx))
 			return
 		}
 
-		username, err := h.service.GetUserByCookie(r.Context(), cookie.Value)
-		if err == service.ErrNoUserBySession {
+		username, cookieVal, err := h.sessionUser(w, r)
+		if err == http.ErrNoCookie {
+			h.logger.Info("Permission denied")
+			http.Redirect(w, r, "/login", http.StatusUnauthorized)
+			return
+		} else if err == service.ErrNoUserBySession {
 			h.logger.Info(err.Error())
 			http.Redirect(w, r, "/login", http.StatusUnauthorized)
 			return
@@ -37,10 +80,51 @@ func (h *HttpHandler) AuthMiddleware(next http.Handler) http.Handler {
 
 		h.logger.Info("Auth Success")
 		mux.Vars(r)[service.UserName] = username
-		next.ServeHTTP(w, r)
+		ctx := context.WithValue(service.WithActor(r.Context(), username), sessionCookieCtxKey{}, cookieVal)
+		h.RateLimitMiddleware(service.LimitTasks, h.CSRFMiddleware(next)).ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// возвращает пользователя и значение куки его сессии. Если сессия истекла, но есть refresh токен,
+// выдает новую сессию, ставит ее куки в w и возвращает новое значение
+func (h *HttpHandler) sessionUser(w http.ResponseWriter, r *http.Request) (string, string, error) {
+	var username string
+	cookie, err := r.Cookie(service.CookieName)
+	if err == nil {
+		username, err = h.service.GetUserByCookie(r.Context(), cookie.Value)
+	}
+	if err == nil {
+		return username, cookie.Value, h.touchSession(w, r, cookie.Value)
+	}
+	if err != http.ErrNoCookie && err != service.ErrNoUserBySession {
+		return username, "", err
+	}
+
+	refresh, refreshErr := r.Cookie(service.RefreshCookieName)
+	if refreshErr != nil {
+		return "", "", err
+	}
+	session, refreshErr := h.service.RefreshCookie(r.Context(), refresh.Value)
+	if refreshErr != nil {
+		return "", "", err
+	}
+	setSessionCookies(w, session)
+	username, err = h.service.GetUserByCookie(r.Context(), session.CookieVal)
+	return username, session.CookieVal, err
+}
+
+// сдвигает срок жизни сессии при активности, постоянную куку продлевает вместе с ней
+func (h *HttpHandler) touchSession(w http.ResponseWriter, r *http.Request, cookieVal string) error {
+	session, err := h.service.TouchCookie(r.Context(), cookieVal)
+	if err != nil {
+		return err
+	}
+	if session != nil && session.Remember {
+		setSessionCookies(w, session)
+	}
+	return nil
+}
+
 func (h *HttpHandler) PanicRecoverMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
@@ -52,3 +136,42 @@ func (h *HttpHandler) PanicRecoverMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// пропускает запросы по сессии и по токенам со scope, должен стоять после AuthMiddleware
+func (h *HttpHandler) RequireScope(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := apiTokenFrom(r.Context()); token != nil && !token.HasScope(scope) {
+			http.Error(w, "token has no "+scope+" scope", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// пропускает только пользователей с ролью role, должен стоять после AuthMiddleware
+func (h *HttpHandler) RequireRole(role string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := h.service.GetUser(r.Context(), mux.Vars(r)[service.UserName])
+		if err != nil && err != service.ErrNoUser {
+			h.logger.Error(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err == service.ErrNoUser || !user.HasRole(role) {
+			http.Error(w, "role "+role+" required", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// токен, которым авторизован запрос, nil для сессии по cookie
+func apiTokenFrom(ctx context.Context) *service.APIToken {
+	token, _ := ctx.Value(apiTokenCtxKey{}).(*service.APIToken)
+	return token
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return strings.TrimSpace(token), ok
+}
@@ -0,0 +1,139 @@
+package httpHandler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+)
+
+const (
+	oidcCookieName = "oidc_state"
+	oidcCookiePath = "/login/oidc"
+	// сколько пользователь может провести на странице провайдера
+	oidcFlowTTL = 10 * time.Minute
+)
+
+type SSOProvider interface {
+	// ссылка на страницу входа провайдера с code_challenge по codeVerifier
+	AuthCodeURL(state, nonce, codeVerifier string) string
+	// меняет код на токены и возвращает подтвержденного провайдером пользователя
+	Exchange(ctx context.Context, code, codeVerifier, nonce string) (*service.ExternalIdentity, error)
+}
+
+type ExternalUsersService interface {
+	// возвращает ошибку service.ErrUserExist если логин занят локальным пользователем
+	LoginExternal(ctx context.Context, identity *service.ExternalIdentity) (*service.User, error)
+}
+
+// перенаправляет на провайдера, state, nonce и PKCE verifier хранятся в куке до возврата
+func (h *HttpHandler) LoginOIDC(w http.ResponseWriter, r *http.Request) {
+	if h.sso == nil {
+		http.Error(w, "sso is not configured", http.StatusNotFound)
+		return
+	}
+
+	values := make([]string, 3)
+	for i := range values {
+		v, err := randomURLString(32)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			h.logger.Error(err.Error())
+			return
+		}
+		values[i] = v
+	}
+	state, nonce, codeVerifier := values[0], values[1], values[2]
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookieName,
+		Value:    strings.Join(values, "."),
+		Path:     oidcCookiePath,
+		Expires:  time.Now().Add(oidcFlowTTL),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, h.sso.AuthCodeURL(state, nonce, codeVerifier), http.StatusFound)
+}
+
+func (h *HttpHandler) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
+	defer cancel()
+
+	if h.sso == nil {
+		http.Error(w, "sso is not configured", http.StatusNotFound)
+		return
+	}
+
+	cookie, err := r.Cookie(oidcCookieName)
+	if err != nil {
+		http.Error(w, "login flow expired", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookieName,
+		Path:     oidcCookiePath,
+		Expires:  time.Now().AddDate(0, 0, -1),
+		HttpOnly: true,
+	})
+
+	values := strings.Split(cookie.Value, ".")
+	if len(values) != 3 {
+		http.Error(w, "login flow expired", http.StatusBadRequest)
+		return
+	}
+	state, nonce, codeVerifier := values[0], values[1], values[2]
+	if subtle.ConstantTimeCompare([]byte(state), []byte(r.FormValue("state"))) != 1 {
+		http.Error(w, "bad state", http.StatusBadRequest)
+		return
+	}
+	if errParam := r.FormValue("error"); errParam != "" {
+		h.logger.Info("oidc error: ", errParam, " ", r.FormValue("error_description"))
+		http.Error(w, errParam, http.StatusUnauthorized)
+		return
+	}
+
+	identity, err := h.sso.Exchange(ctx, r.FormValue("code"), codeVerifier, nonce)
+	if err != nil {
+		h.logger.Info(err.Error())
+		http.Error(w, "sso login failed", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := h.service.LoginExternal(ctx, identity)
+	if err == service.ErrUserExist {
+		h.logger.Info(err.Error(), ": ", identity.UserName)
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err == service.ErrUserDisabled {
+		h.logger.Info(err.Error(), ": ", identity.UserName)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	} else if err != nil {
+		h.logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	session, err := h.service.AddCookie(ctx, user.UserName, clientInfo(r), false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.logger.Error(err.Error())
+		return
+	}
+	setSessionCookies(w, session)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+func randomURLString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
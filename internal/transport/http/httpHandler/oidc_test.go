@@ -0,0 +1,297 @@
+package httpHandler
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"html/template"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/config"
+	"github.com/RusGadzhiev/TaskManager/internal/oidc"
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+	"go.uber.org/zap"
+)
+
+const (
+	testClientID = "task-manager"
+	testKid      = "test-key"
+)
+
+// mockIssuer - OIDC провайдер с discovery, JWKS и token endpoint.
+// Код выдает сам тест через authorize, как будто пользователь вошел у провайдера
+type mockIssuer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]authRequest
+}
+
+type authRequest struct {
+	nonce     string
+	challenge string
+	claims    map[string]interface{}
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIssuer{key: key, codes: map[string]authRequest{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                m.URL,
+			"authorization_endpoint":                m.URL + "/authorize",
+			"token_endpoint":                        m.URL + "/token",
+			"jwks_uri":                              m.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": testKid,
+				"use": "sig",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", m.token)
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+// принимает ссылку на страницу входа провайдера и возвращает код для callback
+func (m *mockIssuer) authorize(t *testing.T, authURL string, claims map[string]interface{}) (code, state string) {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if !strings.HasPrefix(authURL, m.URL+"/authorize") || q.Get("client_id") != testClientID {
+		t.Fatalf("unexpected authorization url %s", authURL)
+	}
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" || q.Get("nonce") == "" {
+		t.Fatalf("authorization url without PKCE or nonce: %s", authURL)
+	}
+
+	code = "code-" + q.Get("state")
+	m.mu.Lock()
+	m.codes[code] = authRequest{nonce: q.Get("nonce"), challenge: q.Get("code_challenge"), claims: claims}
+	m.mu.Unlock()
+	return code, q.Get("state")
+}
+
+func (m *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	req, ok := m.codes[r.FormValue("code")]
+	delete(m.codes, r.FormValue("code"))
+	m.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != req.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := map[string]interface{}{
+		"iss":   m.URL,
+		"aud":   testClientID,
+		"sub":   "subject-1",
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": req.nonce,
+	}
+	for k, v := range req.claims {
+		claims[k] = v
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   60,
+		"id_token":     m.sign(claims),
+	})
+}
+
+func (m *mockIssuer) sign(claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": testKid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(signed))
+	sig, _ := rsa.SignPKCS1v15(rand.Reader, m.key, crypto.SHA256, sum[:])
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// запоминает пользователя из LoginExternal и выдает ему сессию, остальные методы не нужны
+type fakeSSOService struct {
+	Service
+	identity *service.ExternalIdentity
+}
+
+func (s *fakeSSOService) LoginExternal(ctx context.Context, identity *service.ExternalIdentity) (*service.User, error) {
+	s.identity = identity
+	return &service.User{UserName: identity.UserName, Roles: identity.Roles}, nil
+}
+
+func (s *fakeSSOService) AddCookie(ctx context.Context, username string, client service.ClientInfo, remember bool) (*service.Session, error) {
+	return &service.Session{CookieVal: "session-of-" + username, Dur: time.Hour}, nil
+}
+
+func newTestSSOHandler(t *testing.T, issuer *mockIssuer) (*HttpHandler, *fakeSSOService) {
+	t.Helper()
+	provider, err := oidc.NewProvider(context.Background(), &config.OIDC{
+		Issuer:        issuer.URL,
+		ClientID:      testClientID,
+		ClientSecret:  "secret",
+		RedirectURL:   "http://localhost:8080/login/oidc/callback",
+		Scopes:        []string{"openid", "profile", "email"},
+		UsernameClaim: "preferred_username",
+		GroupsClaim:   "groups",
+		GroupRoles:    map[string]string{"admins": service.RoleAdmin},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSSOService{}
+	return NewHttpHandler(s, nil, provider, nil, zap.NewNop().Sugar(), nil), s
+}
+
+// проходит вход: /login/oidc, провайдер, /login/oidc/callback. tamper может испортить код или state
+func oidcRoundTrip(t *testing.T, h *HttpHandler, issuer *mockIssuer, claims map[string]interface{}, tamper func(q url.Values)) *http.Response {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.LoginOIDC(rec, httptest.NewRequest(http.MethodGet, "/login/oidc", nil))
+	resp := rec.Result()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("login status %d", resp.StatusCode)
+	}
+	var flow *http.Cookie
+	for _, c := range resp.Cookies() {
+		if c.Name == oidcCookieName {
+			flow = c
+		}
+	}
+	if flow == nil || !flow.HttpOnly {
+		t.Fatal("no http-only flow cookie")
+	}
+
+	code, state := issuer.authorize(t, resp.Header.Get("Location"), claims)
+	q := url.Values{"code": {code}, "state": {state}}
+	if tamper != nil {
+		tamper(q)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/login/oidc/callback?"+q.Encode(), nil)
+	req.AddCookie(flow)
+	rec = httptest.NewRecorder()
+	h.OIDCCallback(rec, req)
+	return rec.Result()
+}
+
+func TestOIDCLoginRoundTrip(t *testing.T) {
+	issuer := newMockIssuer(t)
+	h, s := newTestSSOHandler(t, issuer)
+
+	resp := oidcRoundTrip(t, h, issuer, map[string]interface{}{
+		"preferred_username": "alice",
+		"email":              "alice@example.com",
+		"groups":             []string{"admins", "others"},
+	}, nil)
+	if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != "/" {
+		t.Fatalf("callback status %d, location %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	session := ""
+	for _, c := range resp.Cookies() {
+		if c.Name == service.CookieName {
+			session = c.Value
+		}
+	}
+	if session != "session-of-alice" {
+		t.Errorf("session cookie %q", session)
+	}
+	want := &service.ExternalIdentity{Provider: "oidc", Subject: "subject-1", UserName: "alice", Email: "alice@example.com"}
+	got := s.identity
+	if got == nil || got.Provider != want.Provider || got.Subject != want.Subject || got.UserName != want.UserName || got.Email != want.Email {
+		t.Fatalf("identity %+v, want %+v", got, want)
+	}
+	if len(got.Roles) != 2 || got.Roles[0] != service.RoleUser || got.Roles[1] != service.RoleAdmin {
+		t.Errorf("roles %v", got.Roles)
+	}
+}
+
+func TestOIDCCallbackRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		tamper func(q url.Values)
+		want   int
+	}{
+		{"wrong state", map[string]interface{}{"preferred_username": "alice"}, func(q url.Values) { q.Set("state", "forged") }, http.StatusBadRequest},
+		{"unknown code", map[string]interface{}{"preferred_username": "alice"}, func(q url.Values) { q.Set("code", "forged") }, http.StatusUnauthorized},
+		{"provider error", map[string]interface{}{"preferred_username": "alice"}, func(q url.Values) { q.Set("error", "access_denied") }, http.StatusUnauthorized},
+		{"no username claim", map[string]interface{}{}, nil, http.StatusUnauthorized},
+		{"token for another client", map[string]interface{}{"preferred_username": "alice", "aud": "other"}, nil, http.StatusUnauthorized},
+		{"expired token", map[string]interface{}{"preferred_username": "alice", "exp": time.Now().Add(-time.Hour).Unix()}, nil, http.StatusUnauthorized},
+		{"nonce mismatch", map[string]interface{}{"preferred_username": "alice", "nonce": "replayed"}, nil, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer := newMockIssuer(t)
+			h, s := newTestSSOHandler(t, issuer)
+
+			resp := oidcRoundTrip(t, h, issuer, tt.claims, tt.tamper)
+			if resp.StatusCode != tt.want {
+				t.Errorf("status %d, want %d", resp.StatusCode, tt.want)
+			}
+			if s.identity != nil {
+				t.Errorf("user %s logged in", s.identity.UserName)
+			}
+		})
+	}
+}
+
+func TestLoginPageSSOButton(t *testing.T) {
+	tmpl := template.Must(template.ParseFiles("../../../../templates/login.html"))
+	tests := []struct {
+		name string
+		sso  SSOProvider
+		want bool
+	}{
+		{"sso configured", &oidc.Provider{}, true},
+		{"sso not configured", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHttpHandler(&fakeSSOService{}, nil, tt.sso, nil, zap.NewNop().Sugar(), tmpl)
+			rec := httptest.NewRecorder()
+			h.Login(rec, httptest.NewRequest(http.MethodGet, "/login", nil))
+			if got := strings.Contains(rec.Body.String(), "/login/oidc"); got != tt.want {
+				t.Errorf("page has SSO link: %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package httpHandler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+	"github.com/gorilla/mux"
+)
+
+const (
+	templateProfile        = "profile.html"
+	templateChangePassword = "password.html"
+	templateForgotPassword = "forgot.html"
+	templateResetPassword  = "reset.html"
+)
+
+type ProfileService interface {
+	// возвращает ошибку service.ErrNoUser если юзера нет
+	GetProfile(ctx context.Context, username string) (*service.Profile, error)
+	// возвращает ошибку service.ErrBadEmail если адрес указан неверно, service.ErrIncorrectPassword если
+	// почта меняется без верного пароля, service.ErrExternalUser если почту задает внешний провайдер
+	UpdateProfile(ctx context.Context, username, displayName, email, password string) (*service.Profile, error)
+	// возвращает ошибку service.ErrIncorrectPassword если старый пароль неверный, *service.ValidationError если новый не подходит,
+	// service.ErrExternalUser для пользователей внешнего провайдера
+	ChangePassword(ctx context.Context, username, oldPassword, newPassword string) error
+	// отправляет ссылку для сброса, для неизвестного логина ошибки нет
+	RequestPasswordReset(ctx context.Context, username string) error
+	// возвращает имя пользователя; ошибку service.ErrBadResetToken если ссылка недействительна,
+	// *service.ValidationError если пароль не подходит
+	ResetPassword(ctx context.Context, token, newPassword string) (string, error)
+}
+
+// GET отдает страницу профиля, POST меняет отображаемое имя и почту, для смены почты нужен пароль;
+// оба ответа POST - профиль в JSON
+func (h *HttpHandler) Profile(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	username := mux.Vars(r)[service.UserName]
+	if r.Method == http.MethodGet {
+		profile, err := h.service.GetProfile(ctx, username)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			h.logger.Error(err.Error())
+			return
+		}
+		if r.Header.Get("Accept") == "application/json" {
+			renderJSON(w, profile, h.logger)
+			return
+		}
+		h.execTmplData(w, r, templateProfile, profile)
+		return
+	}
+
+	profile, err := h.service.UpdateProfile(ctx, username, r.FormValue(service.DisplayName), r.FormValue(service.Email), r.FormValue(service.Password))
+	if err == service.ErrBadEmail {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	} else if err == service.ErrIncorrectPassword {
+		h.logger.Info("email change with incorrect password, user: ", username)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	} else if err == service.ErrExternalUser {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.logger.Error(err.Error())
+		return
+	}
+	renderJSON(w, profile, h.logger)
+}
+
+// после смены пароля остальные сессии пользователя завершаются, текущая остается
+func (h *HttpHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if r.Method == http.MethodGet {
+		h.execTmpl(w, r, templateChangePassword)
+		return
+	}
+
+	username := mux.Vars(r)[service.UserName]
+	err := h.service.ChangePassword(ctx, username, r.FormValue(service.Password), r.FormValue(service.NewPassword))
+	var invalid *service.ValidationError
+	if errors.As(err, &invalid) {
+		h.renderValidationError(w, invalid)
+		return
+	} else if err == service.ErrIncorrectPassword {
+		h.logger.Info(err.Error(), " user: ", username)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	} else if err == service.ErrExternalUser {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.logger.Error(err.Error())
+		return
+	}
+
+	if err := h.service.RevokeOtherSessions(ctx, username, currentCookie(r)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.logger.Error(err.Error())
+		return
+	}
+	renderJSON(w, "Password changed", h.logger)
+}
+
+// ответ не зависит от того, есть ли такой пользователь
+func (h *HttpHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
+	defer cancel()
+
+	if r.Method == http.MethodGet {
+		h.execTmpl(w, r, templateForgotPassword)
+		return
+	}
+
+	if err := h.service.RequestPasswordReset(ctx, r.FormValue(service.UserName)); err != nil {
+		h.logger.Error(err.Error())
+	}
+	// после WriteHeader renderJSON уже не сможет выставить заголовок
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	renderJSON(w, "If the account exists and has an email, a reset link has been sent", h.logger)
+}
+
+// задает новый пароль по ссылке из письма и завершает все сессии пользователя
+func (h *HttpHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if r.Method == http.MethodGet {
+		h.execTmplData(w, r, templateResetPassword, map[string]string{"Token": r.FormValue(service.ResetToken)})
+		return
+	}
+
+	username, err := h.service.ResetPassword(ctx, r.FormValue(service.ResetToken), r.FormValue(service.NewPassword))
+	var invalid *service.ValidationError
+	if errors.As(err, &invalid) {
+		h.renderValidationError(w, invalid)
+		return
+	} else if err == service.ErrBadResetToken {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.logger.Error(err.Error())
+		return
+	}
+
+	if err := h.service.RevokeAllSessions(ctx, username); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.logger.Error(err.Error())
+		return
+	}
+	h.logger.Info("Password reset for ", username)
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
@@ -0,0 +1,90 @@
+package httpHandler
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// адрес клиента, определенный ClientIPMiddleware
+type clientIPCtxKey struct{}
+
+// разбирает список адресов и подсетей доверенных прокси, например "10.0.0.1" или "10.0.0.0/8"
+func ParseTrustedProxies(list []string) ([]netip.Prefix, error) {
+	proxies := make([]netip.Prefix, 0, len(list))
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, fmt.Errorf("trusted proxy %q: %w", s, err)
+			}
+			proxies = append(proxies, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: %w", s, err)
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
+
+// определяет адрес клиента для ограничения частоты, блокировки входа, сессий и трассировки.
+// X-Forwarded-For учитывается, только если запрос пришел от доверенного прокси: адреса в нем
+// перебираются справа налево, и клиентом считается первый недоверенный
+func (h *HttpHandler) ClientIPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := remoteIP(r)
+		if h.trustedProxy(ip) {
+			ip = h.forwardedFor(r, ip)
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIPCtxKey{}, ip)))
+	})
+}
+
+// proxy - адрес доверенного прокси, приславшего запрос
+func (h *HttpHandler) forwardedFor(r *http.Request, proxy string) string {
+	hops := []string{}
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			// дальше цепочке верить нельзя
+			return proxy
+		}
+		proxy = addr.Unmap().String()
+		if !h.trustedProxy(proxy) {
+			return proxy
+		}
+	}
+	return proxy
+}
+
+func (h *HttpHandler) trustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range h.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,99 @@
+package httpHandler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+	"go.uber.org/zap"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1", "::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded []string
+		want      string
+	}{
+		{"direct", "203.0.113.7:5000", nil, "203.0.113.7"},
+		{"forged header without proxy", "203.0.113.7:5000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"from proxy", "10.0.0.2:5000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"forged hop before proxy", "10.0.0.2:5000", []string{"1.2.3.4, 198.51.100.1"}, "198.51.100.1"},
+		{"chain of proxies", "10.0.0.2:5000", []string{"198.51.100.1, 192.168.1.1", "10.1.1.1"}, "198.51.100.1"},
+		{"only proxies", "10.0.0.2:5000", []string{"10.0.0.3"}, "10.0.0.3"},
+		{"proxy without header", "10.0.0.2:5000", nil, "10.0.0.2"},
+		{"garbage in header", "10.0.0.2:5000", []string{"198.51.100.1, unknown"}, "10.0.0.2"},
+		{"ipv6 proxy", "[::1]:5000", []string{"2001:db8::1"}, "2001:db8::1"},
+		{"ipv4 mapped client", "10.0.0.2:5000", []string{"::ffff:198.51.100.1"}, "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHttpHandler(nil, nil, nil, proxies, zap.NewNop().Sugar(), nil)
+			got := ""
+			handler := h.ClientIPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = clientIP(r)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote
+			for _, header := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", header)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			if got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	for _, list := range [][]string{{"10.0.0.0/33"}, {"proxy.local"}, {""}} {
+		if _, err := ParseTrustedProxies(list); err == nil {
+			t.Errorf("%q parsed without error", list)
+		}
+	}
+}
+
+// разрешает limit запросов, остальные отклоняет
+type fakeRateLimitService struct {
+	Service
+	limit int
+	taken int
+}
+
+func (s *fakeRateLimitService) Allow(ctx context.Context, limit, key string) (*service.RateLimitResult, error) {
+	s.taken++
+	return &service.RateLimitResult{Allowed: s.taken <= s.limit, Limit: s.limit, Remaining: max(s.limit-s.taken, 0)}, nil
+}
+
+func TestRateLimitPostMiddleware(t *testing.T) {
+	tests := []struct {
+		method string
+		want   []int
+	}{
+		{http.MethodGet, []int{http.StatusOK, http.StatusOK, http.StatusOK}},
+		{http.MethodPost, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			s := &fakeRateLimitService{limit: 2}
+			h := NewHttpHandler(s, nil, nil, nil, zap.NewNop().Sugar(), nil)
+			handler := h.RateLimitPostMiddleware(service.LimitAuth, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			for i, want := range tt.want {
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, httptest.NewRequest(tt.method, "/login", nil))
+				if rec.Code != want {
+					t.Errorf("request %d: status %d, want %d", i+1, rec.Code, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package httpHandler
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+	"github.com/gorilla/mux"
+)
+
+type RateLimitService interface {
+	// забирает токен для key в группе limit, возвращает nil если для группы ограничения нет
+	Allow(ctx context.Context, limit, key string) (*service.RateLimitResult, error)
+}
+
+// ограничивает частоту запросов группы limit: авторизованного пользователя по логину, остальных по IP,
+// поэтому для маршрутов с авторизацией должен стоять после AuthMiddleware.
+// При превышении отвечает 429 с Retry-After. Если хранилище недоступно, запрос пропускается
+func (h *HttpHandler) RateLimitMiddleware(limit string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := "ip:" + clientIP(r)
+		if username := mux.Vars(r)[service.UserName]; username != "" {
+			key = "user:" + username
+		}
+
+		res, err := h.service.Allow(r.Context(), limit, key)
+		if err != nil {
+			h.logger.Error(err.Error())
+			next.ServeHTTP(w, r)
+			return
+		}
+		if res == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		w.Header().Set("X-RateLimit-Reset", ceilSeconds(res.Reset))
+		if !res.Allowed {
+			h.logger.Info(service.ErrRateLimited.Error(), " limit: ", limit, " key: ", key)
+			w.Header().Set("Retry-After", ceilSeconds(res.RetryAfter))
+			http.Error(w, service.ErrRateLimited.Error(), http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// для страниц с формой: показ формы не расходует попытки, ограничивается только отправка
+func (h *HttpHandler) RateLimitPostMiddleware(limit string, next http.Handler) http.Handler {
+	limited := h.RateLimitMiddleware(limit, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+		limited.ServeHTTP(w, r)
+	})
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,69 @@
+package httpHandler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+	"github.com/gorilla/mux"
+)
+
+const sessionId = "sessionId"
+
+type SessionsManagementService interface {
+	// возвращает активные сессии пользователя, текущая отмечена по значению куки
+	GetSessions(ctx context.Context, username, currentCookie string) ([]*service.SessionInfo, error)
+	// возвращает ошибку service.ErrNoSession если у пользователя нет такой сессии
+	RevokeSession(ctx context.Context, username, id string) error
+	RevokeOtherSessions(ctx context.Context, username, currentCookie string) error
+	RevokeAllSessions(ctx context.Context, username string) error
+}
+
+func (h *HttpHandler) Sessions(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	sessions, err := h.service.GetSessions(ctx, mux.Vars(r)[service.UserName], currentCookie(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.logger.Error(err.Error())
+		return
+	}
+	renderJSON(w, sessions, h.logger)
+}
+
+func (h *HttpHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	err := h.service.RevokeSession(ctx, mux.Vars(r)[service.UserName], r.FormValue(sessionId))
+	if err == service.ErrNoSession {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.logger.Error(err.Error())
+		return
+	}
+}
+
+func (h *HttpHandler) RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	err := h.service.RevokeOtherSessions(ctx, mux.Vars(r)[service.UserName], currentCookie(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.logger.Error(err.Error())
+		return
+	}
+}
+
+// значение куки сессии, пустое для запросов по токену API
+func currentCookie(r *http.Request) string {
+	if apiTokenFrom(r.Context()) != nil {
+		return ""
+	}
+	return sessionCookie(r)
+}
@@ -0,0 +1,177 @@
+package httpHandler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+	"github.com/gorilla/mux"
+)
+
+const (
+	templateTeam  = "team.html"
+	templateClaim = "claim.html"
+)
+
+type TeamsService interface {
+	// возвращает ошибку service.ErrTeamExist если команда уже есть, *service.ValidationError если имя не подходит
+	CreateTeam(ctx context.Context, owner, name string) (*service.Team, error)
+	// возвращает ошибку service.ErrNoTeam если команды нет
+	GetTeam(ctx context.Context, name string) (*service.Team, error)
+	GetTeams(ctx context.Context) ([]*service.Team, error)
+	GetUserTeams(ctx context.Context, username string) ([]string, error)
+	// возвращает ошибку service.ErrNotTeamOwner если owner не владелец команды
+	AddTeamMember(ctx context.Context, name, owner, username string) error
+	// возвращает ошибку service.ErrNotTeamOwner если actor убирает другого участника, не будучи владельцем,
+	// service.ErrOwnerLeave если убирают владельца
+	RemoveTeamMember(ctx context.Context, name, actor, username string) error
+}
+
+func (h *HttpHandler) Teams(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	teams, err := h.service.GetTeams(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.logger.Error(err.Error())
+		return
+	}
+	renderJSON(w, teams, h.logger)
+}
+
+func (h *HttpHandler) NewTeam(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if r.Method == http.MethodGet {
+		h.execTmpl(w, r, templateTeam)
+		return
+	}
+
+	team, err := h.service.CreateTeam(ctx, mux.Vars(r)[service.UserName], r.FormValue(service.TeamName))
+	var invalid *service.ValidationError
+	if errors.As(err, &invalid) {
+		h.renderValidationError(w, invalid)
+		return
+	} else if err == service.ErrTeamExist {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.logger.Error(err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	renderJSON(w, team, h.logger)
+}
+
+func (h *HttpHandler) AddTeamMember(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	member := r.FormValue(service.UserName)
+	if !h.validateExecutor(ctx, w, member) {
+		return
+	}
+	err := h.service.AddTeamMember(ctx, r.FormValue(service.TeamName), mux.Vars(r)[service.UserName], member)
+	h.renderTeamError(w, err)
+}
+
+// без username пользователь выходит из команды сам
+func (h *HttpHandler) RemoveTeamMember(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	actor := mux.Vars(r)[service.UserName]
+	member := r.FormValue(service.UserName)
+	if member == "" {
+		member = actor
+	}
+	err := h.service.RemoveTeamMember(ctx, r.FormValue(service.TeamName), actor, member)
+	h.renderTeamError(w, err)
+}
+
+// участник команды забирает назначенную на нее задачу себе
+func (h *HttpHandler) Claim(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if r.Method == http.MethodGet {
+		h.execTmpl(w, r, templateClaim)
+		return
+	}
+
+	taskId, err := strconv.Atoi(r.FormValue(service.TaskId))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.service.ClaimTask(ctx, uint64(taskId), mux.Vars(r)[service.UserName])
+	if err == service.ErrNoTask {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err == service.ErrNotTeamMember {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	} else if err == service.ErrNoTeamTask {
+		// команду уже сняли, например, задачу одновременно взял другой участник
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.logger.Error(err.Error())
+		return
+	}
+}
+
+// назначать и снимать команды может только владелец задачи
+func (h *HttpHandler) assignTeam(ctx context.Context, taskId uint64, username, team string) error {
+	if err := h.service.CheckOwner(ctx, taskId, username); err != nil {
+		return err
+	}
+	return h.service.AssignTeam(ctx, taskId, team)
+}
+
+func (h *HttpHandler) unassignTeam(w http.ResponseWriter, r *http.Request, team string) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	taskId, err := strconv.Atoi(r.FormValue(service.TaskId))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.service.CheckOwner(ctx, uint64(taskId), mux.Vars(r)[service.UserName])
+	if err == nil {
+		err = h.service.UnassignTeam(ctx, uint64(taskId), team)
+	}
+	if err == service.ErrNotOwner {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	} else if err == service.ErrNoTask {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.logger.Error(err.Error())
+		return
+	}
+}
+
+func (h *HttpHandler) renderTeamError(w http.ResponseWriter, err error) {
+	if err == service.ErrNoTeam {
+		http.Error(w, err.Error(), http.StatusNotFound)
+	} else if err == service.ErrNotTeamOwner || err == service.ErrOwnerLeave {
+		http.Error(w, err.Error(), http.StatusForbidden)
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.logger.Error(err.Error())
+	}
+}
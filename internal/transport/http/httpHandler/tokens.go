@@ -0,0 +1,108 @@
+package httpHandler
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+	"github.com/gorilla/mux"
+)
+
+const (
+	templateToken = "token.html"
+	tokenName     = "name"
+	tokenScopes   = "scopes"
+	tokenId       = "tokenId"
+	// срок действия в днях, 0 или пусто - бессрочный
+	tokenExpiresIn = "expires_in"
+)
+
+type TokensService interface {
+	// возвращает значение токена, оно показывается только один раз; ошибку service.ErrBadScope при неверных scope
+	CreateToken(ctx context.Context, username, name string, scopes []string, ttl time.Duration) (string, *service.APIToken, error)
+	GetTokens(ctx context.Context, username string) ([]*service.APIToken, error)
+	// возвращает ошибку service.ErrNoToken если у пользователя нет такого токена
+	RevokeToken(ctx context.Context, id string, username string) error
+	// возвращает ошибку service.ErrNoToken или service.ErrTokenExpired если токен недействителен
+	AuthenticateToken(ctx context.Context, raw string) (*service.APIToken, error)
+}
+
+func (h *HttpHandler) Tokens(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	tokens, err := h.service.GetTokens(ctx, mux.Vars(r)[service.UserName])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.logger.Error(err.Error())
+		return
+	}
+	renderJSON(w, tokens, h.logger)
+}
+
+// scope передаются несколькими полями scopes или через запятую
+func (h *HttpHandler) NewToken(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if r.Method == http.MethodGet {
+		h.execTmpl(w, r, templateToken)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	scopes := []string{}
+	for _, value := range r.Form[tokenScopes] {
+		for _, scope := range strings.Split(value, ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	var ttl time.Duration
+	if days := r.FormValue(tokenExpiresIn); days != "" {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			http.Error(w, "bad "+tokenExpiresIn, http.StatusBadRequest)
+			return
+		}
+		ttl = time.Duration(n) * 24 * time.Hour
+	}
+
+	raw, token, err := h.service.CreateToken(ctx, mux.Vars(r)[service.UserName], r.FormValue(tokenName), scopes, ttl)
+	if err == service.ErrBadScope {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.logger.Error(err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	renderJSON(w, map[string]interface{}{
+		"token":   raw,
+		"details": token,
+	}, h.logger)
+}
+
+func (h *HttpHandler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	err := h.service.RevokeToken(ctx, r.FormValue(tokenId), mux.Vars(r)[service.UserName])
+	if err == service.ErrNoToken {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.logger.Error(err.Error())
+		return
+	}
+}
@@ -0,0 +1,192 @@
+package httpHandler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+	"github.com/gorilla/mux"
+)
+
+const (
+	templateTwoFactor      = "twofactor.html"
+	templateLoginTwoFactor = "login_2fa.html"
+	twoFactorCookiePath    = "/login/2fa"
+)
+
+type TwoFactorService interface {
+	// возвращает otpauth:// ссылку; ошибку service.ErrTwoFactorEnabled если 2FA уже включена
+	EnrollTwoFactor(ctx context.Context, username string) (string, error)
+	// возвращает коды восстановления, они показываются только один раз; ошибку service.ErrBadOTP при неверном коде
+	ConfirmTwoFactor(ctx context.Context, username, code string) ([]string, error)
+	// принимает код приложения или код восстановления, возвращает ошибку service.ErrBadOTP при неверном коде
+	VerifyTwoFactor(ctx context.Context, username, code string) error
+	DisableTwoFactor(ctx context.Context, username, code string) error
+	ResetTwoFactor(ctx context.Context, username string) error
+	TwoFactorEnabled(ctx context.Context, username string) (bool, error)
+	// запоминает вход, ожидающий кода 2FA
+	AddTwoFactorChallenge(ctx context.Context, username string) (string, error)
+	// возвращает ошибку service.ErrNoUserBySession если вход истек
+	TakeTwoFactorChallenge(ctx context.Context, challenge string) (string, error)
+}
+
+func (h *HttpHandler) TwoFactor(w http.ResponseWriter, r *http.Request) {
+	h.execTmpl(w, r, templateTwoFactor)
+}
+
+func (h *HttpHandler) EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	uri, err := h.service.EnrollTwoFactor(ctx, mux.Vars(r)[service.UserName])
+	if err == service.ErrTwoFactorEnabled {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.logger.Error(err.Error())
+		return
+	}
+	renderJSON(w, map[string]string{"otpauth_uri": uri}, h.logger)
+}
+
+func (h *HttpHandler) ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	codes, err := h.service.ConfirmTwoFactor(ctx, mux.Vars(r)[service.UserName], r.FormValue(service.OTPCode))
+	if err == service.ErrBadOTP {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	} else if err == service.ErrTwoFactorEnabled || err == service.ErrTwoFactorNotEnrolled {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.logger.Error(err.Error())
+		return
+	}
+	renderJSON(w, map[string][]string{"recovery_codes": codes}, h.logger)
+}
+
+func (h *HttpHandler) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	err := h.service.DisableTwoFactor(ctx, mux.Vars(r)[service.UserName], r.FormValue(service.OTPCode))
+	if err == service.ErrBadOTP {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	} else if err == service.ErrTwoFactorNotEnrolled {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.logger.Error(err.Error())
+		return
+	}
+}
+
+// сброс 2FA другого пользователя, только для администраторов
+func (h *HttpHandler) ResetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	target := r.FormValue(service.UserName)
+	err := h.service.ResetTwoFactor(ctx, target)
+	if err == service.ErrNoUser {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.logger.Error(err.Error())
+		return
+	}
+	h.logger.Info("2FA reset for ", target, " by ", mux.Vars(r)[service.UserName])
+}
+
+// второй шаг входа: по куке незавершенного входа и коду выдает сессию
+func (h *HttpHandler) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if r.Method == http.MethodGet {
+		h.execTmpl(w, r, templateLoginTwoFactor)
+		return
+	}
+
+	cookie, err := r.Cookie(service.TwoFactorCookie)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     service.TwoFactorCookie,
+		Path:     twoFactorCookiePath,
+		Expires:  time.Now().AddDate(0, 0, -1),
+		HttpOnly: true,
+	})
+
+	// после значения входа кука хранит выбор "запомнить меня"
+	challenge, rememberFlag, _ := strings.Cut(cookie.Value, ".")
+	username, err := h.service.TakeTwoFactorChallenge(ctx, challenge)
+	if err == service.ErrNoUserBySession {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.logger.Error(err.Error())
+		return
+	}
+
+	ip := clientIP(r)
+	if !h.checkLogin(ctx, w, username, ip) {
+		return
+	}
+	err = h.service.VerifyTwoFactor(ctx, username, r.FormValue(service.OTPCode))
+	if err == service.ErrBadOTP {
+		h.logger.Info(err.Error(), " user: ", username, " ip: ", ip)
+		h.service.LoginFailed(ctx, username, ip)
+		http.Error(w, service.ErrInvalidCredentials.Error(), http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.logger.Error(err.Error())
+		return
+	}
+	h.service.LoginSucceeded(ctx, username)
+
+	session, err := h.service.AddCookie(ctx, username, clientInfo(r), rememberFlag == "1")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.logger.Error(err.Error())
+		return
+	}
+	setSessionCookies(w, session)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// начинает второй шаг входа для пользователя, прошедшего проверку пароля
+func (h *HttpHandler) startTwoFactor(ctx context.Context, w http.ResponseWriter, r *http.Request, username string, remember bool) {
+	challenge, err := h.service.AddTwoFactorChallenge(ctx, username)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.logger.Error(err.Error())
+		return
+	}
+	rememberFlag := "0"
+	if remember {
+		rememberFlag = "1"
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     service.TwoFactorCookie,
+		Value:    challenge + "." + rememberFlag,
+		Path:     twoFactorCookiePath,
+		Expires:  time.Now().Add(5 * time.Minute),
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.Redirect(w, r, twoFactorCookiePath, http.StatusSeeOther)
+}
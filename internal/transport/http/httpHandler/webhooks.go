@@ -0,0 +1,133 @@
+package httpHandler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+	"github.com/gorilla/mux"
+)
+
+const (
+	templateWebhook = "webhook.html"
+	deliveriesLimit = 100
+)
+
+type WebhooksService interface {
+	// возвращает id подписки, ошибку service.ErrBadWebhookURL, service.ErrWebhookHostNotAllowed
+	// или service.ErrBadEventType при неверных параметрах. Пустой секрет заменяется сгенерированным
+	AddSubscription(ctx context.Context, sub *service.WebhookSubscription) (uint64, error)
+	GetSubscriptions(ctx context.Context, owner string) ([]*service.WebhookSubscription, error)
+	// возвращает ошибку service.ErrNoSubscription если у owner нет такой подписки
+	DeleteSubscription(ctx context.Context, id uint64, owner string) error
+	// возвращает ошибку service.ErrNoSubscription если у owner нет такой подписки
+	GetDeliveries(ctx context.Context, id uint64, owner string, limit int) ([]*service.WebhookDelivery, error)
+}
+
+func (h *HttpHandler) Webhooks(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	subs, err := h.service.GetSubscriptions(ctx, mux.Vars(r)[service.UserName])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.logger.Error(err.Error())
+		return
+	}
+	renderJSON(w, subs, h.logger)
+}
+
+// события передаются несколькими полями events или через запятую
+func (h *HttpHandler) NewWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if r.Method == http.MethodGet {
+		h.execTmpl(w, r, templateWebhook)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	events := []string{}
+	for _, value := range r.Form[service.WebhookEvents] {
+		for _, event := range strings.Split(value, ",") {
+			if event = strings.TrimSpace(event); event != "" {
+				events = append(events, event)
+			}
+		}
+	}
+
+	sub := &service.WebhookSubscription{
+		Owner:  mux.Vars(r)[service.UserName],
+		URL:    r.FormValue(service.WebhookURL),
+		Secret: r.FormValue(service.WebhookSecret),
+		Events: events,
+	}
+	id, err := h.service.AddSubscription(ctx, sub)
+	if errors.Is(err, service.ErrBadWebhookURL) || errors.Is(err, service.ErrBadEventType) || err == service.ErrWebhookHostNotAllowed {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.logger.Error(err.Error())
+		return
+	}
+	// секрет показывается только один раз
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	renderJSON(w, map[string]interface{}{
+		"id":     id,
+		"secret": sub.Secret,
+	}, h.logger)
+}
+
+func (h *HttpHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	id, err := strconv.ParseUint(r.FormValue(service.WebhookId), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.service.DeleteSubscription(ctx, id, mux.Vars(r)[service.UserName])
+	if err == service.ErrNoSubscription {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.logger.Error(err.Error())
+		return
+	}
+}
+
+func (h *HttpHandler) WebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars[service.WebhookId], 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	deliveries, err := h.service.GetDeliveries(ctx, id, vars[service.UserName], deliveriesLimit)
+	if err == service.ErrNoSubscription {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.logger.Error(err.Error())
+		return
+	}
+	renderJSON(w, deliveries, h.logger)
+}
@@ -0,0 +1,179 @@
+package httpHandler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/RusGadzhiev/TaskManager/internal/service"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsWriteWait      = 10 * time.Second
+	wsPongWait       = 60 * time.Second
+	wsPingPeriod     = wsPongWait * 9 / 10
+	wsMaxMessageSize = 4096
+	wsSendBuffer     = 64
+
+	wsCommandAssign   = "assign"
+	wsCommandComplete = "complete"
+	wsCommandMove     = "move"
+
+	wsMessageSnapshot = "snapshot"
+	wsMessageEvent    = "event"
+	wsMessageResult   = "result"
+)
+
+// проверка Origin по умолчанию не пускает чужие сайты с cookie пользователя
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// команда доски задач от клиента
+type wsCommand struct {
+	ID       string `json:"id"`
+	Command  string `json:"command"`
+	TaskId   uint64 `json:"taskId"`
+	Executor string `json:"executor,omitempty"`
+	Status   string `json:"status,omitempty"`
+}
+
+// сообщение клиенту: начальное состояние доски, событие или результат команды
+type wsMessage struct {
+	Type  string             `json:"type"`
+	ID    string             `json:"id,omitempty"`
+	Error string             `json:"error,omitempty"`
+	Tasks []*service.Task    `json:"tasks,omitempty"`
+	Event *service.TaskEvent `json:"event,omitempty"`
+}
+
+// Board - WebSocket для доски задач: после подключения отправляет видимые пользователю задачи,
+// затем пересылает их изменения и выполняет команды assign, complete и move
+func (h *HttpHandler) Board(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)[service.UserName]
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		h.logger.Info("websocket upgrade: ", err.Error())
+		return
+	}
+	defer conn.Close()
+
+	_, _, _, events, unsubscribe := h.events.Subscribe(^uint64(0))
+	defer unsubscribe()
+
+	// контекст запроса несет спан, автора изменений и токен для проверки scope команд.
+	// Временем жизни управляет само соединение через cancel
+	ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+	defer cancel()
+
+	tasks, err := h.service.GetAllTasks(ctx)
+	if err != nil {
+		h.logger.Error(err.Error())
+		return
+	}
+	teams, err := h.service.GetUserTeams(ctx, username)
+	if err != nil {
+		h.logger.Error(err.Error())
+		return
+	}
+	visible := []*service.Task{}
+	for _, task := range tasks {
+		if task.VisibleToMember(username, teams) {
+			visible = append(visible, task)
+		}
+	}
+
+	send := make(chan *wsMessage, wsSendBuffer)
+	send <- &wsMessage{Type: wsMessageSnapshot, Tasks: visible}
+
+	go h.readBoardCommands(ctx, cancel, conn, username, send)
+
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+
+	for {
+		var msg *wsMessage
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				h.logger.Info("websocket subscriber dropped: ", username)
+				return
+			}
+			if !event.VisibleTo(username) {
+				continue
+			}
+			msg = &wsMessage{Type: wsMessageEvent, Event: event}
+		case msg = <-send:
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+			continue
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		if err := conn.WriteJSON(msg); err != nil {
+			return
+		}
+	}
+}
+
+// читает команды клиента до закрытия соединения, результаты отправляет в send
+func (h *HttpHandler) readBoardCommands(ctx context.Context, cancel context.CancelFunc, conn *websocket.Conn, username string, send chan<- *wsMessage) {
+	defer cancel()
+
+	conn.SetReadLimit(wsMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		var cmd wsCommand
+		if err := conn.ReadJSON(&cmd); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				h.logger.Info("websocket read: ", err.Error())
+			}
+			return
+		}
+
+		result := &wsMessage{Type: wsMessageResult, ID: cmd.ID}
+		if err := h.execBoardCommand(ctx, username, &cmd); err != nil {
+			result.Error = err.Error()
+		}
+
+		select {
+		case send <- result:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// подключение по токену проверяется на scope read, команды изменяют задачи и требуют write
+func (h *HttpHandler) execBoardCommand(ctx context.Context, username string, cmd *wsCommand) error {
+	if token := apiTokenFrom(ctx); token != nil && !token.HasScope(service.ScopeWrite) {
+		return errors.New("token has no " + service.ScopeWrite + " scope")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	switch cmd.Command {
+	case wsCommandAssign:
+		return h.assignTask(ctx, cmd.TaskId, username, cmd.Executor)
+	case wsCommandComplete:
+		return h.service.Complete(ctx, cmd.TaskId, username)
+	case wsCommandMove:
+		return h.service.SetStatus(ctx, cmd.TaskId, username, cmd.Status)
+	}
+	return errors.New("unknown command: " + cmd.Command)
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/RusGadzhiev/TaskManager/internal/config"
+	"github.com/RusGadzhiev/TaskManager/internal/metrics"
 	"github.com/RusGadzhiev/TaskManager/internal/transport/http/httpHandler"
 	"go.uber.org/zap"
 )
@@ -25,6 +26,21 @@ func NewHttpServer(ctx context.Context, h *httpHandler.HttpHandler, cfg *config.
 		}}
 }
 
+const metricsTimeout = 10 * time.Second
+
+// отдает только /metrics, отдельно от API, чтобы метрики не были доступны снаружи
+func NewMetricsServer(cfg *config.Metrics) *HttpServer {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metrics.Handler())
+	return &HttpServer{
+		server: &http.Server{
+			Addr:         ":" + cfg.Port,
+			ReadTimeout:  metricsTimeout,
+			WriteTimeout: metricsTimeout,
+			Handler:      mux,
+		}}
+}
+
 func (srv *HttpServer) Run(ctx context.Context, logger *zap.SugaredLogger) error {
 	go func() {
 		if err := srv.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {